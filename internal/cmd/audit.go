@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+
+	"ely.by/profilecerts/internal/db/mysql"
+	"ely.by/profilecerts/internal/db/redis"
+	"ely.by/profilecerts/internal/services/audit"
+)
+
+func newAuditLogWithConfig(config *viper.Viper, mysql *mysql.MySQL, redis *redis.Redis) (*audit.Log, error) {
+	sink, err := newAuditSinkWithConfig(config, mysql, redis)
+	if err != nil {
+		return nil, err
+	}
+
+	return audit.NewWithConfig(config, sink)
+}
+
+// Returns nil when auditing is disabled
+func newAuditSinkWithConfig(config *viper.Viper, mysqlDb *mysql.MySQL, redisDb *redis.Redis) (audit.Sink, error) {
+	config.SetDefault("audit.sink", "none")
+	config.SetDefault("audit.mysql.table", "profilecerts_audit_log")
+	config.SetDefault("audit.redis.stream", "profilecerts:audit")
+	config.SetDefault("audit.redis.max_len", 1000000)
+
+	switch sink := config.GetString("audit.sink"); sink {
+	case "none":
+		return nil, nil
+	case "file":
+		return audit.NewFileSinkWithConfig(config)
+	case "mysql":
+		return mysql.NewAuditLog(mysqlDb, config.GetString("audit.mysql.table"))
+	case "redis":
+		return redis.NewAuditStream(redisDb, config.GetString("audit.redis.stream"), config.GetInt64("audit.redis.max_len")), nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink %s, expected none, file, mysql or redis", sink)
+	}
+}
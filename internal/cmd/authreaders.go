@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"ely.by/profilecerts/internal/db/redis"
+	"ely.by/profilecerts/internal/services/authreader"
+)
+
+type accountsApi interface {
+	authreader.AccountsPublicKeyProvider
+	authreader.RevocationListProvider
+}
+
+type authReaderDeps struct {
+	accountsApi accountsApi
+	accounts    authreader.AccountsRepository
+	redis       *redis.Redis
+}
+
+// Limits how long the start is delayed by the first fetch of the revocation list
+const revocationListLoadTimeout = 10 * time.Second
+
+type authReaders struct {
+	reader authreader.Reader
+	// Nil when the cache is disabled
+	cache *authreader.CachedReader
+	// Nil unless revocations are polled from the Accounts
+	revocationList *authreader.PolledRevocationList
+}
+
+// The ctx controls background jobs of the readers
+func newAuthReaderWithConfig(ctx context.Context, config *viper.Viper, deps authReaderDeps) (*authReaders, error) {
+	config.SetDefault("auth.readers", []string{"elyby"})
+	config.SetDefault("auth.dispatch", "order")
+	config.SetDefault("auth.cache.size", 10000)
+
+	var dispatchByShape bool
+	switch dispatch := config.GetString("auth.dispatch"); dispatch {
+	case "order":
+		dispatchByShape = false
+	case "shape":
+		dispatchByShape = true
+	default:
+		return nil, fmt.Errorf("unknown auth readers dispatch mode %s, expected order or shape", dispatch)
+	}
+
+	names := config.GetStringSlice("auth.readers")
+	if len(names) == 0 {
+		return nil, fmt.Errorf("at least one auth reader must be configured")
+	}
+
+	readers := make([]authreader.NamedReader, len(names))
+	for i, name := range names {
+		reader, err := newNamedAuthReader(config, name, deps)
+		if err != nil {
+			return nil, fmt.Errorf("unable to initialize %s auth reader: %w", name, err)
+		}
+
+		readers[i] = reader
+	}
+
+	var reader authreader.Reader = authreader.NewChain(dispatchByShape, readers...)
+	var cache *authreader.CachedReader
+	if config.GetInt("auth.cache.size") > 0 {
+		var err error
+		cache, err = authreader.NewCachedWithConfig(config, reader)
+		if err != nil {
+			return nil, fmt.Errorf("unable to initialize auth cache: %w", err)
+		}
+
+		reader = cache
+	}
+
+	// Revocations must be checked outside the cache, so cached tokens can be revoked too
+	var revocationSource authreader.RevocationSource
+	var revocationList *authreader.PolledRevocationList
+	switch source := config.GetString("auth.revocation.source"); source {
+	case "":
+		return &authReaders{reader: reader, cache: cache}, nil
+	case "redis":
+		revocationSource = deps.redis
+	case "accounts":
+		revocationList = authreader.NewPolledRevocationListWithConfig(config, deps.accountsApi)
+		loadCtx, cancel := context.WithTimeout(ctx, revocationListLoadTimeout)
+		err := revocationList.Load(loadCtx)
+		cancel()
+		if err != nil {
+			slog.Warn("unable to load the revocation list on start, it will be retried in the background", slog.Any("err", err))
+		}
+
+		go revocationList.Run(ctx)
+		revocationSource = revocationList
+	default:
+		return nil, fmt.Errorf("unknown revocation source %s, expected redis or accounts", source)
+	}
+
+	revocationChecking, err := authreader.NewRevocationCheckingWithConfig(config, reader, revocationSource)
+	if err != nil {
+		return nil, err
+	}
+
+	return &authReaders{revocationChecking, cache, revocationList}, nil
+}
+
+func newNamedAuthReader(config *viper.Viper, name string, deps authReaderDeps) (authreader.NamedReader, error) {
+	switch name {
+	case "elyby":
+		reader, err := authreader.NewElybyWithConfig(config, deps.accountsApi, deps.redis, deps.accounts)
+		if err != nil {
+			return authreader.NamedReader{}, err
+		}
+
+		return authreader.NamedReader{Name: name, Reader: reader, Accepts: authreader.IsBearerJwt}, nil
+	case "introspection":
+		reader, err := authreader.NewIntrospectionWithConfig(config, deps.accounts)
+		if err != nil {
+			return authreader.NamedReader{}, err
+		}
+
+		return authreader.NamedReader{Name: name, Reader: reader, Accepts: authreader.IsBearerOpaque}, nil
+	case "yggdrasil":
+		store, err := newYggdrasilTokenStoreWithConfig(config, deps)
+		if err != nil {
+			return authreader.NamedReader{}, err
+		}
+
+		reader := authreader.NewYggdrasil(store, deps.accounts)
+
+		return authreader.NamedReader{Name: name, Reader: reader, Accepts: authreader.IsBearerOpaque}, nil
+	default:
+		return authreader.NamedReader{}, fmt.Errorf("unknown auth reader")
+	}
+}
+
+func newYggdrasilTokenStoreWithConfig(config *viper.Viper, deps authReaderDeps) (authreader.YggdrasilTokenStore, error) {
+	config.SetDefault("auth.yggdrasil.store", "http")
+	config.SetDefault("auth.yggdrasil.redis.key_prefix", "yggdrasil:access-tokens:")
+
+	switch store := config.GetString("auth.yggdrasil.store"); store {
+	case "http":
+		return authreader.NewYggdrasilHttpStoreWithConfig(config)
+	case "redis":
+		return redis.NewYggdrasilTokens(deps.redis, config.GetString("auth.yggdrasil.redis.key_prefix")), nil
+	default:
+		return nil, fmt.Errorf("unknown yggdrasil token store %s, expected http or redis", store)
+	}
+}
@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"github.com/spf13/viper"
+
+	"ely.by/profilecerts/internal/db/redis"
+	"ely.by/profilecerts/internal/http"
+)
+
+// Returns nil when rate limiting is disabled
+func newRateLimitsWithConfig(config *viper.Viper, redis *redis.Redis) (*http.RateLimits, error) {
+	config.SetDefault("ratelimit.enabled", false)
+	if !config.GetBool("ratelimit.enabled") {
+		return nil, nil
+	}
+
+	return http.NewRateLimitsWithConfig(config, redis)
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/viper"
+
+	"ely.by/profilecerts/internal/logging"
+	"ely.by/profilecerts/internal/logging/sentry"
+	"ely.by/profilecerts/internal/logging/tracing"
+)
+
+func newErrorReporterWithConfig(config *viper.Viper) (logging.ErrorReporter, error) {
+	config.SetDefault("error_reporter", "sentry")
+
+	tags := map[string]string{"storage": "redis"}
+
+	switch reporter := config.GetString("error_reporter"); reporter {
+	case "sentry":
+		return sentry.NewErrorReporterWithConfig(config, tags)
+	case "otel":
+		// Errors are recorded on request spans, so without tracing they would be silently lost
+		if !config.GetBool("tracing.enabled") {
+			return nil, errors.New("the otel error reporter requires tracing to be enabled")
+		}
+
+		return tracing.NewErrorReporter(tags), nil
+	case "none":
+		return logging.NopErrorReporter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown error reporter %s, expected sentry, otel or none", reporter)
+	}
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestNewErrorReporterWithConfig(t *testing.T) {
+	testCases := []struct {
+		name         string
+		values       map[string]any
+		expectedType string
+	}{
+		{name: "none", values: map[string]any{"error_reporter": "none"}, expectedType: "logging.NopErrorReporter"},
+		{name: "otel with tracing", values: map[string]any{"error_reporter": "otel", "tracing.enabled": true}, expectedType: "*tracing.ErrorReporter"},
+		// Otherwise the errors would be recorded on spans that are never exported
+		{name: "otel without tracing", values: map[string]any{"error_reporter": "otel"}},
+		{name: "unknown", values: map[string]any{"error_reporter": "rollbar"}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			config := viper.New()
+			for key, value := range testCase.values {
+				config.Set(key, value)
+			}
+
+			reporter, err := newErrorReporterWithConfig(config)
+			if testCase.expectedType == "" {
+				if err == nil {
+					t.Fatalf("expected an error, got %T", reporter)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if actual := fmt.Sprintf("%T", reporter); actual != testCase.expectedType {
+				t.Fatalf("expected the %s reporter, got %s", testCase.expectedType, actual)
+			}
+		})
+	}
+}
@@ -3,22 +3,22 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/etherlabsio/healthcheck/v2"
-	sentry2 "github.com/getsentry/sentry-go"
-	sentrygin "github.com/getsentry/sentry-go/gin"
 	"github.com/gin-gonic/gin"
 
 	"ely.by/profilecerts/internal/db/mysql"
 	"ely.by/profilecerts/internal/db/redis"
 	"ely.by/profilecerts/internal/http"
-	"ely.by/profilecerts/internal/logging/sentry"
+	"ely.by/profilecerts/internal/logging"
+	"ely.by/profilecerts/internal/logging/tracing"
 	"ely.by/profilecerts/internal/services/accounts"
-	"ely.by/profilecerts/internal/services/authreader"
+	"ely.by/profilecerts/internal/services/admission"
 	"ely.by/profilecerts/internal/services/certmanager"
 	"ely.by/profilecerts/internal/services/signer"
 )
@@ -29,11 +29,27 @@ func Serve() error {
 	ctx := context.Background()
 	ctx, _ = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM, os.Kill)
 
-	err := sentry.InitWithConfig(config)
+	logOutput, err := logging.InitWithConfig(config)
 	if err != nil {
-		return fmt.Errorf("unable to initialize Sentry: %w", err)
+		return fmt.Errorf("unable to initialize logging: %w", err)
 	}
-	defer sentry2.Flush(time.Second * 3)
+	defer logOutput.Close()
+
+	errorReporter, err := newErrorReporterWithConfig(config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize error reporter: %w", err)
+	}
+	defer errorReporter.Flush(time.Second * 3)
+
+	shutdownTracing, err := tracing.InitWithConfig(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize tracing: %w", err)
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		defer cancel()
+		_ = shutdownTracing(shutdownCtx)
+	}()
 
 	redis := redis.NewWithConfig(config)
 
@@ -42,9 +58,33 @@ func Serve() error {
 		return fmt.Errorf("unable to initialize mysql: %w", err)
 	}
 
-	profilesCertificatesService := certmanager.New(redis)
+	auditLog, err := newAuditLogWithConfig(config, mysql, redis)
+	if err != nil {
+		return fmt.Errorf("unable to initialize audit log: %w", err)
+	}
+	// Runs after the servers have been shut down, so no more events are recorded
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		defer cancel()
+		err := auditLog.Close(closeCtx)
+		if err != nil {
+			slog.Error("unable to close the audit log", slog.Any("err", err))
+		}
+	}()
+
+	keyGenerationLimiter, err := admission.NewWithConfig(config, "key_generation")
+	if err != nil {
+		return fmt.Errorf("unable to initialize key generation admission: %w", err)
+	}
 
-	signerService, err := signer.NewLocalWithConfig(config)
+	profilesCertificatesService := certmanager.New(redis, auditLog, keyGenerationLimiter)
+
+	signingLimiter, err := admission.NewWithConfig(config, "signing")
+	if err != nil {
+		return fmt.Errorf("unable to initialize signing admission: %w", err)
+	}
+
+	signerService, err := signer.NewLocalWithConfig(config, signingLimiter)
 	if err != nil {
 		return fmt.Errorf("unable tot initialize signer: %w", err)
 	}
@@ -54,7 +94,19 @@ func Serve() error {
 		return fmt.Errorf("unable to initialize accounts api: %w", err)
 	}
 
-	authReader := authreader.NewElyby(accountsApi, mysql)
+	authReaders, err := newAuthReaderWithConfig(ctx, config, authReaderDeps{
+		accountsApi: accountsApi,
+		accounts:    mysql,
+		redis:       redis,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to initialize auth reader: %w", err)
+	}
+
+	rateLimits, err := newRateLimitsWithConfig(config, redis)
+	if err != nil {
+		return fmt.Errorf("unable to initialize rate limits: %w", err)
+	}
 
 	if config.GetBool("debug") {
 		gin.SetMode(gin.DebugMode)
@@ -62,20 +114,42 @@ func Serve() error {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	r := gin.Default()
-	r.Use(sentrygin.New(sentrygin.Options{Repanic: true}))
-	r.Use(sentry.ErrorMiddleware())
+	r := gin.New()
+	err = http.ConfigureClientIpWithConfig(config, r)
+	if err != nil {
+		return fmt.Errorf("unable to configure client ip resolution: %w", err)
+	}
+
+	r.Use(http.RequestIdMiddleware())
+	r.Use(http.TracingMiddleware())
+	r.Use(http.AccessLogMiddleware("/healthcheck"))
+	r.Use(gin.Recovery())
+	r.Use(http.ErrorReportingMiddleware(errorReporter))
 	r.Use(http.ErrorMiddleware())
 
-	r.GET("/healthcheck", gin.WrapH(healthcheck.Handler(
+	healthcheckOptions := []healthcheck.Option{
 		healthcheck.WithChecker("redis", healthcheck.CheckerFunc(redis.Ping)),
 		healthcheck.WithChecker("mysql", healthcheck.CheckerFunc(mysql.Ping)),
-	)))
+	}
+	healthcheckHandler := gin.WrapH(healthcheck.Handler(healthcheckOptions...))
+
+	// Until the revocation list is loaded, requests are rejected in the fail-closed mode or aren't checked otherwise
+	readinessHandler := healthcheckHandler
+	if authReaders.revocationList != nil {
+		readinessHandler = gin.WrapH(healthcheck.Handler(append(
+			healthcheckOptions,
+			healthcheck.WithChecker("revocation_list", healthcheck.CheckerFunc(authReaders.revocationList.Ready)),
+		)...))
+	}
+
+	r.GET("/healthcheck", healthcheckHandler)
 
 	sessionserver := http.NewProfileCertificatesApi(
 		profilesCertificatesService,
-		authReader,
+		authReaders.reader,
+		authReaders.cache,
 		signerService,
+		rateLimits,
 	)
 	sessionserver.DefineRoutes(r)
 
@@ -84,7 +158,37 @@ func Serve() error {
 		return fmt.Errorf("unable to create a server: %w", err)
 	}
 
-	err = http.StartServer(ctx, server)
+	ops := gin.New()
+	err = http.ConfigureClientIpWithConfig(config, ops)
+	if err != nil {
+		return fmt.Errorf("unable to configure client ip resolution: %w", err)
+	}
+
+	ops.Use(http.RequestIdMiddleware())
+	ops.Use(http.TracingMiddleware())
+	ops.Use(http.AccessLogMiddleware("/healthcheck", "/liveness", "/readiness", "/metrics"))
+	ops.Use(gin.Recovery())
+	ops.Use(http.ErrorReportingMiddleware(errorReporter))
+	ops.Use(http.ErrorMiddleware())
+
+	ops.GET("/healthcheck", healthcheckHandler)
+	ops.GET("/readiness", readinessHandler)
+	http.DefineOpsRoutes(ops)
+
+	serviceAuth, err := http.NewServiceAuthWithConfig(config, redis)
+	if err != nil {
+		return fmt.Errorf("unable to initialize service auth: %w", err)
+	}
+
+	adminApi := http.NewAdminApi(profilesCertificatesService, serviceAuth, auditLog, authReaders.cache)
+	adminApi.DefineRoutes(ops)
+
+	opsServer, err := http.NewOpsServerWithConfig(config, ops)
+	if err != nil {
+		return fmt.Errorf("unable to create an ops server: %w", err)
+	}
+
+	err = http.StartServer(ctx, server, opsServer)
 	if err != nil {
 		return fmt.Errorf("unable to start a server: %w", err)
 	}
@@ -0,0 +1,59 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+
+	"github.com/goccy/go-json"
+
+	"ely.by/profilecerts/internal/services/audit"
+)
+
+var validTableName = regexp.MustCompile(`^\w+$`)
+
+// Inserts audit events into a table. See the README for its schema
+type AuditLog struct {
+	insertStmt *sql.Stmt
+}
+
+func NewAuditLog(m *MySQL, table string) (*AuditLog, error) {
+	// The table name can't be passed as a placeholder, so it's validated instead
+	if !validTableName.MatchString(table) {
+		return nil, fmt.Errorf("invalid audit table name %s", table)
+	}
+
+	insertStmt, err := m.db.Prepare(fmt.Sprintf(
+		"INSERT INTO `%s` (time, type, uuid, actor, ip, request_id, event) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		table,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare insert audit event query: %w", err)
+	}
+
+	return &AuditLog{insertStmt}, nil
+}
+
+func (l *AuditLog) Write(ctx context.Context, event *audit.Event) error {
+	payload, err := json.MarshalContext(ctx, event)
+	if err != nil {
+		return fmt.Errorf("unable to serialize the event: %w", err)
+	}
+
+	_, err = l.insertStmt.ExecContext(
+		ctx,
+		event.Time.UTC(),
+		event.Type,
+		event.Uuid,
+		event.Actor,
+		event.Ip,
+		event.RequestId,
+		payload,
+	)
+	if err != nil {
+		return fmt.Errorf("unable to insert an audit event into mysql: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,20 @@
+package mysql
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "profilecerts",
+	Subsystem: "mysql",
+	Name:      "query_duration_seconds",
+	Help:      "Duration of MySQL queries, partitioned by the query and its result: found, not_found or error",
+	Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+}, []string{"query", "result"})
+
+func observeQuery(query string, start time.Time, result string) {
+	queryDuration.WithLabelValues(query, result).Observe(time.Since(start).Seconds())
+}
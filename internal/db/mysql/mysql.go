@@ -5,15 +5,19 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/XSAM/otelsql"
 	"github.com/go-sql-driver/mysql"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/spf13/viper"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 type MySQL struct {
-	db               *sql.DB
-	findUuidByIdStmt *sql.Stmt
+	db                    *sql.DB
+	findAccountByIdStmt   *sql.Stmt
+	findAccountByUuidStmt *sql.Stmt
 }
 
 func New(protocol string, host string, port uint, dbName string, user string, password string) (*MySQL, error) {
@@ -26,23 +30,32 @@ func New(protocol string, host string, port uint, dbName string, user string, pa
 		AllowNativePasswords: true,
 		Collation:            "utf8mb4_unicode_ci",
 	}
-	db, err := sql.Open("mysql", c.FormatDSN())
+	db, err := otelsql.Open("mysql", c.FormatDSN(), otelsql.WithAttributes(semconv.DBSystemMySQL))
 	if err != nil {
 		return nil, err
 	}
 
-	findUuidByIdStmt, err := db.Prepare(`
-		SELECT uuid
+	findAccountByIdStmt, err := db.Prepare(`
+		SELECT uuid, status
 		  FROM accounts
 		 WHERE id = ?
-		   AND status = 10
 		 LIMIT 1
 	 `)
 	if err != nil {
-		return nil, fmt.Errorf("unable to prepare find account's uuid by id query: %w", err)
+		return nil, fmt.Errorf("unable to prepare find account by id query: %w", err)
 	}
 
-	return &MySQL{db, findUuidByIdStmt}, nil
+	findAccountByUuidStmt, err := db.Prepare(`
+		SELECT uuid, status
+		  FROM accounts
+		 WHERE uuid = ?
+		 LIMIT 1
+	 `)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare find account by uuid query: %w", err)
+	}
+
+	return &MySQL{db, findAccountByIdStmt, findAccountByUuidStmt}, nil
 }
 
 func NewWithConfig(config *viper.Viper) (*MySQL, error) {
@@ -62,16 +75,46 @@ func NewWithConfig(config *viper.Viper) (*MySQL, error) {
 	)
 }
 
-func (m *MySQL) FindUuidById(ctx context.Context, id int) (string, error) {
+// Returns an empty uuid when there is no account with the provided id
+func (m *MySQL) FindAccountById(ctx context.Context, id int) (string, int, error) {
 	var uuid string
-	err := m.findUuidByIdStmt.QueryRowContext(ctx, id).Scan(&uuid)
+	var status int
+	start := time.Now()
+	err := m.findAccountByIdStmt.QueryRowContext(ctx, id).Scan(&uuid, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		observeQuery("find_account_by_id", start, "not_found")
+
+		return "", 0, nil
+	} else if err != nil {
+		observeQuery("find_account_by_id", start, "error")
+
+		return "", 0, fmt.Errorf("unable to query an account from mysql: %w", err)
+	}
+
+	observeQuery("find_account_by_id", start, "found")
+
+	return uuid, status, nil
+}
+
+// Returns an empty uuid when there is no account with the provided uuid
+func (m *MySQL) FindAccountByUuid(ctx context.Context, uuid string) (string, int, error) {
+	var foundUuid string
+	var status int
+	start := time.Now()
+	err := m.findAccountByUuidStmt.QueryRowContext(ctx, uuid).Scan(&foundUuid, &status)
 	if errors.Is(err, sql.ErrNoRows) {
-		return "", nil
+		observeQuery("find_account_by_uuid", start, "not_found")
+
+		return "", 0, nil
 	} else if err != nil {
-		return "", fmt.Errorf("unable to query an uuid from mysql: %w", err)
+		observeQuery("find_account_by_uuid", start, "error")
+
+		return "", 0, fmt.Errorf("unable to query an account from mysql: %w", err)
 	}
 
-	return uuid, nil
+	observeQuery("find_account_by_uuid", start, "found")
+
+	return foundUuid, status, nil
 }
 
 func (m *MySQL) Ping(ctx context.Context) error {
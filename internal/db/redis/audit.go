@@ -0,0 +1,42 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/goccy/go-json"
+	goredis "github.com/redis/go-redis/v9"
+
+	"ely.by/profilecerts/internal/services/audit"
+)
+
+// Appends audit events to a Redis stream. Each entry has the event type and the whole event as JSON
+type AuditStream struct {
+	client *goredis.Client
+	stream string
+	// The stream is approximately trimmed to this length, 0 disables trimming
+	maxLen int64
+}
+
+func NewAuditStream(r *Redis, stream string, maxLen int64) *AuditStream {
+	return &AuditStream{r.client, stream, maxLen}
+}
+
+func (s *AuditStream) Write(ctx context.Context, event *audit.Event) error {
+	payload, err := json.MarshalContext(ctx, event)
+	if err != nil {
+		return fmt.Errorf("unable to serialize the event: %w", err)
+	}
+
+	err = s.client.XAdd(ctx, &goredis.XAddArgs{
+		Stream: s.stream,
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: []any{"type", event.Type, "event", payload},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("unable to add the event to Redis stream: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"ely.by/profilecerts/internal/services/audit"
+)
+
+func TestAuditStream(t *testing.T) {
+	r, server := newTestRedis(t)
+	stream := NewAuditStream(r, "profilecerts:audit", 0)
+
+	err := stream.Write(context.Background(), &audit.Event{Type: audit.EventCertificateRevoked, Uuid: "a2a65ee9-a8a6-4bd4-98ab-3c2d11bb1cbb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := server.Stream("profilecerts:audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("expected a single entry, got %d", len(entries))
+	}
+
+	values := entries[0].Values
+	if len(values) != 4 || values[0] != "type" || values[1] != string(audit.EventCertificateRevoked) || values[2] != "event" {
+		t.Fatalf("expected the type and the event fields, got %v", values)
+	}
+
+	if !strings.Contains(values[3], `"uuid":"a2a65ee9-a8a6-4bd4-98ab-3c2d11bb1cbb"`) {
+		t.Fatalf("expected the event to be serialized, got %s", values[3])
+	}
+}
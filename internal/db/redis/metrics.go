@@ -0,0 +1,37 @@
+package redis
+
+import (
+	"errors"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var operationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "profilecerts",
+	Subsystem: "redis",
+	Name:      "operation_duration_seconds",
+	Help:      "Duration of Redis operations, partitioned by the operation and whether it has succeeded",
+	Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+}, []string{"operation", "result"})
+
+func observeOperation(operation string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	operationDuration.WithLabelValues(operation, result).Observe(time.Since(start).Seconds())
+}
+
+// A missing key isn't a failure of the operation
+func ignoreNil(err error) error {
+	if errors.Is(err, goredis.Nil) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,47 @@
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func operationCount(t *testing.T, operation string, result string) uint64 {
+	t.Helper()
+
+	var metric dto.Metric
+	err := operationDuration.WithLabelValues(operation, result).(prometheus.Metric).Write(&metric)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestOperationMetrics(t *testing.T) {
+	r, server := newTestRedis(t)
+
+	// A missing key isn't a failure
+	successes := operationCount(t, "get_private_key", "success")
+	_, _, err := r.GetPrivateKeyForUuid(context.Background(), "a2a65ee9-a8a6-4bd4-98ab-3c2d11bb1cbb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := operationCount(t, "get_private_key", "success") - successes; actual != 1 {
+		t.Fatalf("expected the successful operation to be observed, got %d", actual)
+	}
+
+	server.SetError("connection refused")
+	failures := operationCount(t, "get_private_key", "error")
+	_, _, err = r.GetPrivateKeyForUuid(context.Background(), "a2a65ee9-a8a6-4bd4-98ab-3c2d11bb1cbb")
+	if err == nil {
+		t.Fatal("expected the Redis error")
+	}
+
+	if actual := operationCount(t, "get_private_key", "error") - failures; actual != 1 {
+		t.Fatalf("expected the failed operation to be observed, got %d", actual)
+	}
+}
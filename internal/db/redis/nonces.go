@@ -0,0 +1,20 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+func (s *Redis) RememberNonce(ctx context.Context, serviceId string, nonce string, ttl time.Duration) (bool, error) {
+	r := s.client.SetNX(ctx, serviceNonceKey(serviceId, nonce), 1, ttl)
+	if r.Err() != nil {
+		return false, fmt.Errorf("unable to store data to Redis: %w", r.Err())
+	}
+
+	return r.Val(), nil
+}
+
+func serviceNonceKey(serviceId string, nonce string) string {
+	return fmt.Sprintf("profilecerts:service-nonces:%s:%s", serviceId, nonce)
+}
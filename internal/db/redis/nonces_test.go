@@ -0,0 +1,32 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRememberNonce(t *testing.T) {
+	r, server := newTestRedis(t)
+
+	expectRemembered := func(serviceId string, nonce string, expected bool) {
+		t.Helper()
+
+		isNew, err := r.RememberNonce(context.Background(), serviceId, nonce, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if isNew != expected {
+			t.Fatalf("expected the %s nonce of %s to be new: %t, got %t", nonce, serviceId, expected, isNew)
+		}
+	}
+
+	expectRemembered("accounts", "nonce-1", true)
+	expectRemembered("accounts", "nonce-1", false)
+	expectRemembered("accounts", "nonce-2", true)
+	expectRemembered("skins", "nonce-1", true)
+
+	server.FastForward(time.Minute)
+	expectRemembered("accounts", "nonce-1", true)
+}
@@ -0,0 +1,82 @@
+package redis
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/goccy/go-json"
+	goredis "github.com/redis/go-redis/v9"
+
+	"ely.by/profilecerts/internal/services/authreader"
+)
+
+const publicKeysKey = "profilecerts:accounts-public-keys"
+
+type storedPublicKey struct {
+	Kid  string `json:"kid,omitempty"`
+	Alg  string `json:"alg,omitempty"`
+	Pkix []byte `json:"pkix"`
+}
+
+type storedPublicKeys struct {
+	FetchedAt int64             `json:"fetchedAt"`
+	Keys      []storedPublicKey `json:"keys"`
+}
+
+func (s *Redis) StorePublicKeys(ctx context.Context, keys []*authreader.PublicKey, fetchedAt time.Time) error {
+	value := storedPublicKeys{
+		FetchedAt: fetchedAt.UnixNano(),
+		Keys:      make([]storedPublicKey, len(keys)),
+	}
+	for i, key := range keys {
+		pkix, err := x509.MarshalPKIXPublicKey(key.Key)
+		if err != nil {
+			return fmt.Errorf("unable to serialize public key: %w", err)
+		}
+
+		value.Keys[i] = storedPublicKey{key.Kid, key.Alg, pkix}
+	}
+
+	dataToStore, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("unable to serialize data: %w", err)
+	}
+
+	r := s.client.Set(ctx, publicKeysKey, dataToStore, 0)
+	if r.Err() != nil {
+		return fmt.Errorf("unable to store data to Redis: %w", r.Err())
+	}
+
+	return nil
+}
+
+func (s *Redis) LoadPublicKeys(ctx context.Context) ([]*authreader.PublicKey, time.Time, error) {
+	r := s.client.Get(ctx, publicKeysKey)
+	if errors.Is(r.Err(), goredis.Nil) {
+		return nil, time.Time{}, nil
+	} else if r.Err() != nil {
+		return nil, time.Time{}, fmt.Errorf("unable to retrieve data from Redis: %w", r.Err())
+	}
+
+	bytes, _ := r.Bytes()
+	var value storedPublicKeys
+	err := json.Unmarshal(bytes, &value)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("got corrupted public keys from Redis: %w", err)
+	}
+
+	keys := make([]*authreader.PublicKey, len(value.Keys))
+	for i, key := range value.Keys {
+		publicKey, err := x509.ParsePKIXPublicKey(key.Pkix)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("the stored public key could not be parsed: %w", err)
+		}
+
+		keys[i] = &authreader.PublicKey{Kid: key.Kid, Alg: key.Alg, Key: publicKey}
+	}
+
+	return keys, time.Unix(0, value.FetchedAt), nil
+}
@@ -0,0 +1,50 @@
+package redis
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"ely.by/profilecerts/internal/services/authreader"
+)
+
+func TestPublicKeys(t *testing.T) {
+	r, server := newTestRedis(t)
+
+	keys, fetchedAt, err := r.LoadPublicKeys(context.Background())
+	if err != nil || keys != nil || !fetchedAt.IsZero() {
+		t.Fatalf("expected no keys before the first store, got %v %s %v", keys, fetchedAt, err)
+	}
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storedAt := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	err = r.StorePublicKeys(context.Background(), []*authreader.PublicKey{{Kid: "a", Alg: "ES256", Key: &privateKey.PublicKey}}, storedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, fetchedAt, err = r.LoadPublicKeys(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !fetchedAt.Equal(storedAt) {
+		t.Fatalf("expected the keys fetched at %s, got %s", storedAt, fetchedAt)
+	}
+
+	if len(keys) != 1 || keys[0].Kid != "a" || keys[0].Alg != "ES256" || !privateKey.PublicKey.Equal(keys[0].Key) {
+		t.Fatalf("expected the stored key, got %+v", keys)
+	}
+
+	_ = server.Set(publicKeysKey, "corrupted")
+	if _, _, err := r.LoadPublicKeys(context.Background()); err == nil {
+		t.Fatal("expected an error for the corrupted value")
+	}
+}
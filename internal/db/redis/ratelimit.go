@@ -0,0 +1,61 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// GCRA, an equivalent of the token bucket that stores a single timestamp per key: the theoretical arrival time
+// of the next request. The bucket refills by one token every interval and holds up to burst tokens.
+// The server's time is used, so limits are consistent across instances with skewed clocks.
+// Returns 0 when the token has been taken or the number of milliseconds to wait otherwise.
+// With peek the bucket is only checked and not changed
+var takeRateLimitTokenScript = goredis.NewScript(`
+local now = redis.call("TIME")
+now = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local peek = ARGV[3] == "1"
+
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if tat == nil or tat < now then
+	tat = now
+end
+
+local newTat = tat + interval
+local allowAt = newTat - interval * burst
+if allowAt > now then
+	return allowAt - now
+end
+
+if not peek then
+	redis.call("SET", KEYS[1], newTat, "PX", newTat - now)
+end
+
+return 0
+`)
+
+// Takes a token from the bucket under the key and returns how long to wait before the next token is available
+// when the bucket is empty. With peek the token isn't taken, only the bucket is checked
+func (s *Redis) TakeRateLimitToken(ctx context.Context, key string, interval time.Duration, burst int, peek bool) (time.Duration, error) {
+	peekArg := "0"
+	if peek {
+		peekArg = "1"
+	}
+
+	start := time.Now()
+	wait, err := takeRateLimitTokenScript.Run(ctx, s.client, []string{rateLimitKey(key)}, interval.Milliseconds(), burst, peekArg).Int64()
+	observeOperation("take_rate_limit_token", start, err)
+	if err != nil {
+		return 0, fmt.Errorf("unable to take a rate limit token in Redis: %w", err)
+	}
+
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
+func rateLimitKey(key string) string {
+	return fmt.Sprintf("profilecerts:rate-limits:%s", key)
+}
@@ -0,0 +1,87 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTakeRateLimitToken(t *testing.T) {
+	r, server := newTestRedis(t)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	server.SetTime(now)
+
+	take := func(key string, peek bool) time.Duration {
+		t.Helper()
+
+		wait, err := r.TakeRateLimitToken(context.Background(), key, time.Second, 3, peek)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return wait
+	}
+
+	// The full bucket allows the burst
+	for i := 0; i < 3; i++ {
+		if wait := take("ip:192.0.2.1", false); wait != 0 {
+			t.Fatalf("expected the request %d of the burst to be allowed, got %s to wait", i+1, wait)
+		}
+	}
+
+	if wait := take("ip:192.0.2.1", false); wait != time.Second {
+		t.Fatalf("expected to wait for a single interval, got %s", wait)
+	}
+
+	// Rejected requests don't take tokens, so the wait only shrinks with time
+	server.SetTime(now.Add(400 * time.Millisecond))
+	if wait := take("ip:192.0.2.1", false); wait != 600*time.Millisecond {
+		t.Fatalf("expected to wait for the rest of the interval, got %s", wait)
+	}
+
+	// The bucket refills by a token per interval
+	server.SetTime(now.Add(time.Second))
+	if wait := take("ip:192.0.2.1", false); wait != 0 {
+		t.Fatalf("expected the refilled token to be taken, got %s to wait", wait)
+	}
+
+	if wait := take("ip:192.0.2.1", false); wait != time.Second {
+		t.Fatalf("expected a single token to be refilled, got %s to wait", wait)
+	}
+
+	// Buckets are independent
+	if wait := take("ip:192.0.2.2", false); wait != 0 {
+		t.Fatalf("expected another key to have its own bucket, got %s to wait", wait)
+	}
+
+	// The key expires when the bucket is full again, so idle clients don't occupy memory
+	if ttl := server.TTL("profilecerts:rate-limits:ip:192.0.2.1"); ttl != 3*time.Second {
+		t.Fatalf("expected the key to expire when the bucket is refilled, got %s", ttl)
+	}
+}
+
+func TestTakeRateLimitTokenPeek(t *testing.T) {
+	r, server := newTestRedis(t)
+	server.SetTime(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+
+	for i := 0; i < 5; i++ {
+		wait, err := r.TakeRateLimitToken(context.Background(), "failed-auth:ip:192.0.2.1", time.Minute, 1, true)
+		if err != nil || wait != 0 {
+			t.Fatalf("expected the peek not to take the token, got %s %v", wait, err)
+		}
+	}
+
+	if server.Exists("profilecerts:rate-limits:failed-auth:ip:192.0.2.1") {
+		t.Fatal("expected the peek not to change the bucket")
+	}
+
+	_, err := r.TakeRateLimitToken(context.Background(), "failed-auth:ip:192.0.2.1", time.Minute, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wait, err := r.TakeRateLimitToken(context.Background(), "failed-auth:ip:192.0.2.1", time.Minute, 1, true)
+	if err != nil || wait != time.Minute {
+		t.Fatalf("expected the peek to report the empty bucket, got %s %v", wait, err)
+	}
+}
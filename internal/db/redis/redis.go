@@ -6,10 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	goredis "github.com/redis/go-redis/v9"
 	"github.com/spf13/viper"
+
+	"ely.by/profilecerts/internal/services/certmanager"
 )
 
 type Redis struct {
@@ -21,6 +25,8 @@ func New(addr string, serializer PrivateKeySerializer) *Redis {
 	rdb := goredis.NewClient(&goredis.Options{
 		Addr: addr,
 	})
+	// The error is returned only for invalid options, which are hardcoded here
+	_ = redisotel.InstrumentTracing(rdb, redisotel.WithDBStatement(false))
 
 	return &Redis{rdb, serializer}
 }
@@ -33,7 +39,9 @@ func NewWithConfig(config *viper.Viper) *Redis {
 }
 
 func (s *Redis) GetPrivateKeyForUuid(ctx context.Context, uuid string) (*rsa.PrivateKey, time.Time, error) {
+	start := time.Now()
 	r := s.client.Get(ctx, redisKey(uuid))
+	observeOperation("get_private_key", start, ignoreNil(r.Err()))
 	if errors.Is(r.Err(), goredis.Nil) {
 		return nil, time.Time{}, nil
 	} else if r.Err() != nil {
@@ -48,7 +56,8 @@ func (s *Redis) GetPrivateKeyForUuid(ctx context.Context, uuid string) (*rsa.Pri
 			"got corrupted data from Redis key that stores private key for user",
 			slog.Any("err", err),
 			slog.String("uuid", uuid),
-			slog.Any("raw_bytes", bytes),
+			// The raw value isn't logged, because it contains the private key
+			slog.Int("length", len(bytes)),
 		)
 
 		return nil, time.Time{}, nil
@@ -63,7 +72,9 @@ func (s *Redis) StorePrivateKeyForUuid(ctx context.Context, uuid string, key *rs
 		return fmt.Errorf("unable to serialize data: %w", err)
 	}
 
+	start := time.Now()
 	r := s.client.Set(ctx, redisKey(uuid), dataToStore, expireAt.Sub(time.Now()))
+	observeOperation("store_private_key", start, r.Err())
 	if r.Err() != nil {
 		return fmt.Errorf("unable to store data to Redis: %w", r.Err())
 	}
@@ -71,6 +82,66 @@ func (s *Redis) StorePrivateKeyForUuid(ctx context.Context, uuid string, key *rs
 	return nil
 }
 
+// Returns false when there was no key to delete
+func (s *Redis) DeletePrivateKeyForUuid(ctx context.Context, uuid string) (bool, error) {
+	start := time.Now()
+	r := s.client.Del(ctx, redisKey(uuid))
+	observeOperation("delete_private_key", start, r.Err())
+	if r.Err() != nil {
+		return false, fmt.Errorf("unable to delete data from Redis: %w", r.Err())
+	}
+
+	return r.Val() > 0, nil
+}
+
+// Iterates over stored keys. Like the SCAN command, it may return fewer or more items than requested
+// and the same key may be returned more than once. The iteration is over when the returned cursor is 0
+func (s *Redis) ScanPublicKeys(ctx context.Context, cursor uint64, count int64) ([]*certmanager.StoredPublicKey, uint64, error) {
+	start := time.Now()
+	keys, nextCursor, err := s.client.Scan(ctx, cursor, redisKey("*"), count).Result()
+	observeOperation("scan_private_keys", start, err)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to scan keys in Redis: %w", err)
+	}
+
+	if len(keys) == 0 {
+		return nil, nextCursor, nil
+	}
+
+	start = time.Now()
+	values, err := s.client.MGet(ctx, keys...).Result()
+	observeOperation("get_public_keys", start, err)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to retrieve data from Redis: %w", err)
+	}
+
+	result := make([]*certmanager.StoredPublicKey, 0, len(keys))
+	for i, value := range values {
+		// The key might have expired between the scan and the retrieval
+		str, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		uuid := strings.TrimPrefix(keys[i], redisKey(""))
+		publicKey, expiresAt, err := s.serializer.DeserializePublicKey([]byte(str))
+		if err != nil {
+			slog.WarnContext(
+				ctx,
+				"got corrupted data from Redis key that stores private key for user",
+				slog.Any("err", err),
+				slog.String("uuid", uuid),
+			)
+
+			continue
+		}
+
+		result = append(result, &certmanager.StoredPublicKey{Uuid: uuid, Key: publicKey, ExpiresAt: expiresAt})
+	}
+
+	return result, nextCursor, nil
+}
+
 func (s *Redis) Ping(ctx context.Context) error {
 	return s.client.Ping(ctx).Err()
 }
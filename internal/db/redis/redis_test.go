@@ -0,0 +1,105 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPemPrivateKeySerializer(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serializer := &PemPrivateKeySerializer{}
+	expiresAt := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	value, err := serializer.Serialize(key, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateKey, actualExpiresAt, err := serializer.Deserialize(value)
+	if err != nil || !privateKey.Equal(key) || !actualExpiresAt.Equal(expiresAt) {
+		t.Fatalf("expected the serialized key, got %s %v", actualExpiresAt, err)
+	}
+
+	publicKey, actualExpiresAt, err := serializer.DeserializePublicKey(value)
+	if err != nil || !publicKey.Equal(&key.PublicKey) || !actualExpiresAt.Equal(expiresAt) {
+		t.Fatalf("expected the public part of the serialized key, got %s %v", actualExpiresAt, err)
+	}
+
+	for _, corrupted := range [][]byte{value[:unixNanoTimestampLen], append([]byte("not a timestamp...."), value[unixNanoTimestampLen:]...), value[:unixNanoTimestampLen+10]} {
+		if _, _, err := serializer.DeserializePublicKey(corrupted); err == nil {
+			t.Errorf("expected an error for the corrupted value %q", corrupted)
+		}
+	}
+}
+
+func TestScanPublicKeys(t *testing.T) {
+	r, server := newTestRedis(t)
+
+	keys := make(map[string]*rsa.PrivateKey)
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	for _, uuid := range []string{
+		"a2a65ee9-a8a6-4bd4-98ab-3c2d11bb1cbb",
+		"0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d",
+		"c9f6a1d4-1f7e-4c1a-9a57-1d7a0c3f5b2e",
+	} {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keys[uuid] = key
+		err = r.StorePrivateKeyForUuid(context.Background(), uuid, key, expiresAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_ = server.Set(redisKey("corrupted"), "value")
+	_ = server.Set("profilecerts:another-key", "value")
+
+	var uuids []string
+	cursor := uint64(0)
+	for {
+		stored, nextCursor, err := r.ScanPublicKeys(context.Background(), cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, key := range stored {
+			if !key.Key.Equal(&keys[key.Uuid].PublicKey) || !key.ExpiresAt.Equal(expiresAt) {
+				t.Fatalf("expected the stored public key of %s", key.Uuid)
+			}
+
+			uuids = append(uuids, key.Uuid)
+		}
+
+		cursor = nextCursor
+		if cursor == 0 {
+			break
+		}
+	}
+
+	sort.Strings(uuids)
+	if len(uuids) != 3 || uuids[0] != "0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d" || uuids[2] != "c9f6a1d4-1f7e-4c1a-9a57-1d7a0c3f5b2e" {
+		t.Fatalf("expected the stored keys to be listed, got %v", uuids)
+	}
+}
+
+func TestDeletePrivateKeyForUuid(t *testing.T) {
+	r, server := newTestRedis(t)
+	_ = server.Set(redisKey("a2a65ee9-a8a6-4bd4-98ab-3c2d11bb1cbb"), "value")
+
+	for _, expected := range []bool{true, false} {
+		deleted, err := r.DeletePrivateKeyForUuid(context.Background(), "a2a65ee9-a8a6-4bd4-98ab-3c2d11bb1cbb")
+		if err != nil || deleted != expected {
+			t.Fatalf("expected the deleted flag to be %t, got %t %v", expected, deleted, err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Revocations are fed by an external events consumer:
+//   - profilecerts:revoked-tokens:jti:<jti> - exists when the token is revoked;
+//   - profilecerts:revoked-tokens:uuid:<uuid> - unix timestamp in seconds, before which all tokens of the account are revoked.
+//
+// Both keys should expire together with the longest-living revoked token
+func (s *Redis) FindRevocations(ctx context.Context, uuid string, tokenId string) (bool, time.Time, error) {
+	keys := []string{revokedAccountKey(uuid)}
+	if tokenId != "" {
+		keys = append(keys, revokedTokenKey(tokenId))
+	}
+
+	r := s.client.MGet(ctx, keys...)
+	if r.Err() != nil {
+		return false, time.Time{}, fmt.Errorf("unable to retrieve data from Redis: %w", r.Err())
+	}
+
+	values := r.Val()
+	tokenRevoked := len(values) > 1 && values[1] != nil
+
+	var revokedBefore time.Time
+	if value, ok := values[0].(string); ok {
+		timestamp, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("the account revocation timestamp could not be parsed: %w", err)
+		}
+
+		revokedBefore = time.Unix(timestamp, 0)
+	}
+
+	return tokenRevoked, revokedBefore, nil
+}
+
+func revokedTokenKey(tokenId string) string {
+	return fmt.Sprintf("profilecerts:revoked-tokens:jti:%s", tokenId)
+}
+
+func revokedAccountKey(uuid string) string {
+	return fmt.Sprintf("profilecerts:revoked-tokens:uuid:%s", uuid)
+}
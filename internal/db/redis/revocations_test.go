@@ -0,0 +1,43 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestRedis(t *testing.T) (*Redis, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	r := New(server.Addr(), &PemPrivateKeySerializer{})
+	t.Cleanup(func() {
+		_ = r.client.Close()
+	})
+
+	return r, server
+}
+
+func TestFindRevocations(t *testing.T) {
+	r, server := newTestRedis(t)
+	_ = server.Set("profilecerts:revoked-tokens:jti:jti-1", "1")
+	_ = server.Set("profilecerts:revoked-tokens:uuid:a2a65ee9-a8a6-4bd4-98ab-3c2d11bb1cbb", "1717243200")
+	_ = server.Set("profilecerts:revoked-tokens:uuid:0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d", "yesterday")
+
+	tokenRevoked, revokedBefore, err := r.FindRevocations(context.Background(), "a2a65ee9-a8a6-4bd4-98ab-3c2d11bb1cbb", "jti-1")
+	if err != nil || !tokenRevoked || !revokedBefore.Equal(time.Unix(1717243200, 0)) {
+		t.Fatalf("expected the token and the account revocations, got %t %s %v", tokenRevoked, revokedBefore, err)
+	}
+
+	tokenRevoked, revokedBefore, err = r.FindRevocations(context.Background(), "c9f6a1d4-1f7e-4c1a-9a57-1d7a0c3f5b2e", "")
+	if err != nil || tokenRevoked || !revokedBefore.IsZero() {
+		t.Fatalf("expected no revocations, got %t %s %v", tokenRevoked, revokedBefore, err)
+	}
+
+	_, _, err = r.FindRevocations(context.Background(), "0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d", "jti-2")
+	if err == nil {
+		t.Fatal("expected an error for the malformed timestamp")
+	}
+}
@@ -3,8 +3,10 @@ package redis
 import (
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/asn1"
 	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
 	"time"
 )
@@ -12,6 +14,8 @@ import (
 type PrivateKeySerializer interface {
 	Serialize(key *rsa.PrivateKey, expiresAt time.Time) ([]byte, error)
 	Deserialize(value []byte) (*rsa.PrivateKey, time.Time, error)
+	// Decodes only the public part of the key, which is much cheaper than the private key validation
+	DeserializePublicKey(value []byte) (*rsa.PublicKey, time.Time, error)
 }
 
 const unixNanoTimestampLen = 19 // E.g. 1718839756442011388 - 19 characters
@@ -23,24 +27,54 @@ func (s *PemPrivateKeySerializer) Serialize(key *rsa.PrivateKey, expiresAt time.
 }
 
 func (s *PemPrivateKeySerializer) Deserialize(value []byte) (*rsa.PrivateKey, time.Time, error) {
-	if len(value) < unixNanoTimestampLen+1 {
-		return nil, time.Time{}, errors.New("the value is too short")
+	keyPem, expiresAt, err := splitExpiresAt(value)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	privateKey, err := x509.ParsePKCS1PrivateKey(keyPem)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("the private key could not be parsed: %w", err)
 	}
 
-	timeBytes := value[:unixNanoTimestampLen]
-	keyPem := value[unixNanoTimestampLen:]
+	return privateKey, expiresAt, nil
+}
 
-	timePart, err := strconv.ParseInt(string(timeBytes), 10, 64)
+// The PKCS #1 private key starts with the public key's modulus and exponent, the rest of the fields are ignored
+type pkcs1PublicPart struct {
+	Version int
+	N       *big.Int
+	E       int
+}
+
+func (s *PemPrivateKeySerializer) DeserializePublicKey(value []byte) (*rsa.PublicKey, time.Time, error) {
+	keyPem, expiresAt, err := splitExpiresAt(value)
 	if err != nil {
-		return nil, time.Time{}, fmt.Errorf("the timestamp could not be parsed: %w", err)
+		return nil, time.Time{}, err
 	}
 
-	expiresAt := time.Unix(0, timePart)
+	var publicPart pkcs1PublicPart
+	_, err = asn1.Unmarshal(keyPem, &publicPart)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("the public key could not be parsed: %w", err)
+	}
 
-	privateKey, err := x509.ParsePKCS1PrivateKey(keyPem)
+	if publicPart.N == nil || publicPart.N.Sign() <= 0 || publicPart.E < 2 {
+		return nil, time.Time{}, errors.New("the public key is invalid")
+	}
+
+	return &rsa.PublicKey{N: publicPart.N, E: publicPart.E}, expiresAt, nil
+}
+
+func splitExpiresAt(value []byte) ([]byte, time.Time, error) {
+	if len(value) < unixNanoTimestampLen+1 {
+		return nil, time.Time{}, errors.New("the value is too short")
+	}
+
+	timePart, err := strconv.ParseInt(string(value[:unixNanoTimestampLen]), 10, 64)
 	if err != nil {
-		return nil, time.Time{}, fmt.Errorf("the private key could not be parsed: %w", err)
+		return nil, time.Time{}, fmt.Errorf("the timestamp could not be parsed: %w", err)
 	}
 
-	return privateKey, expiresAt, nil
+	return value[unixNanoTimestampLen:], time.Unix(0, timePart), nil
 }
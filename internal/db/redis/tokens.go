@@ -0,0 +1,31 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// A token store shared with a Yggdrasil-compatible auth server. Each key contains
+// the selected profile uuid and expires together with the access token
+type YggdrasilTokens struct {
+	client    *goredis.Client
+	keyPrefix string
+}
+
+func NewYggdrasilTokens(r *Redis, keyPrefix string) *YggdrasilTokens {
+	return &YggdrasilTokens{r.client, keyPrefix}
+}
+
+func (s *YggdrasilTokens) FindSelectedProfileByAccessToken(ctx context.Context, accessToken string) (string, error) {
+	r := s.client.Get(ctx, s.keyPrefix+accessToken)
+	if errors.Is(r.Err(), goredis.Nil) {
+		return "", nil
+	} else if r.Err() != nil {
+		return "", fmt.Errorf("unable to retrieve data from Redis: %w", r.Err())
+	}
+
+	return r.Val(), nil
+}
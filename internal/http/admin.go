@@ -0,0 +1,198 @@
+package http
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	uuidLib "github.com/google/uuid"
+
+	"ely.by/profilecerts/internal/services/audit"
+)
+
+const (
+	ScopeCertificatesRead  = "certificates:read"
+	ScopeCertificatesWrite = "certificates:write"
+)
+
+const defaultListCount = 100
+const maxListCount = 1000
+
+type CertificateInfo struct {
+	Uuid      string
+	PublicKey *rsa.PublicKey
+	ExpiresAt time.Time
+	RefreshAt time.Time
+}
+
+type CertificatesAdminService interface {
+	// Should return nil when there is no active certificate for the uuid
+	GetCertificateInfo(ctx context.Context, uuid string) (*CertificateInfo, error)
+	RotateKeypairForUser(ctx context.Context, uuid string) (*ProfileCertificate, error)
+	RevokeKeypairForUser(ctx context.Context, uuid string) error
+	ListCertificates(ctx context.Context, cursor uint64, count int64) ([]*CertificateInfo, uint64, error)
+}
+
+type AuditLog interface {
+	Record(ctx context.Context, event *audit.Event)
+}
+
+// Lets support staff inspect and manage players' certificates. Rotations and revocations
+// are audited by the service, reads are audited here
+type AdminApi struct {
+	CertificatesAdminService
+	*ServiceAuth
+	AuditLog
+	AuthCache
+}
+
+func NewAdminApi(
+	certificatesAdminService CertificatesAdminService,
+	serviceAuth *ServiceAuth,
+	auditLog AuditLog,
+	authCache AuthCache,
+) *AdminApi {
+	return &AdminApi{
+		CertificatesAdminService: certificatesAdminService,
+		ServiceAuth:              serviceAuth,
+		AuditLog:                 auditLog,
+		AuthCache:                authCache,
+	}
+}
+
+func (s *AdminApi) DefineRoutes(r gin.IRouter) {
+	read := s.ServiceAuth.Group(r, "/admin/certificates", ScopeCertificatesRead)
+	read.GET("", s.listCertificatesHandler)
+	read.GET("/:uuid", s.getCertificateHandler)
+
+	write := s.ServiceAuth.Group(r, "/admin/certificates", ScopeCertificatesWrite)
+	write.POST("/:uuid/rotate", s.rotateCertificateHandler)
+	write.DELETE("/:uuid", s.revokeCertificateHandler)
+}
+
+func (s *AdminApi) listCertificatesHandler(c *gin.Context) {
+	cursor, err := strconv.ParseUint(c.DefaultQuery("cursor", "0"), 10, 64)
+	if err != nil {
+		abortWithError(c, errInvalidCursor)
+		return
+	}
+
+	count, err := strconv.ParseInt(c.DefaultQuery("count", strconv.Itoa(defaultListCount)), 10, 64)
+	if err != nil || count <= 0 || count > maxListCount {
+		abortWithError(c, errInvalidCount)
+		return
+	}
+
+	infos, nextCursor, err := s.CertificatesAdminService.ListCertificates(c.Request.Context(), cursor, count)
+	if err != nil {
+		c.Error(fmt.Errorf("unable to list certificates: %w", err))
+		return
+	}
+
+	s.AuditLog.Record(c.Request.Context(), &audit.Event{Type: audit.EventCertificatesListed})
+
+	items := make([]gin.H, len(infos))
+	for i, info := range infos {
+		items[i] = certificateInfoJson(info)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": items,
+		// The cursor is a string, so it doesn't lose precision in JS clients
+		"nextCursor": strconv.FormatUint(nextCursor, 10),
+	})
+}
+
+func (s *AdminApi) getCertificateHandler(c *gin.Context) {
+	uuid, ok := uuidParam(c)
+	if !ok {
+		return
+	}
+
+	info, err := s.CertificatesAdminService.GetCertificateInfo(c.Request.Context(), uuid)
+	if err != nil {
+		c.Error(fmt.Errorf("unable to retrieve certificate info: %w", err))
+		return
+	}
+
+	s.AuditLog.Record(c.Request.Context(), &audit.Event{Type: audit.EventCertificateViewed, Uuid: uuid})
+
+	if info == nil {
+		abortWithError(c, errCertificateNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, certificateInfoJson(info))
+}
+
+func (s *AdminApi) rotateCertificateHandler(c *gin.Context) {
+	uuid, ok := uuidParam(c)
+	if !ok {
+		return
+	}
+
+	_, err := s.CertificatesAdminService.RotateKeypairForUser(c.Request.Context(), uuid)
+	if err != nil {
+		c.Error(fmt.Errorf("unable to rotate certificate: %w", err))
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "certificate has been rotated by admin", slog.String("uuid", uuid))
+
+	info, err := s.CertificatesAdminService.GetCertificateInfo(c.Request.Context(), uuid)
+	if err != nil {
+		c.Error(fmt.Errorf("unable to retrieve certificate info: %w", err))
+		return
+	}
+
+	if info == nil {
+		abortWithError(c, errRotatedCertificateGone)
+		return
+	}
+
+	c.JSON(http.StatusOK, certificateInfoJson(info))
+}
+
+func (s *AdminApi) revokeCertificateHandler(c *gin.Context) {
+	uuid, ok := uuidParam(c)
+	if !ok {
+		return
+	}
+
+	err := s.CertificatesAdminService.RevokeKeypairForUser(c.Request.Context(), uuid)
+	if err != nil {
+		c.Error(fmt.Errorf("unable to revoke certificate: %w", err))
+		return
+	}
+
+	// Revocations are usually caused by an account compromise or a ban, so cached tokens must be checked again
+	s.AuthCache.InvalidateUuid(uuid)
+	slog.InfoContext(c.Request.Context(), "certificate has been revoked by admin", slog.String("uuid", uuid))
+
+	c.Status(http.StatusNoContent)
+}
+
+// Keys are stored by dashed uuids, so any other form is normalized
+func uuidParam(c *gin.Context) (string, bool) {
+	uuid, err := uuidLib.Parse(c.Param("uuid"))
+	if err != nil {
+		abortWithError(c, errInvalidUuid)
+		return "", false
+	}
+
+	return uuid.String(), true
+}
+
+func certificateInfoJson(info *CertificateInfo) gin.H {
+	return gin.H{
+		"uuid":           info.Uuid,
+		"fingerprint":    audit.Fingerprint(info.PublicKey),
+		"expiresAt":      info.ExpiresAt.UTC().Format(time.RFC3339Nano),
+		"refreshedAfter": info.RefreshAt.UTC().Format(time.RFC3339Nano),
+	}
+}
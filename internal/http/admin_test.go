@@ -0,0 +1,242 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-json"
+
+	"ely.by/profilecerts/internal/services/audit"
+)
+
+type certificatesAdminServiceStub struct {
+	infos      map[string]*CertificateInfo
+	err        error
+	rotatedFor []string
+	revokedFor []string
+	listedWith []int64
+}
+
+func (s *certificatesAdminServiceStub) GetCertificateInfo(ctx context.Context, uuid string) (*CertificateInfo, error) {
+	return s.infos[uuid], s.err
+}
+
+func (s *certificatesAdminServiceStub) RotateKeypairForUser(ctx context.Context, uuid string) (*ProfileCertificate, error) {
+	s.rotatedFor = append(s.rotatedFor, uuid)
+
+	return &ProfileCertificate{}, s.err
+}
+
+func (s *certificatesAdminServiceStub) RevokeKeypairForUser(ctx context.Context, uuid string) error {
+	s.revokedFor = append(s.revokedFor, uuid)
+
+	return s.err
+}
+
+func (s *certificatesAdminServiceStub) ListCertificates(ctx context.Context, cursor uint64, count int64) ([]*CertificateInfo, uint64, error) {
+	s.listedWith = append(s.listedWith, int64(cursor), count)
+	result := make([]*CertificateInfo, 0, len(s.infos))
+	for _, info := range s.infos {
+		result = append(result, info)
+	}
+
+	return result, 42, s.err
+}
+
+type auditLogStub struct {
+	events []*audit.Event
+}
+
+func (l *auditLogStub) Record(ctx context.Context, event *audit.Event) {
+	if origin, ok := audit.OriginFromContext(ctx); ok {
+		event.Actor = origin.Actor
+	}
+
+	l.events = append(l.events, event)
+}
+
+func (l *auditLogStub) types() []string {
+	result := make([]string, len(l.events))
+	for i, event := range l.events {
+		result[i] = event.Type
+	}
+
+	return result
+}
+
+func requestAdmin(api *AdminApi, method string, path string, apiKey string) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.Use(ErrorMiddleware())
+	api.DefineRoutes(r)
+
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("X-Api-Key", apiKey)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func newAdminApiForTest(t *testing.T) (*AdminApi, *certificatesAdminServiceStub, *authCacheStub, *auditLogStub) {
+	t.Helper()
+
+	expiresAt := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+	service := &certificatesAdminServiceStub{infos: map[string]*CertificateInfo{
+		testUuid: {Uuid: testUuid, PublicKey: &getTestKey(t).PublicKey, ExpiresAt: expiresAt, RefreshAt: expiresAt.Add(-8 * time.Hour)},
+	}}
+	authCache := &authCacheStub{}
+	serviceAuth := NewServiceAuth(NewApiKeyAuthenticator([]ServiceCredential{
+		{Name: "support", Secret: "read-key", Scopes: []string{ScopeCertificatesRead}},
+		{Name: "admin", Secret: "write-key", Scopes: []string{ScopeCertificatesRead, ScopeCertificatesWrite}},
+	}))
+
+	auditLog := &auditLogStub{}
+
+	return NewAdminApi(service, serviceAuth, auditLog, authCache), service, authCache, auditLog
+}
+
+func TestAdminGetCertificate(t *testing.T) {
+	api, _, _, auditLog := newAdminApiForTest(t)
+
+	publicKeyPKIX, _ := x509.MarshalPKIXPublicKey(&getTestKey(t).PublicKey)
+	fingerprint := sha256.Sum256(publicKeyPKIX)
+
+	w := requestAdmin(api, http.MethodGet, "/admin/certificates/a2a65ee9a8a64bd498ab3c2d11bb1cbb", "read-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the 200 status, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var body map[string]string
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	expected := map[string]string{
+		"uuid":           testUuid,
+		"fingerprint":    hex.EncodeToString(fingerprint[:]),
+		"expiresAt":      "2024-06-03T12:00:00Z",
+		"refreshedAfter": "2024-06-03T04:00:00Z",
+	}
+	for key, value := range expected {
+		if body[key] != value {
+			t.Errorf("expected %s to be %q, got %q", key, value, body[key])
+		}
+	}
+
+	if len(auditLog.events) != 1 || auditLog.events[0].Type != audit.EventCertificateViewed || auditLog.events[0].Actor != "service:support" {
+		t.Fatalf("expected the view to be audited as the service's action, got %v", auditLog.types())
+	}
+
+	testCases := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{name: "unknown uuid", path: "/admin/certificates/0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d", expectedStatus: http.StatusNotFound},
+		{name: "invalid uuid", path: "/admin/certificates/not-a-uuid", expectedStatus: http.StatusBadRequest},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := requestAdmin(api, http.MethodGet, testCase.path, "read-key")
+			if w.Code != testCase.expectedStatus {
+				t.Fatalf("expected the %d status, got %d: %s", testCase.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminListCertificates(t *testing.T) {
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedListed []int64
+	}{
+		{name: "default page", expectedStatus: http.StatusOK, expectedListed: []int64{0, defaultListCount}},
+		{name: "next page", query: "?cursor=17&count=10", expectedStatus: http.StatusOK, expectedListed: []int64{17, 10}},
+		{name: "invalid cursor", query: "?cursor=-1", expectedStatus: http.StatusBadRequest},
+		{name: "too large count", query: "?count=1001", expectedStatus: http.StatusBadRequest},
+		{name: "zero count", query: "?count=0", expectedStatus: http.StatusBadRequest},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			api, service, _, auditLog := newAdminApiForTest(t)
+			w := requestAdmin(api, http.MethodGet, "/admin/certificates"+testCase.query, "read-key")
+			if w.Code != testCase.expectedStatus {
+				t.Fatalf("expected the %d status, got %d: %s", testCase.expectedStatus, w.Code, w.Body.String())
+			}
+
+			if testCase.expectedStatus != http.StatusOK {
+				if len(auditLog.events) != 0 {
+					t.Fatalf("expected the invalid request not to be audited, got %v", auditLog.types())
+				}
+
+				return
+			}
+
+			if len(auditLog.events) != 1 || auditLog.events[0].Type != audit.EventCertificatesListed {
+				t.Fatalf("expected the listing to be audited, got %v", auditLog.types())
+			}
+
+			if len(service.listedWith) != 2 || service.listedWith[0] != testCase.expectedListed[0] || service.listedWith[1] != testCase.expectedListed[1] {
+				t.Fatalf("expected the listing with %v, got %v", testCase.expectedListed, service.listedWith)
+			}
+
+			var body struct {
+				Items      []map[string]string `json:"items"`
+				NextCursor string              `json:"nextCursor"`
+			}
+			_ = json.Unmarshal(w.Body.Bytes(), &body)
+			if len(body.Items) != 1 || body.Items[0]["uuid"] != testUuid || body.NextCursor != "42" {
+				t.Fatalf("unexpected response: %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminRevokeCertificate(t *testing.T) {
+	api, service, authCache, _ := newAdminApiForTest(t)
+
+	w := requestAdmin(api, http.MethodDelete, "/admin/certificates/"+testUuid, "read-key")
+	if w.Code != http.StatusForbidden || len(service.revokedFor) != 0 {
+		t.Fatalf("expected the revocation to require the write scope, got %d", w.Code)
+	}
+
+	w = requestAdmin(api, http.MethodDelete, "/admin/certificates/"+testUuid, "write-key")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected the 204 status, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if len(service.revokedFor) != 1 || service.revokedFor[0] != testUuid {
+		t.Fatalf("expected the certificate of %s to be revoked, got %v", testUuid, service.revokedFor)
+	}
+
+	if len(authCache.invalidatedFor) != 1 || authCache.invalidatedFor[0] != testUuid {
+		t.Fatalf("expected cached tokens of %s to be invalidated, got %v", testUuid, authCache.invalidatedFor)
+	}
+
+	service.err = errors.New("redis is down")
+	w = requestAdmin(api, http.MethodDelete, "/admin/certificates/"+testUuid, "write-key")
+	if w.Code != http.StatusInternalServerError || len(authCache.invalidatedFor) != 1 {
+		t.Fatalf("expected the failed revocation not to invalidate the cache, got %d", w.Code)
+	}
+}
+
+func TestAdminRotateCertificate(t *testing.T) {
+	api, service, _, _ := newAdminApiForTest(t)
+
+	w := requestAdmin(api, http.MethodPost, "/admin/certificates/"+testUuid+"/rotate", "write-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the 200 status, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if len(service.rotatedFor) != 1 || service.rotatedFor[0] != testUuid {
+		t.Fatalf("expected the certificate of %s to be rotated, got %v", testUuid, service.rotatedFor)
+	}
+}
@@ -0,0 +1,170 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ely.by/profilecerts/internal/services/admission"
+	"ely.by/profilecerts/internal/services/authreader"
+)
+
+// Values of the "error" field, named after the exceptions returned by Mojang's API
+const (
+	errorTypeUnauthorized       = "UnauthorizedOperationException"
+	errorTypeForbidden          = "ForbiddenOperationException"
+	errorTypeIllegalArgument    = "IllegalArgumentException"
+	errorTypeNotFound           = "NotFoundException"
+	errorTypeTooManyRequests    = "TooManyRequestsException"
+	errorTypeServiceUnavailable = "ServiceUnavailableException"
+	errorTypeTimeout            = "TimeoutException"
+	errorTypeCancelled          = "RequestCancelledException"
+	errorTypeInternal           = "InternalServerError"
+)
+
+// The nginx's status for requests that the client has abandoned. It's seen in logs and metrics only
+const statusClientClosedRequest = 499
+
+// How long clients are asked to wait before retrying when a dependency is unavailable
+const unavailableRetryAfter = 5 * time.Second
+
+// An error that is returned to the client as a Mojang-style body. All of them are listed in the README
+type apiError struct {
+	status    int
+	errorType string
+	message   string
+	// Sets the Retry-After header when positive
+	retryAfter time.Duration
+	// The cause. It's reported, but never exposed to the client
+	err error
+}
+
+func (e *apiError) Error() string {
+	if e.err != nil {
+		return e.message + " " + e.err.Error()
+	}
+
+	return e.message
+}
+
+func (e *apiError) Unwrap() error {
+	return e.err
+}
+
+// Returns a copy of the error with the cause attached
+func (e *apiError) wrap(err error) *apiError {
+	wrapped := *e
+	wrapped.err = err
+
+	return &wrapped
+}
+
+// Returns a copy of the error with another Retry-After value
+func (e *apiError) withRetryAfter(retryAfter time.Duration) *apiError {
+	copied := *e
+	copied.retryAfter = retryAfter
+
+	return &copied
+}
+
+var (
+	errMissingToken = &apiError{status: http.StatusUnauthorized, errorType: errorTypeUnauthorized, message: "The access token is missing."}
+	errInvalidToken = &apiError{status: http.StatusUnauthorized, errorType: errorTypeUnauthorized, message: "The access token is invalid."}
+	errExpiredToken = &apiError{status: http.StatusUnauthorized, errorType: errorTypeUnauthorized, message: "The access token has expired."}
+	errRevokedToken = &apiError{status: http.StatusUnauthorized, errorType: errorTypeUnauthorized, message: "The access token has been revoked."}
+
+	errAccountDeleted     = &apiError{status: http.StatusUnauthorized, errorType: errorTypeUnauthorized, message: "The account has been deleted."}
+	errAccountBanned      = &apiError{status: http.StatusForbidden, errorType: errorTypeForbidden, message: "The account has been banned."}
+	errAccountUnconfirmed = &apiError{status: http.StatusForbidden, errorType: errorTypeForbidden, message: "The account's email address has not been confirmed."}
+	errAccountInactive    = &apiError{status: http.StatusForbidden, errorType: errorTypeForbidden, message: "The account is not active."}
+
+	errServiceUnauthorized = &apiError{status: http.StatusUnauthorized, errorType: errorTypeUnauthorized, message: "Service credentials are missing or invalid."}
+	errServiceForbidden    = &apiError{status: http.StatusForbidden, errorType: errorTypeForbidden, message: "The service isn't allowed to perform the action."}
+
+	errInvalidUuid            = &apiError{status: http.StatusBadRequest, errorType: errorTypeIllegalArgument, message: "Invalid uuid."}
+	errInvalidCursor          = &apiError{status: http.StatusBadRequest, errorType: errorTypeIllegalArgument, message: "Invalid cursor."}
+	errInvalidCount           = &apiError{status: http.StatusBadRequest, errorType: errorTypeIllegalArgument, message: "Count must be between 1 and " + strconv.Itoa(maxListCount) + "."}
+	errCertificateNotFound    = &apiError{status: http.StatusNotFound, errorType: errorTypeNotFound, message: "The player has no active certificate."}
+	errRotatedCertificateGone = &apiError{status: http.StatusNotFound, errorType: errorTypeNotFound, message: "The rotated certificate has already expired."}
+
+	// Retry-After is set from the limiter's response
+	errTooManyRequests = &apiError{status: http.StatusTooManyRequests, errorType: errorTypeTooManyRequests, message: "Too many requests, try again later."}
+
+	errAuthUnavailable        = &apiError{status: http.StatusServiceUnavailable, errorType: errorTypeServiceUnavailable, message: "The authentication service is temporarily unavailable.", retryAfter: unavailableRetryAfter}
+	errStorageUnavailable     = &apiError{status: http.StatusServiceUnavailable, errorType: errorTypeServiceUnavailable, message: "The certificates storage is temporarily unavailable.", retryAfter: unavailableRetryAfter}
+	errRateLimiterUnavailable = &apiError{status: http.StatusServiceUnavailable, errorType: errorTypeServiceUnavailable, message: "The rate limiter is temporarily unavailable.", retryAfter: unavailableRetryAfter}
+	// Retry-After is set from the expected queue drain time
+	errOverloaded = &apiError{status: http.StatusServiceUnavailable, errorType: errorTypeServiceUnavailable, message: "The service is overloaded, try again later."}
+
+	errRequestTimeout   = &apiError{status: http.StatusGatewayTimeout, errorType: errorTypeTimeout, message: "The request has timed out."}
+	errRequestCancelled = &apiError{status: statusClientClosedRequest, errorType: errorTypeCancelled, message: "The request has been cancelled."}
+	errInternal         = &apiError{status: http.StatusInternalServerError, errorType: errorTypeInternal, message: "An unexpected error has occurred."}
+)
+
+// Picks the error for a token that has been rejected by the auth reader
+func unauthorizedError(err error) *apiError {
+	switch authreader.UnauthorizedReason(err) {
+	case authreader.ReasonExpired:
+		return errExpiredToken
+	case authreader.ReasonRevoked:
+		return errRevokedToken
+	default:
+		return errInvalidToken
+	}
+}
+
+// Cancellations and timeouts take precedence, since a dependency that has been interrupted isn't unavailable.
+// Failures of the keys storage are temporary, and any other error is exposed as an internal one
+func asApiError(err error) *apiError {
+	if errors.Is(err, context.Canceled) {
+		return errRequestCancelled
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errRequestTimeout
+	}
+
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	if errors.Is(err, ErrKeysStorage) {
+		return errStorageUnavailable
+	}
+
+	if overloadedErr, ok := admission.AsOverloadedError(err); ok {
+		return errOverloaded.withRetryAfter(overloadedErr.RetryAfter)
+	}
+
+	return errInternal
+}
+
+// Shed requests are expected under the load, so they are rejected without being reported as errors
+func abortIfOverloaded(c *gin.Context, err error) bool {
+	if _, ok := admission.AsOverloadedError(err); !ok {
+		return false
+	}
+
+	abortWithError(c, asApiError(err))
+
+	return true
+}
+
+// Writes an error body in the same format as Mojang's API does
+func abortWithError(c *gin.Context, err *apiError) {
+	if err.retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(err.retryAfter.Seconds()))))
+	}
+
+	c.AbortWithStatusJSON(err.status, gin.H{
+		"path":         c.Request.URL.Path,
+		"error":        err.errorType,
+		"errorMessage": err.message,
+	})
+}
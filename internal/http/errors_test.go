@@ -0,0 +1,213 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-json"
+
+	"ely.by/profilecerts/internal/services/admission"
+)
+
+type errorResponse struct {
+	Path         string `json:"path"`
+	Error        string `json:"error"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+type expectedError struct {
+	status     int
+	errorType  string
+	message    string
+	retryAfter string
+}
+
+// Serves a single request to a handler mounted behind the ErrorMiddleware, as the server does
+func serveWithErrorMiddleware(handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.Use(ErrorMiddleware())
+	r.POST("/certificates", handler)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/certificates", nil))
+
+	return w
+}
+
+func assertErrorResponse(t *testing.T, w *httptest.ResponseRecorder, expected expectedError) {
+	t.Helper()
+
+	if w.Code != expected.status {
+		t.Errorf("expected the %d status, got %d", expected.status, w.Code)
+	}
+
+	if actual := w.Header().Get("Retry-After"); actual != expected.retryAfter {
+		t.Errorf("expected the %q Retry-After header, got %q", expected.retryAfter, actual)
+	}
+
+	var body errorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &body)
+	if err != nil {
+		t.Fatalf("unable to parse the body %s: %v", w.Body.String(), err)
+	}
+
+	if body.Path != "/certificates" {
+		t.Errorf("expected the /certificates path, got %s", body.Path)
+	}
+
+	if body.Error != expected.errorType {
+		t.Errorf("expected the %s error, got %s", expected.errorType, body.Error)
+	}
+
+	if body.ErrorMessage != expected.message {
+		t.Errorf("expected the %q error message, got %q", expected.message, body.ErrorMessage)
+	}
+}
+
+// The values are the ones documented in the README
+func TestApiErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      *apiError
+		expected expectedError
+	}{
+		{"errMissingToken", errMissingToken, expectedError{401, "UnauthorizedOperationException", "The access token is missing.", ""}},
+		{"errInvalidToken", errInvalidToken, expectedError{401, "UnauthorizedOperationException", "The access token is invalid.", ""}},
+		{"errExpiredToken", errExpiredToken, expectedError{401, "UnauthorizedOperationException", "The access token has expired.", ""}},
+		{"errRevokedToken", errRevokedToken, expectedError{401, "UnauthorizedOperationException", "The access token has been revoked.", ""}},
+		{"errAccountDeleted", errAccountDeleted, expectedError{401, "UnauthorizedOperationException", "The account has been deleted.", ""}},
+		{"errAccountBanned", errAccountBanned, expectedError{403, "ForbiddenOperationException", "The account has been banned.", ""}},
+		{"errAccountUnconfirmed", errAccountUnconfirmed, expectedError{403, "ForbiddenOperationException", "The account's email address has not been confirmed.", ""}},
+		{"errAccountInactive", errAccountInactive, expectedError{403, "ForbiddenOperationException", "The account is not active.", ""}},
+		{"errServiceUnauthorized", errServiceUnauthorized, expectedError{401, "UnauthorizedOperationException", "Service credentials are missing or invalid.", ""}},
+		{"errServiceForbidden", errServiceForbidden, expectedError{403, "ForbiddenOperationException", "The service isn't allowed to perform the action.", ""}},
+		{"errInvalidUuid", errInvalidUuid, expectedError{400, "IllegalArgumentException", "Invalid uuid.", ""}},
+		{"errInvalidCursor", errInvalidCursor, expectedError{400, "IllegalArgumentException", "Invalid cursor.", ""}},
+		{"errInvalidCount", errInvalidCount, expectedError{400, "IllegalArgumentException", "Count must be between 1 and 1000.", ""}},
+		{"errCertificateNotFound", errCertificateNotFound, expectedError{404, "NotFoundException", "The player has no active certificate.", ""}},
+		{"errRotatedCertificateGone", errRotatedCertificateGone, expectedError{404, "NotFoundException", "The rotated certificate has already expired.", ""}},
+		{"errTooManyRequests", errTooManyRequests.withRetryAfter(1500 * time.Millisecond), expectedError{429, "TooManyRequestsException", "Too many requests, try again later.", "2"}},
+		{"errAuthUnavailable", errAuthUnavailable, expectedError{503, "ServiceUnavailableException", "The authentication service is temporarily unavailable.", "5"}},
+		{"errStorageUnavailable", errStorageUnavailable, expectedError{503, "ServiceUnavailableException", "The certificates storage is temporarily unavailable.", "5"}},
+		{"errRateLimiterUnavailable", errRateLimiterUnavailable, expectedError{503, "ServiceUnavailableException", "The rate limiter is temporarily unavailable.", "5"}},
+		{"errOverloaded", errOverloaded.withRetryAfter(3 * time.Second), expectedError{503, "ServiceUnavailableException", "The service is overloaded, try again later.", "3"}},
+		{"errStorageUnavailable with Retry-After", errStorageUnavailable.withRetryAfter(1500 * time.Millisecond), expectedError{503, "ServiceUnavailableException", "The certificates storage is temporarily unavailable.", "2"}},
+		{"errRequestTimeout", errRequestTimeout, expectedError{504, "TimeoutException", "The request has timed out.", ""}},
+		{"errRequestCancelled", errRequestCancelled, expectedError{499, "RequestCancelledException", "The request has been cancelled.", ""}},
+		{"errInternal", errInternal, expectedError{500, "InternalServerError", "An unexpected error has occurred.", ""}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name+" aborted", func(t *testing.T) {
+			w := serveWithErrorMiddleware(func(c *gin.Context) {
+				abortWithError(c, testCase.err)
+			})
+			assertErrorResponse(t, w, testCase.expected)
+		})
+
+		t.Run(testCase.name+" wrapped and added to the context", func(t *testing.T) {
+			cause := errors.New("the secret cause")
+			w := serveWithErrorMiddleware(func(c *gin.Context) {
+				_ = c.Error(fmt.Errorf("unable to do something: %w", testCase.err.wrap(cause)))
+			})
+			assertErrorResponse(t, w, testCase.expected)
+
+			if strings.Contains(w.Body.String(), cause.Error()) {
+				t.Errorf("the cause must not be exposed, got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestErrorMiddlewareFallsBackToInternalError(t *testing.T) {
+	w := serveWithErrorMiddleware(func(c *gin.Context) {
+		_ = c.Error(errors.New("unable to connect to 10.0.0.1"))
+	})
+	assertErrorResponse(t, w, expectedError{500, "InternalServerError", "An unexpected error has occurred.", ""})
+
+	if strings.Contains(w.Body.String(), "10.0.0.1") {
+		t.Errorf("the error must not be exposed, got %s", w.Body.String())
+	}
+}
+
+func TestAsApiError(t *testing.T) {
+	storageErr := fmt.Errorf("unable to store the key: %w: %w", ErrKeysStorage, errors.New("redis is down"))
+	testCases := []struct {
+		name     string
+		err      error
+		expected *apiError
+	}{
+		{"api error", fmt.Errorf("wrapped: %w", errAccountBanned), errAccountBanned},
+		{"storage failure", storageErr, errStorageUnavailable},
+		{"cancelled storage call", fmt.Errorf("unable to store the key: %w: %w", ErrKeysStorage, context.Canceled), errRequestCancelled},
+		{"timed out auth", errAuthUnavailable.wrap(context.DeadlineExceeded), errRequestTimeout},
+		{"unknown error", errors.New("unable to generate a key"), errInternal},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if actual := asApiError(testCase.err); actual != testCase.expected {
+				t.Fatalf("expected %q, got %q", testCase.expected.message, actual.message)
+			}
+		})
+	}
+}
+
+func TestErrorMiddlewareKeepsWrittenResponse(t *testing.T) {
+	w := serveWithErrorMiddleware(func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+		_ = c.Error(errors.New("a failure after the response"))
+	})
+
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Errorf("expected the written response to be kept, got %d %s", w.Code, w.Body.String())
+	}
+}
+func TestAbortIfOverloaded(t *testing.T) {
+	t.Run("overloaded", func(t *testing.T) {
+		var aborted bool
+		w := serveWithErrorMiddleware(func(c *gin.Context) {
+			err := fmt.Errorf("unable to sign: %w", &admission.OverloadedError{
+				Limiter:    "signing",
+				Reason:     admission.ReasonQueueFull,
+				RetryAfter: 2500 * time.Millisecond,
+			})
+			aborted = abortIfOverloaded(c, err)
+		})
+
+		if !aborted {
+			t.Fatal("expected the request to be aborted")
+		}
+
+		assertErrorResponse(t, w, expectedError{503, "ServiceUnavailableException", "The service is overloaded, try again later.", "3"})
+	})
+
+	t.Run("other error", func(t *testing.T) {
+		var aborted bool
+		w := serveWithErrorMiddleware(func(c *gin.Context) {
+			aborted = abortIfOverloaded(c, errors.New("the key is broken"))
+			c.Status(http.StatusNoContent)
+		})
+
+		if aborted {
+			t.Fatal("expected the request not to be aborted")
+		}
+
+		if w.Code != http.StatusNoContent {
+			t.Errorf("expected the handler's status, got %d", w.Code)
+		}
+	})
+
+	t.Run("nil error", func(t *testing.T) {
+		serveWithErrorMiddleware(func(c *gin.Context) {
+			if abortIfOverloaded(c, nil) {
+				t.Error("expected the request not to be aborted")
+			}
+		})
+	})
+}
@@ -2,48 +2,171 @@ package http
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
+// Servers with such an address prefix listen on a unix socket
+const unixSocketPrefix = "unix:"
+
 func NewServerWithConfig(config *viper.Viper, handler http.Handler) (*http.Server, error) {
 	config.SetDefault("http.host", "0.0.0.0")
 	config.SetDefault("http.port", 8080)
+	config.SetDefault("http.write_timeout", 5*time.Second)
+
+	addr := fmt.Sprintf("%s:%d", config.GetString("http.host"), config.GetUint("http.port"))
+
+	return newServerWithConfig(config, "http", addr, handler)
+}
+
+// The ops server hosts health, readiness, metrics, pprof and admin routes, so it listens on the loopback interface
+// unless the ops.host says otherwise. When the ops.socket is specified, the server listens on the unix socket instead
+func NewOpsServerWithConfig(config *viper.Viper, handler http.Handler) (*http.Server, error) {
+	config.SetDefault("ops.host", "127.0.0.1")
+	config.SetDefault("ops.port", 8081)
+	// pprof profiles take 30 seconds by default
+	config.SetDefault("ops.write_timeout", 60*time.Second)
+
+	addr := fmt.Sprintf("%s:%d", config.GetString("ops.host"), config.GetUint("ops.port"))
+	if socket := config.GetString("ops.socket"); socket != "" {
+		addr = unixSocketPrefix + socket
+	}
+
+	return newServerWithConfig(config, "ops", addr, handler)
+}
+
+// Applies timeouts, limits, TLS and h2c params under the prefix
+func newServerWithConfig(config *viper.Viper, prefix string, addr string, handler http.Handler) (*http.Server, error) {
+	config.SetDefault(prefix+".read_timeout", 5*time.Second)
+	config.SetDefault(prefix+".read_header_timeout", 5*time.Second)
+	config.SetDefault(prefix+".idle_timeout", 60*time.Second)
+	config.SetDefault(prefix+".max_header_bytes", http.DefaultMaxHeaderBytes)
+	config.SetDefault(prefix+".max_body_size", 1<<20)
+	config.SetDefault(prefix+".h2c", false)
+
+	tlsConfig, err := newTlsConfigWithConfig(config, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxBodySize := config.GetInt64(prefix + ".max_body_size"); maxBodySize > 0 {
+		handler = http.MaxBytesHandler(handler, maxBodySize)
+	}
+
+	// HTTP/2 over TLS is negotiated natively, h2c is meant for internal traffic behind a proxy or a mesh
+	if config.GetBool(prefix + ".h2c") {
+		if tlsConfig != nil {
+			return nil, fmt.Errorf("%s.h2c can't be enabled together with TLS", prefix)
+		}
+
+		handler = h2c.NewHandler(handler, &http2.Server{
+			IdleTimeout: config.GetDuration(prefix + ".idle_timeout"),
+		})
+	}
 
 	return &http.Server{
-		Addr:         fmt.Sprintf("%s:%d", config.GetString("http.host"), config.GetUint("http.port")),
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 5 * time.Second,
-		IdleTimeout:  60 * time.Second,
-		Handler:      handler,
+		Addr:              addr,
+		ReadTimeout:       config.GetDuration(prefix + ".read_timeout"),
+		ReadHeaderTimeout: config.GetDuration(prefix + ".read_header_timeout"),
+		WriteTimeout:      config.GetDuration(prefix + ".write_timeout"),
+		IdleTimeout:       config.GetDuration(prefix + ".idle_timeout"),
+		MaxHeaderBytes:    config.GetInt(prefix + ".max_header_bytes"),
+		TLSConfig:         tlsConfig,
+		Handler:           handler,
 	}, nil
 }
 
-func StartServer(ctx context.Context, server *http.Server) error {
-	srvErr := make(chan error, 1)
-	go func() {
-		slog.Debug("Starting the server", slog.String("addr", server.Addr))
-		srvErr <- server.ListenAndServe()
-		close(srvErr)
-	}()
+// Gin trusts X-Forwarded-For from any peer by default, which lets clients spoof their address.
+// Only proxies from the list are trusted to set the remote IP headers, the peer's address is used otherwise.
+// The trusted platform header is used regardless of the peer
+func ConfigureClientIpWithConfig(config *viper.Viper, engine *gin.Engine) error {
+	config.SetDefault("http.remote_ip_headers", []string{"X-Forwarded-For", "X-Real-IP"})
+
+	engine.RemoteIPHeaders = config.GetStringSlice("http.remote_ip_headers")
+	engine.TrustedPlatform = config.GetString("http.trusted_platform")
+
+	var trustedProxies []string
+	if proxies := config.GetStringSlice("http.trusted_proxies"); len(proxies) > 0 {
+		trustedProxies = proxies
+	}
+
+	err := engine.SetTrustedProxies(trustedProxies)
+	if err != nil {
+		return fmt.Errorf("invalid http.trusted_proxies: %w", err)
+	}
 
+	return nil
+}
+
+// Starts all servers and shuts them down together when the ctx is done or any of them fails
+func StartServer(ctx context.Context, servers ...*http.Server) error {
+	srvErr := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			slog.Debug("Starting the server", slog.String("addr", server.Addr))
+			err := listenAndServe(server)
+			if !errors.Is(err, http.ErrServerClosed) {
+				srvErr <- fmt.Errorf("%s: %w", server.Addr, err)
+			}
+		}(server)
+	}
+
+	var err error
 	select {
-	case err := <-srvErr:
-		return err
+	case err = <-srvErr:
+		slog.Error("One of the servers has failed, shutting down the rest", slog.Any("err", err))
 	case <-ctx.Done():
 		slog.Info("Got stop signal, starting graceful shutdown")
+	}
 
-		stopCtx, cancelFunc := context.WithTimeout(context.Background(), 3*time.Second)
-		defer cancelFunc()
+	stopCtx, cancelFunc := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancelFunc()
 
+	for _, server := range servers {
 		_ = server.Shutdown(stopCtx)
+	}
+
+	slog.Debug("Graceful shutdown succeed, exiting")
+
+	return err
+}
 
-		slog.Debug("Graceful shutdown succeed, exiting")
+func listenAndServe(server *http.Server) error {
+	listener, err := listen(server.Addr)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	// The certificate is provided by the TLSConfig, so the files aren't passed
+	if server.TLSConfig != nil {
+		return server.ServeTLS(listener, "", "")
+	}
+
+	return server.Serve(listener)
+}
+
+func listen(addr string) (net.Listener, error) {
+	socket, isUnix := strings.CutPrefix(addr, unixSocketPrefix)
+	if !isUnix {
+		return net.Listen("tcp", addr)
+	}
+
+	// The socket file remains after an unclean exit and prevents listening on it again
+	err := os.Remove(socket)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("unable to remove stale socket: %w", err)
+	}
+
+	return net.Listen("unix", socket)
 }
@@ -0,0 +1,285 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"golang.org/x/net/http2"
+)
+
+func TestNewOpsServerWithConfig(t *testing.T) {
+	server, err := NewOpsServerWithConfig(viper.New(), http.NotFoundHandler())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pprof and admin routes must not be reachable from the outside by default
+	if server.Addr != "127.0.0.1:8081" {
+		t.Fatalf("expected the loopback address by default, got %s", server.Addr)
+	}
+
+	config := viper.New()
+	config.Set("ops.socket", "/run/profilecerts/ops.sock")
+	server, err = NewOpsServerWithConfig(config, http.NotFoundHandler())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server.Addr != "unix:/run/profilecerts/ops.sock" {
+		t.Fatalf("expected the socket address, got %s", server.Addr)
+	}
+}
+
+func TestNewServerWithConfig(t *testing.T) {
+	config := viper.New()
+	config.Set("http.port", 9090)
+	config.Set("http.read_timeout", "2s")
+	config.Set("http.idle_timeout", "30s")
+	config.Set("http.max_header_bytes", 4096)
+	server, err := NewServerWithConfig(config, http.NotFoundHandler())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server.Addr != "0.0.0.0:9090" {
+		t.Fatalf("unexpected address %s", server.Addr)
+	}
+
+	if server.ReadTimeout != 2*time.Second || server.IdleTimeout != 30*time.Second || server.WriteTimeout != 5*time.Second {
+		t.Fatalf("unexpected timeouts: read %s, idle %s, write %s", server.ReadTimeout, server.IdleTimeout, server.WriteTimeout)
+	}
+
+	if server.MaxHeaderBytes != 4096 {
+		t.Fatalf("unexpected max header bytes %d", server.MaxHeaderBytes)
+	}
+
+	if server.TLSConfig != nil {
+		t.Fatal("expected no TLS by default")
+	}
+
+	config.Set("http.h2c", true)
+	config.Set("http.tls.cert_file", "tls.crt")
+	config.Set("http.tls.key_file", "tls.key")
+	_, err = NewServerWithConfig(config, http.NotFoundHandler())
+	if err == nil {
+		t.Fatal("expected an error for the invalid TLS config")
+	}
+}
+
+func TestNewServerWithConfigMaxBodySize(t *testing.T) {
+	config := viper.New()
+	config.Set("http.max_body_size", 8)
+	server, err := NewServerWithConfig(config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for body, expectedStatus := range map[string]int{"12345678": http.StatusOK, "123456789": http.StatusRequestEntityTooLarge} {
+		w := httptest.NewRecorder()
+		server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		if w.Code != expectedStatus {
+			t.Fatalf("expected %d for %d bytes, got %d", expectedStatus, len(body), w.Code)
+		}
+	}
+}
+
+func TestNewServerWithConfigH2c(t *testing.T) {
+	config := viper.New()
+	config.Set("http.h2c", true)
+	server, err := NewServerWithConfig(config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Close()
+
+	// Prior knowledge HTTP/2 without TLS, the same way a proxy or a mesh talks to the service
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+
+	resp, err := client.Get("http://" + listener.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(body) != "HTTP/2.0" {
+		t.Fatalf("expected the request to be served over HTTP/2, got %s", body)
+	}
+
+	dir := t.TempDir()
+	issueTestCertificate(t, nil, 1, "localhost").writeFiles(t, filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), time.Now())
+	config.Set("http.tls.cert_file", filepath.Join(dir, "tls.crt"))
+	config.Set("http.tls.key_file", filepath.Join(dir, "tls.key"))
+	_, err = NewServerWithConfig(config, http.NotFoundHandler())
+	if err == nil {
+		t.Fatal("expected h2c to be rejected together with TLS")
+	}
+}
+
+func TestStartServerOnUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "ops.sock")
+	server := &http.Server{
+		Addr: unixSocketPrefix + socket,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("ok"))
+		}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- StartServer(ctx, server)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+
+	var resp *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		resp, err = client.Get("http://ops/")
+		if err == nil {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err != nil {
+		t.Fatalf("unable to reach the server on the socket: %v", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(body) != "ok" {
+		t.Fatalf("unexpected response: %s", body)
+	}
+
+	cancel()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatalf("expected the graceful shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server hasn't stopped")
+	}
+}
+
+func TestStartServerStopsAllOnFailure(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	healthy := &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+	// The address is already taken, so the server fails right away
+	failing := &http.Server{Addr: listener.Addr().String(), Handler: http.NotFoundHandler()}
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- StartServer(context.Background(), healthy, failing)
+	}()
+
+	select {
+	case err := <-stopped:
+		if err == nil {
+			t.Fatal("expected the failure to be returned")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the failure of one server hasn't stopped the rest")
+	}
+}
+
+func TestConfigureClientIpWithConfig(t *testing.T) {
+	resolveClientIp := func(config *viper.Viper, remoteAddr string) string {
+		t.Helper()
+
+		r := gin.New()
+		err := ConfigureClientIpWithConfig(config, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.GET("/", func(c *gin.Context) {
+			c.String(http.StatusOK, c.ClientIP())
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "198.51.100.1")
+		req.Header.Set("X-Client-Ip", "198.51.100.2")
+		req.Header.Set("CF-Connecting-IP", "198.51.100.3")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w.Body.String()
+	}
+
+	// Nothing is trusted by default
+	if ip := resolveClientIp(viper.New(), "10.0.0.1:1234"); ip != "10.0.0.1" {
+		t.Fatalf("expected the peer's address, got %s", ip)
+	}
+
+	config := viper.New()
+	config.Set("http.trusted_proxies", "10.0.0.0/8 192.0.2.1")
+	if ip := resolveClientIp(config, "10.0.0.1:1234"); ip != "198.51.100.1" {
+		t.Fatalf("expected the forwarded address, got %s", ip)
+	}
+
+	if ip := resolveClientIp(config, "192.0.2.2:1234"); ip != "192.0.2.2" {
+		t.Fatalf("expected the untrusted peer's address, got %s", ip)
+	}
+
+	config.Set("http.remote_ip_headers", "X-Client-Ip")
+	if ip := resolveClientIp(config, "10.0.0.1:1234"); ip != "198.51.100.2" {
+		t.Fatalf("expected the address from the configured header, got %s", ip)
+	}
+
+	// The platform's header is trusted regardless of the peer
+	config = viper.New()
+	config.Set("http.trusted_platform", "CF-Connecting-IP")
+	if ip := resolveClientIp(config, "192.0.2.2:1234"); ip != "198.51.100.3" {
+		t.Fatalf("expected the platform's address, got %s", ip)
+	}
+
+	config.Set("http.trusted_proxies", "10.0.0.0/33")
+	if err := ConfigureClientIpWithConfig(config, gin.New()); err == nil {
+		t.Fatal("expected an error for the invalid network")
+	}
+}
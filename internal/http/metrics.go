@@ -0,0 +1,51 @@
+package http
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var accountStatusRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "profilecerts",
+	Subsystem: "http",
+	Name:      "account_status_rejections_total",
+	Help:      "The number of certificate requests rejected because of the account status",
+}, []string{"status"})
+
+var certificateRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "profilecerts",
+	Subsystem: "http",
+	Name:      "certificate_request_duration_seconds",
+	Help:      "Duration of certificate requests, partitioned by the response status",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"status"})
+
+var certificateStageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "profilecerts",
+	Subsystem: "http",
+	Name:      "certificate_stage_duration_seconds",
+	Help:      "Duration of each stage of certificate requests: auth, keypair, sign_v1 and sign_v2",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"stage"})
+
+var rateLimitedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "profilecerts",
+	Subsystem: "http",
+	Name:      "rate_limited_requests_total",
+	Help:      "The number of certificate requests rejected by the rate limiter, partitioned by the exceeded limit: ip, uuid or failed_auth",
+}, []string{"limit"})
+
+// Errors are turned into the response by the ErrorMiddleware after the handler returns,
+// so their status is resolved the same way here
+func observeCertificateRequest(c *gin.Context, start time.Time) {
+	status := c.Writer.Status()
+	if len(c.Errors) > 0 && !c.Writer.Written() {
+		status = asApiError(c.Errors.Last().Err).status
+	}
+
+	certificateRequestDuration.WithLabelValues(strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+}
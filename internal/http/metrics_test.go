@@ -0,0 +1,70 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func histogramSampleCount(t *testing.T, histogram *prometheus.HistogramVec, labels ...string) uint64 {
+	t.Helper()
+
+	var metric dto.Metric
+	err := histogram.WithLabelValues(labels...).(prometheus.Metric).Write(&metric)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestCertificateRequestMetrics(t *testing.T) {
+	key := getTestKey(t)
+	stages := []string{"auth", "keypair", "sign_v1", "sign_v2"}
+	expectObserved := func(status string, stagesCount int, request func()) {
+		t.Helper()
+
+		statusBefore := histogramSampleCount(t, certificateRequestDuration, status)
+		stagesBefore := make([]uint64, len(stages))
+		for i, stage := range stages {
+			stagesBefore[i] = histogramSampleCount(t, certificateStageDuration, stage)
+		}
+
+		request()
+
+		if actual := histogramSampleCount(t, certificateRequestDuration, status) - statusBefore; actual != 1 {
+			t.Errorf("expected a request with the %s status to be observed, got %d", status, actual)
+		}
+
+		for i, stage := range stages {
+			expected := uint64(0)
+			if i < stagesCount {
+				expected = 1
+			}
+
+			if actual := histogramSampleCount(t, certificateStageDuration, stage) - stagesBefore[i]; actual != expected {
+				t.Errorf("expected the %s stage to be observed %d times, got %d", stage, expected, actual)
+			}
+		}
+	}
+
+	expectObserved("200", 4, func() {
+		api := NewProfileCertificatesApi(&certificatesServiceStub{key: key}, authenticatedAs(testUuid, nil), &authCacheStub{}, &signerStub{key}, nil)
+		requestCertificate(api, "Bearer token")
+	})
+
+	expectObserved("401", 0, func() {
+		api := NewProfileCertificatesApi(&certificatesServiceStub{key: key}, authenticatedAs(testUuid, nil), &authCacheStub{}, &signerStub{key}, nil)
+		requestCertificate(api, "")
+	})
+
+	// The status of failed requests is written by the error middleware after the handler returns
+	expectObserved("503", 2, func() {
+		getErr := fmt.Errorf("%w: %w", ErrKeysStorage, errors.New("redis is down"))
+		api := NewProfileCertificatesApi(&certificatesServiceStub{key: key, getErr: getErr}, authenticatedAs(testUuid, nil), &authCacheStub{}, &signerStub{key}, nil)
+		requestCertificate(api, "Bearer token")
+	})
+}
@@ -1,16 +1,129 @@
 package http
 
 import (
+	"log/slog"
 	"net/http"
+	"regexp"
+	"slices"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	uuidLib "github.com/google/uuid"
+
+	"ely.by/profilecerts/internal/logging"
 )
 
+const RequestIdHeader = "X-Request-Id"
+
+// The gin context key that holds the request id
+const RequestIdKey = "request_id"
+
+// Limits ids passed by clients, so they can't inject anything into logs
+var validRequestId = regexp.MustCompile(`^[\w\-.:]{1,128}$`)
+
+// Turns the last error added with c.Error into the response, unless the handler has already written one
 func ErrorMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Next()
+		if len(c.Errors) > 0 && !c.Writer.Written() {
+			abortWithError(c, asApiError(c.Errors.Last().Err))
+		}
+	}
+}
+
+// Reports errors added with c.Error and panics. The panics are propagated further,
+// so it must be mounted after the middleware that recovers from them
+func ErrorReportingMiddleware(reporter logging.ErrorReporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+
+		ctx, finish := reporter.StartRequest(c.Request.Context(), c.Request, route)
+		c.Request = c.Request.WithContext(logging.WithErrorReporter(ctx, reporter))
+
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				annotateErrorReport(c, reporter)
+				reporter.CapturePanic(c.Request.Context(), recovered)
+				finish(http.StatusInternalServerError)
+
+				panic(recovered)
+			}
+		}()
+
+		c.Next()
+
+		annotateErrorReport(c, reporter)
+		for _, err := range c.Errors {
+			reporter.CaptureError(c.Request.Context(), err.Err)
+		}
+
+		finish(c.Writer.Status())
+	}
+}
+
+func annotateErrorReport(c *gin.Context, reporter logging.ErrorReporter) {
+	if uuid := c.GetString(PlayerUuidKey); uuid != "" {
+		reporter.SetUser(c.Request.Context(), uuid)
+	}
+
+	if authReader := c.GetString(AuthReaderKey); authReader != "" {
+		reporter.SetTag(c.Request.Context(), "authreader", authReader)
+	}
+}
+
+// Takes the request id from the X-Request-Id header or generates a new one, returns it to the client
+// and stores it in the request context, so it's attached to the logs written with the *Context functions
+func RequestIdMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader(RequestIdHeader)
+		if !validRequestId.MatchString(requestId) {
+			requestId = uuidLib.NewString()
+		}
+
+		c.Set(RequestIdKey, requestId)
+		c.Header(RequestIdHeader, requestId)
+		c.Request = c.Request.WithContext(logging.WithRequestId(c.Request.Context(), requestId))
+
+		c.Next()
+	}
+}
+
+// Replaces gin's text logger. Successful requests to the quietPaths, like probes and metrics scraping,
+// are logged at the debug level
+func AccessLogMiddleware(quietPaths ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		} else if status < 400 && slices.Contains(quietPaths, c.Request.URL.Path) {
+			level = slog.LevelDebug
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Duration("duration", time.Since(start)),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_agent", c.Request.UserAgent()),
+		}
+		if authReader := c.GetString(AuthReaderKey); authReader != "" {
+			attrs = append(attrs, slog.String("authreader", authReader))
+		}
+
 		if len(c.Errors) > 0 {
-			c.Status(http.StatusInternalServerError)
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
 		}
+
+		slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
 	}
 }
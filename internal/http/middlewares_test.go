@@ -0,0 +1,201 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-json"
+
+	"ely.by/profilecerts/internal/logging"
+)
+
+func TestRequestIdMiddleware(t *testing.T) {
+	r := gin.New()
+	r.Use(RequestIdMiddleware())
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(RequestIdKey))
+	})
+
+	testCases := []struct {
+		name      string
+		requestId string
+		expectNew bool
+	}{
+		{name: "passed id", requestId: "5f0c1b9e-request.1:a"},
+		{name: "missing id", expectNew: true},
+		{name: "id with forbidden characters", requestId: "id\" level=ERROR", expectNew: true},
+		{name: "too long id", requestId: strings.Repeat("a", 129), expectNew: true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if testCase.requestId != "" {
+				req.Header.Set(RequestIdHeader, testCase.requestId)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			requestId := w.Header().Get(RequestIdHeader)
+			if requestId == "" || requestId != w.Body.String() {
+				t.Fatalf("expected the same id in the header and the context, got %q and %q", requestId, w.Body.String())
+			}
+
+			if testCase.expectNew == (requestId == testCase.requestId) {
+				t.Fatalf("unexpected request id %q", requestId)
+			}
+		})
+	}
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	var output bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&output, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+	})
+
+	r := gin.New()
+	r.Use(AccessLogMiddleware("/healthcheck"))
+	r.Use(ErrorMiddleware())
+	r.GET("/healthcheck", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/certificates/:uuid", func(c *gin.Context) {
+		c.Set(AuthReaderKey, "elyby")
+		c.Status(http.StatusUnauthorized)
+	})
+	r.GET("/failure", func(c *gin.Context) {
+		_ = c.Error(http.ErrHandlerTimeout)
+	})
+
+	testCases := []struct {
+		path          string
+		expectedLevel string
+		expectedAttrs map[string]any
+	}{
+		{path: "/healthcheck", expectedLevel: "DEBUG", expectedAttrs: map[string]any{"status": float64(200)}},
+		{
+			path:          "/certificates/" + testUuid,
+			expectedLevel: "INFO",
+			expectedAttrs: map[string]any{"status": float64(401), "route": "/certificates/:uuid", "authreader": "elyby"},
+		},
+		{path: "/failure", expectedLevel: "ERROR", expectedAttrs: map[string]any{"status": float64(500), "errors": "Error #01: http: Handler timeout\n"}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.path, func(t *testing.T) {
+			output.Reset()
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, testCase.path, nil))
+
+			var record map[string]any
+			err := json.Unmarshal(output.Bytes(), &record)
+			if err != nil {
+				t.Fatalf("expected a single json record, got %s", output.String())
+			}
+
+			if record["level"] != testCase.expectedLevel || record["path"] != testCase.path {
+				t.Fatalf("expected the %s record about %s, got %s", testCase.expectedLevel, testCase.path, output.String())
+			}
+
+			for key, value := range testCase.expectedAttrs {
+				if record[key] != value {
+					t.Errorf("expected %s to be %v, got %v", key, value, record[key])
+				}
+			}
+		})
+	}
+}
+
+type errorReporterStub struct {
+	logging.NopErrorReporter
+	route       string
+	status      int
+	user        string
+	tags        map[string]string
+	errors      []error
+	panics      []interface{}
+	breadcrumbs []logging.Breadcrumb
+}
+
+func (r *errorReporterStub) StartRequest(ctx context.Context, _ *http.Request, route string) (context.Context, func(int)) {
+	r.route = route
+
+	return ctx, func(status int) {
+		r.status = status
+	}
+}
+
+func (r *errorReporterStub) SetUser(_ context.Context, id string) {
+	r.user = id
+}
+
+func (r *errorReporterStub) SetTag(_ context.Context, key string, value string) {
+	r.tags[key] = value
+}
+
+func (r *errorReporterStub) AddBreadcrumb(_ context.Context, breadcrumb logging.Breadcrumb) {
+	r.breadcrumbs = append(r.breadcrumbs, breadcrumb)
+}
+
+func (r *errorReporterStub) CaptureError(_ context.Context, err error) {
+	r.errors = append(r.errors, err)
+}
+
+func (r *errorReporterStub) CapturePanic(_ context.Context, recovered interface{}) {
+	r.panics = append(r.panics, recovered)
+}
+
+func TestErrorReportingMiddleware(t *testing.T) {
+	reporter := &errorReporterStub{tags: make(map[string]string)}
+	r := gin.New()
+	r.Use(gin.CustomRecovery(func(c *gin.Context, _ any) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	r.Use(ErrorReportingMiddleware(reporter))
+	r.Use(ErrorMiddleware())
+	r.GET("/players/:uuid", func(c *gin.Context) {
+		_, endStage := startStage(c.Request.Context(), "keypair")
+		endStage(nil)
+
+		c.Set(PlayerUuidKey, testUuid)
+		c.Set(AuthReaderKey, "elyby")
+		_ = c.Error(errors.New("redis is down"))
+	})
+	r.GET("/panic", func(c *gin.Context) {
+		panic("the key is broken")
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/players/"+testUuid, nil))
+
+	if reporter.route != "/players/:uuid" || reporter.status != http.StatusInternalServerError {
+		t.Errorf("expected the request to be reported by its route with the final status, got %s %d", reporter.route, reporter.status)
+	}
+
+	if reporter.user != testUuid || reporter.tags["authreader"] != "elyby" {
+		t.Errorf("expected the report to be annotated, got %s %v", reporter.user, reporter.tags)
+	}
+
+	if len(reporter.errors) != 1 || reporter.errors[0].Error() != "redis is down" {
+		t.Errorf("expected the error to be captured, got %v", reporter.errors)
+	}
+
+	if len(reporter.breadcrumbs) != 1 || reporter.breadcrumbs[0].Message != "keypair" || reporter.breadcrumbs[0].IsError {
+		t.Errorf("expected the stage breadcrumb, got %+v", reporter.breadcrumbs)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	// The panic is propagated to the recovery middleware
+	if w.Code != http.StatusInternalServerError || len(reporter.panics) != 1 || reporter.panics[0] != "the key is broken" {
+		t.Errorf("expected the panic to be captured and recovered, got %d %v", w.Code, reporter.panics)
+	}
+}
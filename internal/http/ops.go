@@ -0,0 +1,28 @@
+package http
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Defines routes that must be available only on the ops listener
+func DefineOpsRoutes(r gin.IRouter) {
+	r.GET("/liveness", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	debug := r.Group("/debug/pprof")
+	debug.GET("/", gin.WrapF(pprof.Index))
+	debug.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	debug.GET("/profile", gin.WrapF(pprof.Profile))
+	debug.POST("/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/trace", gin.WrapF(pprof.Trace))
+	for _, profile := range []string{"allocs", "block", "goroutine", "heap", "mutex", "threadcreate"} {
+		debug.GET("/"+profile, gin.WrapH(pprof.Handler(profile)))
+	}
+}
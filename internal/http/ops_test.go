@@ -0,0 +1,24 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDefineOpsRoutes(t *testing.T) {
+	r := gin.New()
+	DefineOpsRoutes(r)
+
+	for _, path := range []string{"/liveness", "/metrics", "/debug/pprof/", "/debug/pprof/heap"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("expected %s to respond with 200, got %d", path, w.Code)
+		}
+	}
+}
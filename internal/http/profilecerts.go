@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -15,17 +16,29 @@ import (
 	uuidLib "github.com/google/uuid"
 	"github.com/muesli/reflow/wrap"
 
+	"ely.by/profilecerts/internal/services/audit"
 	"ely.by/profilecerts/internal/services/authreader"
 )
 
+// The gin context key that holds the name of the auth reader that has authenticated the request
+const AuthReaderKey = "authreader"
+
+// The gin context key that holds the uuid of the authenticated player
+const PlayerUuidKey = "playerUuid"
+
 type ProfileCertificate struct {
 	Key       *rsa.PrivateKey
 	ExpiresAt time.Time
 	RefreshAt time.Time
 }
 
+// Implementations of the ProfileCertificatesService wrap failures of the keys storage with this error,
+// so they're reported as a temporary unavailability rather than as an internal error
+var ErrKeysStorage = errors.New("keys storage failure")
+
 type ProfileCertificatesService interface {
 	GetKeypairForUser(ctx context.Context, uuid string) (*ProfileCertificate, error)
+	RevokeKeypairForUser(ctx context.Context, uuid string) error
 }
 
 // Should return non-empty string when token parsed successfully
@@ -33,6 +46,11 @@ type AuthReader interface {
 	GetUuidFromAuthorizationHeader(ctx context.Context, authHeader string) (string, error)
 }
 
+// Forgets accepted tokens of the account, so a change of its status takes effect before the cached results expire
+type AuthCache interface {
+	InvalidateUuid(uuid string)
+}
+
 type SignerService interface {
 	Sign(ctx context.Context, data []byte) ([]byte, error)
 	GetPublicKey(ctx context.Context) (*rsa.PublicKey, error)
@@ -41,18 +59,25 @@ type SignerService interface {
 type ProfilesCertificatesApi struct {
 	ProfileCertificatesService
 	AuthReader
+	AuthCache
 	SignerService
+	// Nil disables rate limiting
+	RateLimits *RateLimits
 }
 
 func NewProfileCertificatesApi(
 	profilesCertificatesService ProfileCertificatesService,
 	authReader AuthReader,
+	authCache AuthCache,
 	signerService SignerService,
+	rateLimits *RateLimits,
 ) *ProfilesCertificatesApi {
 	return &ProfilesCertificatesApi{
 		ProfileCertificatesService: profilesCertificatesService,
 		AuthReader:                 authReader,
+		AuthCache:                  authCache,
 		SignerService:              signerService,
+		RateLimits:                 rateLimits,
 	}
 }
 
@@ -64,25 +89,64 @@ func (s *ProfilesCertificatesApi) DefineRoutes(r gin.IRouter) {
 
 // See https://wiki.vg/Mojang_API#Player_Certificates
 func (s *ProfilesCertificatesApi) getCertificatesHandler(c *gin.Context) {
+	defer observeCertificateRequest(c, time.Now())
+
+	if err := s.RateLimits.checkIp(c); err != nil {
+		rejectByRateLimit(c, err)
+		return
+	}
+
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
-		c.Status(http.StatusUnauthorized)
+		abortWithError(c, errMissingToken)
 		return
 	}
 
-	uuid, err := s.AuthReader.GetUuidFromAuthorizationHeader(c.Request.Context(), authHeader)
+	authCtx, endStage := startStage(c.Request.Context(), "auth")
+	authCtx = authreader.WithReaderName(authCtx)
+	uuid, err := s.AuthReader.GetUuidFromAuthorizationHeader(authCtx, authHeader)
+	endStage(err)
+	if name := authreader.ReaderName(authCtx); name != "" {
+		c.Set(AuthReaderKey, name)
+	}
+
+	tokenDetails := authreader.RecordedTokenDetails(authCtx)
+	c.Request = c.Request.WithContext(audit.WithOrigin(c.Request.Context(), audit.Origin{
+		Actor:        audit.ActorPlayer,
+		Ip:           c.ClientIP(),
+		AuthReader:   c.GetString(AuthReaderKey),
+		TokenSubject: tokenDetails.Subject,
+		TokenId:      tokenDetails.Id,
+	}))
+
+	if uuid != "" {
+		c.Set(PlayerUuidKey, uuid)
+	}
+
 	if err != nil {
 		if authreader.IsUnauthorized(err) {
-			c.Status(http.StatusUnauthorized)
+			s.RateLimits.recordFailedAuth(c)
+			abortWithError(c, unauthorizedError(err))
+		} else if accountStatusErr, ok := authreader.AsAccountStatusError(err); ok {
+			s.rejectByAccountStatus(c, accountStatusErr)
 		} else {
-			c.Error(err)
+			c.Error(errAuthUnavailable.wrap(err))
 		}
 
 		return
 	}
 
-	profileCert, err := s.ProfileCertificatesService.GetKeypairForUser(c.Request.Context(), uuid)
-	if err != nil {
+	if err := s.RateLimits.checkUuid(c, uuid); err != nil {
+		rejectByRateLimit(c, err)
+		return
+	}
+
+	ctx, endStage := startStage(c.Request.Context(), "keypair")
+	profileCert, err := s.ProfileCertificatesService.GetKeypairForUser(ctx, uuid)
+	endStage(err)
+	if abortIfOverloaded(c, err) {
+		return
+	} else if err != nil {
 		c.Error(fmt.Errorf("unable to retrieve a private key for user: %w", err))
 		return
 	}
@@ -110,8 +174,12 @@ func (s *ProfilesCertificatesApi) getCertificatesHandler(c *gin.Context) {
 	pkV1buf = append(pkV1buf, wrap.Bytes(pkV1keyBuf, 76)...)
 	pkV1buf = append(pkV1buf, []byte("\n-----END RSA PUBLIC KEY-----\n")...)
 
-	publicKeySignature, err := s.SignerService.Sign(c.Request.Context(), pkV1buf)
-	if err != nil {
+	ctx, endStage = startStage(c.Request.Context(), "sign_v1")
+	publicKeySignature, err := s.SignerService.Sign(ctx, pkV1buf)
+	endStage(err)
+	if abortIfOverloaded(c, err) {
+		return
+	} else if err != nil {
 		c.Error(fmt.Errorf("unable to sign publicKeySignature: %w", err))
 		return
 	}
@@ -124,8 +192,12 @@ func (s *ProfilesCertificatesApi) getCertificatesHandler(c *gin.Context) {
 	pkV2buf = binary.BigEndian.AppendUint64(pkV2buf, uint64(profileCert.ExpiresAt.UnixMilli()))
 	pkV2buf = append(pkV2buf, publicKeyPKIX...)
 
-	publicKeySignatureV2, err := s.SignerService.Sign(c.Request.Context(), pkV2buf)
-	if err != nil {
+	ctx, endStage = startStage(c.Request.Context(), "sign_v2")
+	publicKeySignatureV2, err := s.SignerService.Sign(ctx, pkV2buf)
+	endStage(err)
+	if abortIfOverloaded(c, err) {
+		return
+	} else if err != nil {
 		c.Error(fmt.Errorf("unable to sign publicKeySignatureV2: %w", err))
 		return
 	}
@@ -142,6 +214,36 @@ func (s *ProfilesCertificatesApi) getCertificatesHandler(c *gin.Context) {
 	})
 }
 
+func (s *ProfilesCertificatesApi) rejectByAccountStatus(c *gin.Context, err *authreader.AccountStatusError) {
+	if err.Uuid != "" {
+		c.Set(PlayerUuidKey, err.Uuid)
+	}
+
+	accountStatusRejections.WithLabelValues(err.Status.String()).Inc()
+
+	switch err.Status {
+	case authreader.AccountStatusDeleted:
+		abortWithError(c, errAccountDeleted)
+	case authreader.AccountStatusBanned:
+		// Other tokens of the account may still be cached as accepted
+		s.AuthCache.InvalidateUuid(err.Uuid)
+
+		// The key may be already issued, so it must not be served anymore even if the ban will be lifted
+		// before the key's expiration
+		ctx := audit.WithReason(c.Request.Context(), "account_banned")
+		revokeErr := s.ProfileCertificatesService.RevokeKeypairForUser(ctx, err.Uuid)
+		if revokeErr != nil {
+			c.Error(fmt.Errorf("unable to revoke a private key for banned user: %w", revokeErr))
+		}
+
+		abortWithError(c, errAccountBanned)
+	case authreader.AccountStatusUnconfirmed:
+		abortWithError(c, errAccountUnconfirmed)
+	default:
+		abortWithError(c, errAccountInactive)
+	}
+}
+
 func (s *ProfilesCertificatesApi) getPublicKeysHandler(c *gin.Context) {
 	publicKey, err := s.SignerService.GetPublicKey(c.Request.Context())
 	if err != nil {
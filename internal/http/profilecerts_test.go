@@ -0,0 +1,325 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-json"
+
+	"ely.by/profilecerts/internal/services/admission"
+	"ely.by/profilecerts/internal/services/authreader"
+)
+
+const testUuid = "a2a65ee9-a8a6-4bd4-98ab-3c2d11bb1cbb"
+
+var (
+	testKeyOnce sync.Once
+	testKey     *rsa.PrivateKey
+)
+
+// The key generation is slow, so a single key is shared between tests
+func getTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	testKeyOnce.Do(func() {
+		var err error
+		testKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			panic(err)
+		}
+	})
+
+	return testKey
+}
+
+type authReaderFunc func(ctx context.Context, authHeader string) (string, error)
+
+func (f authReaderFunc) GetUuidFromAuthorizationHeader(ctx context.Context, authHeader string) (string, error) {
+	return f(ctx, authHeader)
+}
+
+func authenticatedAs(uuid string, err error) authReaderFunc {
+	return func(ctx context.Context, authHeader string) (string, error) {
+		return uuid, err
+	}
+}
+
+type certificatesServiceStub struct {
+	key        *rsa.PrivateKey
+	getErr     error
+	revokeErr  error
+	revokedFor []string
+}
+
+func (s *certificatesServiceStub) GetKeypairForUser(ctx context.Context, uuid string) (*ProfileCertificate, error) {
+	if s.getErr != nil {
+		return nil, s.getErr
+	}
+
+	expiresAt := time.Now().Add(48 * time.Hour)
+
+	return &ProfileCertificate{
+		Key:       s.key,
+		ExpiresAt: expiresAt,
+		RefreshAt: expiresAt.Add(-8 * time.Hour),
+	}, nil
+}
+
+func (s *certificatesServiceStub) RevokeKeypairForUser(ctx context.Context, uuid string) error {
+	s.revokedFor = append(s.revokedFor, uuid)
+
+	return s.revokeErr
+}
+
+type authCacheStub struct {
+	invalidatedFor []string
+}
+
+func (c *authCacheStub) InvalidateUuid(uuid string) {
+	c.invalidatedFor = append(c.invalidatedFor, uuid)
+}
+
+type signerStub struct {
+	key *rsa.PrivateKey
+}
+
+func (s *signerStub) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	return []byte("signature"), nil
+}
+
+func (s *signerStub) GetPublicKey(ctx context.Context) (*rsa.PublicKey, error) {
+	return &s.key.PublicKey, nil
+}
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func requestCertificate(api *ProfilesCertificatesApi, authHeader string) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.Use(ErrorMiddleware())
+	api.DefineRoutes(r)
+
+	req := httptest.NewRequest(http.MethodPost, "/certificates", nil)
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestGetCertificates(t *testing.T) {
+	key := getTestKey(t)
+	service := &certificatesServiceStub{key: key}
+	api := NewProfileCertificatesApi(service, authenticatedAs(testUuid, nil), &authCacheStub{}, &signerStub{key}, nil)
+
+	w := requestCertificate(api, "Bearer token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the 200 status, got %d %s", w.Code, w.Body.String())
+	}
+
+	var body struct {
+		KeyPair struct {
+			PrivateKey string `json:"privateKey"`
+			PublicKey  string `json:"publicKey"`
+		} `json:"keyPair"`
+		PublicKeySignature   []byte `json:"publicKeySignature"`
+		PublicKeySignatureV2 []byte `json:"publicKeySignatureV2"`
+		ExpiresAt            string `json:"expiresAt"`
+		RefreshedAfter       string `json:"refreshedAfter"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body.KeyPair.PrivateKey == "" || body.KeyPair.PublicKey == "" || len(body.PublicKeySignatureV2) == 0 {
+		t.Fatalf("expected the key pair and the signatures, got %s", w.Body.String())
+	}
+}
+
+func TestGetCertificatesAccountStatus(t *testing.T) {
+	testCases := []struct {
+		status         authreader.AccountStatus
+		expectedStatus int
+		expectedError  string
+		expectedRevoke bool
+	}{
+		{authreader.AccountStatusDeleted, http.StatusUnauthorized, "UnauthorizedOperationException", false},
+		{authreader.AccountStatusBanned, http.StatusForbidden, "ForbiddenOperationException", true},
+		{authreader.AccountStatusUnconfirmed, http.StatusForbidden, "ForbiddenOperationException", false},
+		{authreader.AccountStatus(5), http.StatusForbidden, "ForbiddenOperationException", false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.status.String(), func(t *testing.T) {
+			service := &certificatesServiceStub{}
+			cache := &authCacheStub{}
+			authErr := &authreader.AccountStatusError{Uuid: testUuid, Status: testCase.status}
+			api := NewProfileCertificatesApi(service, authenticatedAs("", authErr), cache, &signerStub{}, nil)
+
+			w := requestCertificate(api, "Bearer token")
+			if w.Code != testCase.expectedStatus {
+				t.Fatalf("expected the %d status, got %d", testCase.expectedStatus, w.Code)
+			}
+
+			var body struct {
+				Error string `json:"error"`
+			}
+			err := json.Unmarshal(w.Body.Bytes(), &body)
+			if err != nil || body.Error != testCase.expectedError {
+				t.Fatalf("expected the %s error, got %s", testCase.expectedError, w.Body.String())
+			}
+
+			if revoked := len(service.revokedFor) == 1 && service.revokedFor[0] == testUuid; revoked != testCase.expectedRevoke {
+				t.Fatalf("expected the key revocation to be %t, got %v", testCase.expectedRevoke, service.revokedFor)
+			}
+
+			// Only the ban makes other cached tokens of the account unusable
+			if invalidated := len(cache.invalidatedFor) == 1 && cache.invalidatedFor[0] == testUuid; invalidated != testCase.expectedRevoke {
+				t.Fatalf("expected the cache invalidation to be %t, got %v", testCase.expectedRevoke, cache.invalidatedFor)
+			}
+		})
+	}
+}
+
+func TestGetCertificatesBannedAccountRevocationFailure(t *testing.T) {
+	service := &certificatesServiceStub{revokeErr: errors.New("redis is down")}
+	authErr := &authreader.AccountStatusError{Uuid: testUuid, Status: authreader.AccountStatusBanned}
+	api := NewProfileCertificatesApi(service, authenticatedAs("", authErr), &authCacheStub{}, &signerStub{}, nil)
+
+	// The ban is still reported, the failure is only logged
+	w := requestCertificate(api, "Bearer token")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected the 403 status, got %d", w.Code)
+	}
+}
+
+type revokedTokensSource struct{}
+
+func (s revokedTokensSource) FindRevocations(ctx context.Context, uuid string, tokenId string) (bool, time.Time, error) {
+	return true, time.Time{}, nil
+}
+
+func TestGetCertificatesFailures(t *testing.T) {
+	revokedErr := &authreader.AccountStatusError{Uuid: testUuid, Status: authreader.AccountStatusBanned}
+	// The error of the revoked token can only be produced by the reader itself
+	revocationChecking := authreader.NewRevocationChecking(authenticatedAs(testUuid, nil), revokedTokensSource{}, false)
+	_, revokedTokenErr := revocationChecking.GetUuidFromAuthorizationHeader(context.Background(), "Bearer token")
+	testCases := []struct {
+		name       string
+		authHeader string
+		authErr    error
+		getErr     error
+		expected   expectedError
+	}{
+		{
+			name:     "missing header",
+			expected: expectedError{401, "UnauthorizedOperationException", "The access token is missing.", ""},
+		},
+		{
+			name:       "revoked token",
+			authHeader: "Bearer token",
+			authErr:    revokedTokenErr,
+			expected:   expectedError{401, "UnauthorizedOperationException", "The access token has been revoked.", ""},
+		},
+		{
+			name:       "banned account",
+			authHeader: "Bearer token",
+			authErr:    revokedErr,
+			expected:   expectedError{403, "ForbiddenOperationException", "The account has been banned.", ""},
+		},
+		{
+			name:       "accounts failure",
+			authHeader: "Bearer token",
+			authErr:    errors.New("accounts is down"),
+			expected:   expectedError{503, "ServiceUnavailableException", "The authentication service is temporarily unavailable.", "5"},
+		},
+		{
+			name:       "auth timeout",
+			authHeader: "Bearer token",
+			authErr:    fmt.Errorf("unable to introspect the token: %w", context.DeadlineExceeded),
+			expected:   expectedError{504, "TimeoutException", "The request has timed out.", ""},
+		},
+		{
+			name:       "cancelled request",
+			authHeader: "Bearer token",
+			authErr:    fmt.Errorf("unable to introspect the token: %w", context.Canceled),
+			expected:   expectedError{499, "RequestCancelledException", "The request has been cancelled.", ""},
+		},
+		{
+			name:       "storage failure",
+			authHeader: "Bearer token",
+			getErr:     fmt.Errorf("unable to retrieve the key: %w: %w", ErrKeysStorage, errors.New("redis is down")),
+			expected:   expectedError{503, "ServiceUnavailableException", "The certificates storage is temporarily unavailable.", "5"},
+		},
+		{
+			name:       "storage timeout",
+			authHeader: "Bearer token",
+			getErr:     fmt.Errorf("unable to retrieve the key: %w: %w", ErrKeysStorage, context.DeadlineExceeded),
+			expected:   expectedError{504, "TimeoutException", "The request has timed out.", ""},
+		},
+		{
+			name:       "key generation failure",
+			authHeader: "Bearer token",
+			getErr:     errors.New("unable to generate a new RSA private key"),
+			expected:   expectedError{500, "InternalServerError", "An unexpected error has occurred.", ""},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			service := &certificatesServiceStub{getErr: testCase.getErr}
+			api := NewProfileCertificatesApi(service, authenticatedAs(testUuid, testCase.authErr), &authCacheStub{}, &signerStub{}, nil)
+
+			w := requestCertificate(api, testCase.authHeader)
+			assertErrorResponse(t, w, testCase.expected)
+
+			// The banned account's certificate is revoked along with the error
+			if revoked := len(service.revokedFor) > 0; revoked != (testCase.authErr == revokedErr) {
+				t.Errorf("unexpected revocations %v", service.revokedFor)
+			}
+		})
+	}
+}
+
+type overloadedSigner struct {
+	signerStub
+}
+
+func (s *overloadedSigner) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	return nil, fmt.Errorf("unable to start signing: %w", &admission.OverloadedError{Limiter: "signing", Reason: admission.ReasonEstimatedWait, RetryAfter: 2 * time.Second})
+}
+
+func TestGetCertificatesOverloaded(t *testing.T) {
+	key := getTestKey(t)
+	api := NewProfileCertificatesApi(&certificatesServiceStub{key: key}, authenticatedAs(testUuid, nil), &authCacheStub{}, &overloadedSigner{signerStub{key}}, nil)
+
+	r := gin.New()
+	reporter := &errorReporterStub{tags: make(map[string]string)}
+	r.Use(ErrorReportingMiddleware(reporter))
+	r.Use(ErrorMiddleware())
+	api.DefineRoutes(r)
+
+	req := httptest.NewRequest(http.MethodPost, "/certificates", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assertErrorResponse(t, w, expectedError{503, "ServiceUnavailableException", "The service is overloaded, try again later.", "2"})
+
+	// Shedding is expected under the load, so it isn't reported
+	if len(reporter.errors) != 0 {
+		t.Fatalf("expected no reported errors, got %v", reporter.errors)
+	}
+}
@@ -0,0 +1,176 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+type RateLimiter interface {
+	// Should take a token from the bucket under the key and return how long to wait before the next token
+	// is available when the bucket is empty. With peek the token must not be taken
+	TakeRateLimitToken(ctx context.Context, key string, interval time.Duration, burst int, peek bool) (time.Duration, error)
+}
+
+// Allows Rate requests per Period on average with bursts up to Burst requests. Zero Rate disables the limit
+type RateLimit struct {
+	Rate   int
+	Period time.Duration
+	Burst  int
+}
+
+func (l RateLimit) enabled() bool {
+	return l.Rate > 0
+}
+
+func (l RateLimit) interval() time.Duration {
+	return l.Period / time.Duration(l.Rate)
+}
+
+type RateLimitsOptions struct {
+	Ip         RateLimit
+	Uuid       RateLimit
+	FailedAuth RateLimit
+	// Reject requests when the limiter is unavailable instead of letting them through
+	FailClosed bool
+}
+
+// Limits certificate requests per client's IP, per player's uuid and failed authentication attempts per IP.
+// The nil *RateLimits doesn't limit anything
+type RateLimits struct {
+	limiter RateLimiter
+	RateLimitsOptions
+}
+
+func NewRateLimits(limiter RateLimiter, options RateLimitsOptions) *RateLimits {
+	return &RateLimits{limiter, options}
+}
+
+func NewRateLimitsWithConfig(config *viper.Viper, limiter RateLimiter) (*RateLimits, error) {
+	config.SetDefault("ratelimit.ip.rate", 60)
+	config.SetDefault("ratelimit.ip.period", time.Minute)
+	config.SetDefault("ratelimit.ip.burst", 30)
+	config.SetDefault("ratelimit.uuid.rate", 20)
+	config.SetDefault("ratelimit.uuid.period", time.Hour)
+	config.SetDefault("ratelimit.uuid.burst", 10)
+	config.SetDefault("ratelimit.failed_auth.rate", 10)
+	config.SetDefault("ratelimit.failed_auth.period", 10*time.Minute)
+	config.SetDefault("ratelimit.failed_auth.burst", 10)
+	config.SetDefault("ratelimit.fail_mode", "open")
+
+	var options RateLimitsOptions
+	for name, limit := range map[string]*RateLimit{"ip": &options.Ip, "uuid": &options.Uuid, "failed_auth": &options.FailedAuth} {
+		*limit = RateLimit{
+			Rate:   config.GetInt("ratelimit." + name + ".rate"),
+			Period: config.GetDuration("ratelimit." + name + ".period"),
+			Burst:  config.GetInt("ratelimit." + name + ".burst"),
+		}
+		if limit.enabled() && (limit.Burst < 1 || limit.interval() < time.Millisecond) {
+			return nil, fmt.Errorf("invalid ratelimit.%s: the burst must be positive and the period must be at least 1ms per request", name)
+		}
+	}
+
+	switch mode := config.GetString("ratelimit.fail_mode"); mode {
+	case "open":
+		options.FailClosed = false
+	case "closed":
+		options.FailClosed = true
+	default:
+		return nil, fmt.Errorf("unknown rate limit fail mode %s, expected open or closed", mode)
+	}
+
+	return NewRateLimits(limiter, options), nil
+}
+
+// Should be called before the authentication. Rejects clients that have exhausted their failed attempts too
+func (l *RateLimits) checkIp(c *gin.Context) *apiError {
+	if l == nil {
+		return nil
+	}
+
+	ip := clientIpKey(c)
+	if l.FailedAuth.enabled() {
+		if err := l.take(c, "failed_auth", "failed-auth:ip:"+ip, l.FailedAuth, true); err != nil {
+			return err
+		}
+	}
+
+	if l.Ip.enabled() {
+		return l.take(c, "ip", "ip:"+ip, l.Ip, false)
+	}
+
+	return nil
+}
+
+func (l *RateLimits) checkUuid(c *gin.Context, uuid string) *apiError {
+	if l == nil || !l.Uuid.enabled() {
+		return nil
+	}
+
+	return l.take(c, "uuid", "uuid:"+uuid, l.Uuid, false)
+}
+
+// The token is taken, but the request isn't rejected: it has already failed
+func (l *RateLimits) recordFailedAuth(c *gin.Context) {
+	if l == nil || !l.FailedAuth.enabled() {
+		return
+	}
+
+	ip := clientIpKey(c)
+	_, err := l.limiter.TakeRateLimitToken(c.Request.Context(), "failed-auth:ip:"+ip, l.FailedAuth.interval(), l.FailedAuth.Burst, false)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "unable to record a failed authentication attempt", slog.Any("err", err))
+	}
+}
+
+func (l *RateLimits) take(c *gin.Context, name string, key string, limit RateLimit, peek bool) *apiError {
+	wait, err := l.limiter.TakeRateLimitToken(c.Request.Context(), key, limit.interval(), limit.Burst, peek)
+	if err != nil {
+		if l.FailClosed {
+			return errRateLimiterUnavailable.wrap(err)
+		}
+
+		slog.WarnContext(c.Request.Context(), "unable to check the rate limit, letting the request through", slog.String("limit", name), slog.Any("err", err))
+
+		return nil
+	}
+
+	if wait > 0 {
+		rateLimitedRequests.WithLabelValues(name).Inc()
+
+		return errTooManyRequests.withRetryAfter(wait)
+	}
+
+	return nil
+}
+
+// Failures of the limiter are reported, exceeded limits aren't
+func rejectByRateLimit(c *gin.Context, err *apiError) {
+	if err.err != nil {
+		c.Error(err)
+		return
+	}
+
+	abortWithError(c, err)
+}
+
+// The address is resolved by gin according to the trusted proxies, see ConfigureClientIpWithConfig.
+// IPv6 clients are limited by their /64 network, because they usually get the whole one
+func clientIpKey(c *gin.Context) string {
+	addr, err := netip.ParseAddr(c.ClientIP())
+	if err != nil {
+		return c.ClientIP()
+	}
+
+	addr = addr.Unmap()
+	if addr.Is6() {
+		return netip.PrefixFrom(addr, 64).Masked().String()
+	}
+
+	return addr.String()
+}
@@ -0,0 +1,213 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+
+	"ely.by/profilecerts/internal/services/authreader"
+)
+
+type takenToken struct {
+	key  string
+	peek bool
+}
+
+// Allows burst requests per key and doesn't refill the buckets
+type rateLimiterStub struct {
+	taken []takenToken
+	used  map[string]int
+	err   error
+}
+
+func newRateLimiterStub() *rateLimiterStub {
+	return &rateLimiterStub{used: make(map[string]int)}
+}
+
+func (l *rateLimiterStub) TakeRateLimitToken(ctx context.Context, key string, interval time.Duration, burst int, peek bool) (time.Duration, error) {
+	l.taken = append(l.taken, takenToken{key, peek})
+	if l.err != nil {
+		return 0, l.err
+	}
+
+	if l.used[key] >= burst {
+		return interval, nil
+	}
+
+	if !peek {
+		l.used[key]++
+	}
+
+	return 0, nil
+}
+
+func newRateLimitsForTest(limiter RateLimiter, failClosed bool) *RateLimits {
+	return NewRateLimits(limiter, RateLimitsOptions{
+		Ip:         RateLimit{Rate: 60, Period: time.Minute, Burst: 3},
+		Uuid:       RateLimit{Rate: 1, Period: 1500 * time.Millisecond, Burst: 1},
+		FailedAuth: RateLimit{Rate: 1, Period: time.Minute, Burst: 1},
+		FailClosed: failClosed,
+	})
+}
+
+// Serves the certificates route of the engine that resolves client addresses as the server does
+func requestCertificateFrom(t *testing.T, api *ProfilesCertificatesApi, remoteAddr string, forwardedFor string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	config := viper.New()
+	config.Set("http.trusted_proxies", []string{"10.0.0.0/8"})
+
+	r := gin.New()
+	err := ConfigureClientIpWithConfig(config, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Use(ErrorMiddleware())
+	api.DefineRoutes(r)
+
+	req := httptest.NewRequest(http.MethodPost, "/certificates", nil)
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("Authorization", "Bearer token")
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestRateLimitsPerUuid(t *testing.T) {
+	key := getTestKey(t)
+	limiter := newRateLimiterStub()
+	api := NewProfileCertificatesApi(&certificatesServiceStub{key: key}, authenticatedAs(testUuid, nil), &authCacheStub{}, &signerStub{key}, newRateLimitsForTest(limiter, false))
+
+	if w := requestCertificateFrom(t, api, "192.0.2.1:1234", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected the first request to be allowed, got %d", w.Code)
+	}
+
+	w := requestCertificateFrom(t, api, "192.0.2.2:1234", "")
+	assertErrorResponse(t, w, expectedError{429, "TooManyRequestsException", "Too many requests, try again later.", "2"})
+
+	expected := []takenToken{
+		{"failed-auth:ip:192.0.2.1", true}, {"ip:192.0.2.1", false}, {"uuid:" + testUuid, false},
+		{"failed-auth:ip:192.0.2.2", true}, {"ip:192.0.2.2", false}, {"uuid:" + testUuid, false},
+	}
+	if len(limiter.taken) != len(expected) {
+		t.Fatalf("expected %v tokens, got %v", expected, limiter.taken)
+	}
+
+	for i := range expected {
+		if limiter.taken[i] != expected[i] {
+			t.Fatalf("expected %v tokens, got %v", expected, limiter.taken)
+		}
+	}
+}
+
+func TestRateLimitsPerFailedAuth(t *testing.T) {
+	limiter := newRateLimiterStub()
+	reader := authreader.NewRevocationChecking(authenticatedAs(testUuid, nil), revokedTokensSource{}, false)
+	api := NewProfileCertificatesApi(&certificatesServiceStub{}, reader, &authCacheStub{}, &signerStub{}, newRateLimitsForTest(limiter, false))
+
+	if w := requestCertificateFrom(t, api, "192.0.2.1:1234", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the rejected token, got %d", w.Code)
+	}
+
+	// The failed attempt has exhausted the limit, so the address is blocked even before the authentication
+	w := requestCertificateFrom(t, api, "192.0.2.1:1234", "")
+	assertErrorResponse(t, w, expectedError{429, "TooManyRequestsException", "Too many requests, try again later.", "60"})
+
+	if w := requestCertificateFrom(t, api, "192.0.2.2:1234", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected another address not to be blocked, got %d", w.Code)
+	}
+}
+
+func TestRateLimitsClientIp(t *testing.T) {
+	testCases := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		expectedKey  string
+	}{
+		{name: "direct client", remoteAddr: "192.0.2.1:1234", expectedKey: "ip:192.0.2.1"},
+		{name: "spoofed X-Forwarded-For", remoteAddr: "192.0.2.1:1234", forwardedFor: "198.51.100.1", expectedKey: "ip:192.0.2.1"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.1:1234", forwardedFor: "198.51.100.1", expectedKey: "ip:198.51.100.1"},
+		{name: "chain of trusted proxies", remoteAddr: "10.0.0.1:1234", forwardedFor: "198.51.100.1, 10.0.0.2", expectedKey: "ip:198.51.100.1"},
+		{name: "ipv6 network", remoteAddr: "[2001:db8:85a3:8d3:1319:8a2e:370:7348]:1234", expectedKey: "ip:2001:db8:85a3:8d3::/64"},
+		{name: "ipv4-mapped ipv6", remoteAddr: "[::ffff:192.0.2.1]:1234", expectedKey: "ip:192.0.2.1"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			key := getTestKey(t)
+			limiter := newRateLimiterStub()
+			api := NewProfileCertificatesApi(&certificatesServiceStub{key: key}, authenticatedAs(testUuid, nil), &authCacheStub{}, &signerStub{key}, newRateLimitsForTest(limiter, false))
+
+			requestCertificateFrom(t, api, testCase.remoteAddr, testCase.forwardedFor)
+			if len(limiter.taken) < 2 || limiter.taken[1].key != testCase.expectedKey {
+				t.Fatalf("expected the %s key, got %v", testCase.expectedKey, limiter.taken)
+			}
+		})
+	}
+}
+
+func TestRateLimitsLimiterFailure(t *testing.T) {
+	key := getTestKey(t)
+	limiter := newRateLimiterStub()
+	limiter.err = errors.New("redis is down")
+
+	t.Run("fail open", func(t *testing.T) {
+		api := NewProfileCertificatesApi(&certificatesServiceStub{key: key}, authenticatedAs(testUuid, nil), &authCacheStub{}, &signerStub{key}, newRateLimitsForTest(limiter, false))
+		if w := requestCertificateFrom(t, api, "192.0.2.1:1234", ""); w.Code != http.StatusOK {
+			t.Fatalf("expected the request to be let through, got %d", w.Code)
+		}
+	})
+
+	t.Run("fail closed", func(t *testing.T) {
+		api := NewProfileCertificatesApi(&certificatesServiceStub{key: key}, authenticatedAs(testUuid, nil), &authCacheStub{}, &signerStub{key}, newRateLimitsForTest(limiter, true))
+		w := requestCertificateFrom(t, api, "192.0.2.1:1234", "")
+		assertErrorResponse(t, w, expectedError{503, "ServiceUnavailableException", "The rate limiter is temporarily unavailable.", "5"})
+	})
+}
+
+func TestNewRateLimitsWithConfig(t *testing.T) {
+	testCases := []struct {
+		name          string
+		values        map[string]any
+		expectedError bool
+	}{
+		{name: "defaults"},
+		{name: "disabled limit", values: map[string]any{"ratelimit.ip.rate": 0, "ratelimit.ip.burst": 0}},
+		{name: "zero burst", values: map[string]any{"ratelimit.uuid.burst": 0}, expectedError: true},
+		{name: "too short interval", values: map[string]any{"ratelimit.ip.rate": 2000, "ratelimit.ip.period": time.Second}, expectedError: true},
+		{name: "unknown fail mode", values: map[string]any{"ratelimit.fail_mode": "maybe"}, expectedError: true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			config := viper.New()
+			for key, value := range testCase.values {
+				config.Set(key, value)
+			}
+
+			_, err := NewRateLimitsWithConfig(config, newRateLimiterStub())
+			if (err != nil) != testCase.expectedError {
+				t.Fatalf("expected the error to be %t, got %v", testCase.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestNilRateLimits(t *testing.T) {
+	key := getTestKey(t)
+	api := NewProfileCertificatesApi(&certificatesServiceStub{key: key}, authenticatedAs(testUuid, nil), &authCacheStub{}, &signerStub{key}, nil)
+	if w := requestCertificateFrom(t, api, "192.0.2.1:1234", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected the request not to be limited, got %d", w.Code)
+	}
+}
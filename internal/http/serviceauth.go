@@ -0,0 +1,174 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+
+	"ely.by/profilecerts/internal/services/audit"
+)
+
+// The gin context key that holds the *ServiceIdentity of an authenticated service
+const ServiceIdentityKey = "serviceIdentity"
+
+type ServiceIdentity struct {
+	Name   string
+	Scopes []string
+	// The way the service has authenticated: api_key, hmac or mtls
+	Method string
+}
+
+func (i *ServiceIdentity) HasScope(scope string) bool {
+	return slices.Contains(i.Scopes, scope) || slices.Contains(i.Scopes, "*")
+}
+
+type ServiceAuthenticator interface {
+	// Should return nil identity and nil error when the request has no credentials of the authenticator's kind
+	Authenticate(r *http.Request) (*ServiceIdentity, error)
+}
+
+// Authenticates other services (not players) that call internal endpoints
+type ServiceAuth struct {
+	authenticators []ServiceAuthenticator
+}
+
+func NewServiceAuth(authenticators ...ServiceAuthenticator) *ServiceAuth {
+	return &ServiceAuth{authenticators}
+}
+
+// Each credential has the "name:secret:scope1,scope2" format, credentials are separated by spaces.
+// mTLS identities have the "name:scope1,scope2" format, where name is the certificate's CN, DNS or URI SAN
+func NewServiceAuthWithConfig(config *viper.Viper, nonces NonceStore) (*ServiceAuth, error) {
+	config.SetDefault("service_auth.hmac.max_skew", 5*time.Minute)
+
+	var authenticators []ServiceAuthenticator
+
+	apiKeys, err := parseServiceCredentials(config.GetStringSlice("service_auth.api_keys"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid service_auth.api_keys: %w", err)
+	}
+
+	if len(apiKeys) > 0 {
+		authenticators = append(authenticators, NewApiKeyAuthenticator(apiKeys))
+	}
+
+	hmacSecrets, err := parseServiceCredentials(config.GetStringSlice("service_auth.hmac.secrets"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid service_auth.hmac.secrets: %w", err)
+	}
+
+	if len(hmacSecrets) > 0 {
+		authenticators = append(authenticators, NewHmacAuthenticator(hmacSecrets, config.GetDuration("service_auth.hmac.max_skew"), nonces))
+	}
+
+	mtlsIdentities := make(map[string][]string)
+	for _, identity := range config.GetStringSlice("service_auth.mtls.identities") {
+		name, scopes, found := strings.Cut(identity, ":")
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid service_auth.mtls.identities: the identity must have the name:scopes format")
+		}
+
+		mtlsIdentities[name] = strings.Split(scopes, ",")
+	}
+
+	if len(mtlsIdentities) > 0 {
+		authenticators = append(authenticators, NewMtlsAuthenticator(mtlsIdentities))
+	}
+
+	return NewServiceAuth(authenticators...), nil
+}
+
+type ServiceCredential struct {
+	Name   string
+	Secret string
+	Scopes []string
+}
+
+func parseServiceCredentials(values []string) ([]ServiceCredential, error) {
+	result := make([]ServiceCredential, len(values))
+	for i, value := range values {
+		parts := strings.SplitN(value, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.New("the credential must have the name:secret:scopes format")
+		}
+
+		result[i] = ServiceCredential{parts[0], parts[1], strings.Split(parts[2], ",")}
+	}
+
+	return result, nil
+}
+
+// Creates a route group, all routes of which require the scope. Use it in DefineRoutes of internal APIs
+func (a *ServiceAuth) Group(r gin.IRouter, relativePath string, scope string) *gin.RouterGroup {
+	return r.Group(relativePath, a.Middleware(scope))
+}
+
+// Mount it on a route group to require the scope from all its routes
+func (a *ServiceAuth) Middleware(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, err := a.authenticate(c.Request)
+		if err != nil {
+			slog.WarnContext(
+				c.Request.Context(),
+				"service authentication failed",
+				slog.Any("err", err),
+				slog.String("method", c.Request.Method),
+				slog.String("path", c.Request.URL.Path),
+				slog.String("ip", c.ClientIP()),
+			)
+			abortWithError(c, errServiceUnauthorized)
+			return
+		}
+
+		if !identity.HasScope(scope) {
+			auditServiceRequest(c, identity, "forbidden")
+			abortWithError(c, errServiceForbidden)
+			return
+		}
+
+		c.Set(ServiceIdentityKey, identity)
+		c.Request = c.Request.WithContext(audit.WithOrigin(c.Request.Context(), audit.Origin{
+			Actor: audit.ServiceActor(identity.Name),
+			Ip:    c.ClientIP(),
+		}))
+		c.Next()
+
+		auditServiceRequest(c, identity, "allowed")
+	}
+}
+
+func (a *ServiceAuth) authenticate(r *http.Request) (*ServiceIdentity, error) {
+	for _, authenticator := range a.authenticators {
+		identity, err := authenticator.Authenticate(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if identity != nil {
+			return identity, nil
+		}
+	}
+
+	return nil, errors.New("the request has no service credentials")
+}
+
+func auditServiceRequest(c *gin.Context, identity *ServiceIdentity, decision string) {
+	slog.InfoContext(
+		c.Request.Context(),
+		"service request",
+		slog.String("service", identity.Name),
+		slog.String("auth_method", identity.Method),
+		slog.String("decision", decision),
+		slog.String("method", c.Request.Method),
+		slog.String("path", c.Request.URL.Path),
+		slog.Int("status", c.Writer.Status()),
+		slog.String("ip", c.ClientIP()),
+	)
+}
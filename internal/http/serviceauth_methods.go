@@ -0,0 +1,190 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Accepts the "X-Api-Key: <key>" header
+type ApiKeyAuthenticator struct {
+	// Keys are hashed, so the comparison takes the same time regardless of the key
+	keys map[[sha256.Size]byte]*ServiceIdentity
+}
+
+func NewApiKeyAuthenticator(credentials []ServiceCredential) *ApiKeyAuthenticator {
+	keys := make(map[[sha256.Size]byte]*ServiceIdentity, len(credentials))
+	for _, credential := range credentials {
+		keys[sha256.Sum256([]byte(credential.Secret))] = &ServiceIdentity{credential.Name, credential.Scopes, "api_key"}
+	}
+
+	return &ApiKeyAuthenticator{keys}
+}
+
+func (a *ApiKeyAuthenticator) Authenticate(r *http.Request) (*ServiceIdentity, error) {
+	key := r.Header.Get("X-Api-Key")
+	if key == "" {
+		return nil, nil
+	}
+
+	identity, found := a.keys[sha256.Sum256([]byte(key))]
+	if !found {
+		return nil, errors.New("unknown api key")
+	}
+
+	return identity, nil
+}
+
+// The maximum size of a body that is read to verify the signature
+const maxSignedBodySize = 1 << 20
+
+// The maximum length of the X-Nonce header
+const maxNonceLength = 128
+
+type NonceStore interface {
+	// Should return false when the nonce of the service has already been remembered and its ttl hasn't passed yet
+	RememberNonce(ctx context.Context, serviceId string, nonce string, ttl time.Duration) (bool, error)
+}
+
+// Accepts requests signed with a shared secret. The request must have the headers:
+//   - X-Service-Id: the credential name;
+//   - X-Timestamp: unix timestamp in seconds;
+//   - X-Nonce: a unique value of each request, up to 128 characters;
+//   - X-Signature: hex encoded HMAC-SHA256 of "<METHOD>\n<path with query>\n<timestamp>\n<nonce>\n<hex encoded SHA256 of the body>".
+//
+// A nonce can't be used twice, so a captured request can't be replayed while its timestamp is still accepted
+type HmacAuthenticator struct {
+	credentials map[string]ServiceCredential
+	maxSkew     time.Duration
+	nonces      NonceStore
+}
+
+func NewHmacAuthenticator(credentials []ServiceCredential, maxSkew time.Duration, nonces NonceStore) *HmacAuthenticator {
+	byName := make(map[string]ServiceCredential, len(credentials))
+	for _, credential := range credentials {
+		byName[credential.Name] = credential
+	}
+
+	return &HmacAuthenticator{byName, maxSkew, nonces}
+}
+
+func (a *HmacAuthenticator) Authenticate(r *http.Request) (*ServiceIdentity, error) {
+	serviceId := r.Header.Get("X-Service-Id")
+	signature := r.Header.Get("X-Signature")
+	if serviceId == "" && signature == "" {
+		return nil, nil
+	}
+
+	credential, found := a.credentials[serviceId]
+	if !found {
+		return nil, fmt.Errorf("unknown service id %s", serviceId)
+	}
+
+	timestampStr := r.Header.Get("X-Timestamp")
+	timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %w", err)
+	}
+
+	skew := time.Since(time.Unix(timestamp, 0))
+	if skew > a.maxSkew || skew < -a.maxSkew {
+		return nil, errors.New("the timestamp is out of the allowed range")
+	}
+
+	nonce := r.Header.Get("X-Nonce")
+	if nonce == "" || len(nonce) > maxNonceLength {
+		return nil, errors.New("the nonce is missing or too long")
+	}
+
+	expectedSignature, err := a.sign(r, credential.Secret, timestampStr, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	providedSignature, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(providedSignature, expectedSignature) {
+		return nil, errors.New("invalid signature")
+	}
+
+	// The nonce is remembered only after the signature check, so unsigned requests can't fill the store.
+	// A timestamp is accepted within maxSkew in both directions, so the nonce must outlive the whole window
+	isNew, err := a.nonces.RememberNonce(r.Context(), credential.Name, nonce, 2*a.maxSkew)
+	if err != nil {
+		return nil, fmt.Errorf("unable to check the nonce: %w", err)
+	}
+
+	if !isNew {
+		return nil, errors.New("the nonce has already been used")
+	}
+
+	return &ServiceIdentity{credential.Name, credential.Scopes, "hmac"}, nil
+}
+
+func (a *HmacAuthenticator) sign(r *http.Request, secret string, timestamp string, nonce string) ([]byte, error) {
+	bodyHash := sha256.New()
+	if r.Body != nil {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxSignedBodySize+1))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the request body: %w", err)
+		}
+
+		if len(body) > maxSignedBodySize {
+			return nil, errors.New("the request body is too large")
+		}
+
+		// Handlers must be able to read the body again
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		bodyHash.Write(body)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{
+		r.Method,
+		r.URL.RequestURI(),
+		timestamp,
+		nonce,
+		hex.EncodeToString(bodyHash.Sum(nil)),
+	}, "\n")))
+
+	return mac.Sum(nil), nil
+}
+
+// Identifies services by client certificates verified by the TLS server.
+// The certificate's CN, DNS names and URIs are matched against known identities
+type MtlsAuthenticator struct {
+	identities map[string][]string
+}
+
+func NewMtlsAuthenticator(identities map[string][]string) *MtlsAuthenticator {
+	return &MtlsAuthenticator{identities}
+}
+
+func (a *MtlsAuthenticator) Authenticate(r *http.Request) (*ServiceIdentity, error) {
+	// Only verified chains count, so a self-signed certificate can't be used to pretend to be a service
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+
+	for _, name := range names {
+		if scopes, found := a.identities[name]; found && name != "" {
+			return &ServiceIdentity{name, scopes, "mtls"}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown client certificate identity %s", cert.Subject.CommonName)
+}
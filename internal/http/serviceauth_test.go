@@ -0,0 +1,349 @@
+package http
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type nonceStoreStub struct {
+	nonces map[string]bool
+	err    error
+}
+
+func (s *nonceStoreStub) RememberNonce(ctx context.Context, serviceId string, nonce string, ttl time.Duration) (bool, error) {
+	if s.err != nil {
+		return false, s.err
+	}
+
+	if s.nonces == nil {
+		s.nonces = make(map[string]bool)
+	}
+
+	key := serviceId + ":" + nonce
+	if s.nonces[key] {
+		return false, nil
+	}
+
+	s.nonces[key] = true
+
+	return true, nil
+}
+
+func signRequest(r *http.Request, serviceId string, secret string, timestamp time.Time, nonce string, body string) {
+	timestampStr := strconv.FormatInt(timestamp.Unix(), 10)
+	bodyHash := sha256.Sum256([]byte(body))
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{r.Method, r.URL.RequestURI(), timestampStr, nonce, hex.EncodeToString(bodyHash[:])}, "\n")))
+
+	r.Header.Set("X-Service-Id", serviceId)
+	r.Header.Set("X-Timestamp", timestampStr)
+	r.Header.Set("X-Nonce", nonce)
+	r.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestHmacAuthenticator(t *testing.T) {
+	credentials := []ServiceCredential{{Name: "accounts", Secret: "secret", Scopes: []string{"certificates:read"}}}
+
+	testCases := []struct {
+		name          string
+		prepare       func(r *http.Request)
+		nonces        *nonceStoreStub
+		expectedError bool
+	}{
+		{
+			name: "valid signature",
+			prepare: func(r *http.Request) {
+				signRequest(r, "accounts", "secret", time.Now(), "nonce-1", "body")
+			},
+		},
+		{
+			name:    "without credentials",
+			prepare: func(r *http.Request) {},
+		},
+		{
+			name: "unknown service",
+			prepare: func(r *http.Request) {
+				signRequest(r, "skins", "secret", time.Now(), "nonce-1", "body")
+			},
+			expectedError: true,
+		},
+		{
+			name: "invalid signature",
+			prepare: func(r *http.Request) {
+				signRequest(r, "accounts", "another secret", time.Now(), "nonce-1", "body")
+			},
+			expectedError: true,
+		},
+		{
+			name: "signature of another body",
+			prepare: func(r *http.Request) {
+				signRequest(r, "accounts", "secret", time.Now(), "nonce-1", "another body")
+			},
+			expectedError: true,
+		},
+		{
+			name: "substituted nonce",
+			prepare: func(r *http.Request) {
+				signRequest(r, "accounts", "secret", time.Now(), "nonce-1", "body")
+				r.Header.Set("X-Nonce", "nonce-2")
+			},
+			expectedError: true,
+		},
+		{
+			name: "without nonce",
+			prepare: func(r *http.Request) {
+				signRequest(r, "accounts", "secret", time.Now(), "", "body")
+			},
+			expectedError: true,
+		},
+		{
+			name: "too long nonce",
+			prepare: func(r *http.Request) {
+				signRequest(r, "accounts", "secret", time.Now(), strings.Repeat("a", maxNonceLength+1), "body")
+			},
+			expectedError: true,
+		},
+		{
+			name: "timestamp from the past",
+			prepare: func(r *http.Request) {
+				signRequest(r, "accounts", "secret", time.Now().Add(-6*time.Minute), "nonce-1", "body")
+			},
+			expectedError: true,
+		},
+		{
+			name: "timestamp from the future",
+			prepare: func(r *http.Request) {
+				signRequest(r, "accounts", "secret", time.Now().Add(6*time.Minute), "nonce-1", "body")
+			},
+			expectedError: true,
+		},
+		{
+			name: "replayed nonce",
+			prepare: func(r *http.Request) {
+				signRequest(r, "accounts", "secret", time.Now(), "nonce-1", "body")
+			},
+			nonces:        &nonceStoreStub{nonces: map[string]bool{"accounts:nonce-1": true}},
+			expectedError: true,
+		},
+		{
+			name: "nonce store failure",
+			prepare: func(r *http.Request) {
+				signRequest(r, "accounts", "secret", time.Now(), "nonce-1", "body")
+			},
+			nonces:        &nonceStoreStub{err: errors.New("redis is down")},
+			expectedError: true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			nonces := testCase.nonces
+			if nonces == nil {
+				nonces = &nonceStoreStub{}
+			}
+
+			authenticator := NewHmacAuthenticator(credentials, 5*time.Minute, nonces)
+			req := httptest.NewRequest(http.MethodPost, "/admin/certificates?uuid="+testUuid, strings.NewReader("body"))
+			testCase.prepare(req)
+
+			identity, err := authenticator.Authenticate(req)
+			if testCase.expectedError {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", identity)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if req.Header.Get("X-Signature") == "" {
+				if identity != nil {
+					t.Fatalf("expected no identity without credentials, got %+v", identity)
+				}
+
+				return
+			}
+
+			if identity == nil || identity.Name != "accounts" || identity.Method != "hmac" {
+				t.Fatalf("expected the accounts identity, got %+v", identity)
+			}
+
+			// Handlers must be able to read the body again
+			body, _ := io.ReadAll(req.Body)
+			if string(body) != "body" {
+				t.Fatalf("expected the body to be readable again, got %q", body)
+			}
+		})
+	}
+}
+
+func TestHmacAuthenticatorRejectsReplays(t *testing.T) {
+	authenticator := NewHmacAuthenticator([]ServiceCredential{{Name: "accounts", Secret: "secret"}}, 5*time.Minute, &nonceStoreStub{})
+
+	req := httptest.NewRequest(http.MethodDelete, "/admin/certificates/"+testUuid, nil)
+	signRequest(req, "accounts", "secret", time.Now(), "nonce-1", "")
+	if _, err := authenticator.Authenticate(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	replayed := httptest.NewRequest(http.MethodDelete, "/admin/certificates/"+testUuid, nil)
+	replayed.Header = req.Header.Clone()
+	if _, err := authenticator.Authenticate(replayed); err == nil {
+		t.Fatal("expected the replayed request to be rejected")
+	}
+}
+
+func TestApiKeyAuthenticator(t *testing.T) {
+	authenticator := NewApiKeyAuthenticator([]ServiceCredential{{Name: "accounts", Secret: "key", Scopes: []string{"*"}}})
+
+	testCases := []struct {
+		name             string
+		apiKey           string
+		expectedIdentity string
+		expectedError    bool
+	}{
+		{name: "known key", apiKey: "key", expectedIdentity: "accounts"},
+		{name: "without key"},
+		{name: "unknown key", apiKey: "another key", expectedError: true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if testCase.apiKey != "" {
+				req.Header.Set("X-Api-Key", testCase.apiKey)
+			}
+
+			identity, err := authenticator.Authenticate(req)
+			if testCase.expectedError {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", identity)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if name := identityName(identity); name != testCase.expectedIdentity {
+				t.Fatalf("expected the %q identity, got %q", testCase.expectedIdentity, name)
+			}
+		})
+	}
+}
+
+func TestMtlsAuthenticator(t *testing.T) {
+	authenticator := NewMtlsAuthenticator(map[string][]string{
+		"accounts.internal":        {"certificates:read"},
+		"spiffe://ely.by/textures": {"certificates:read"},
+	})
+
+	verifiedBy := func(cert *x509.Certificate) *tls.ConnectionState {
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	spiffeId, _ := url.Parse("spiffe://ely.by/textures")
+
+	testCases := []struct {
+		name             string
+		tls              *tls.ConnectionState
+		expectedIdentity string
+		expectedError    bool
+	}{
+		{name: "without tls"},
+		{name: "unverified certificate", tls: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "accounts.internal"}}}}},
+		{name: "common name", tls: verifiedBy(&x509.Certificate{Subject: pkix.Name{CommonName: "accounts.internal"}}), expectedIdentity: "accounts.internal"},
+		{name: "dns name", tls: verifiedBy(&x509.Certificate{DNSNames: []string{"accounts.internal"}}), expectedIdentity: "accounts.internal"},
+		{name: "uri", tls: verifiedBy(&x509.Certificate{URIs: []*url.URL{spiffeId}}), expectedIdentity: "spiffe://ely.by/textures"},
+		{name: "unknown certificate", tls: verifiedBy(&x509.Certificate{Subject: pkix.Name{CommonName: "skins.internal"}}), expectedError: true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.TLS = testCase.tls
+
+			identity, err := authenticator.Authenticate(req)
+			if testCase.expectedError {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", identity)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if name := identityName(identity); name != testCase.expectedIdentity {
+				t.Fatalf("expected the %q identity, got %q", testCase.expectedIdentity, name)
+			}
+		})
+	}
+}
+
+func identityName(identity *ServiceIdentity) string {
+	if identity == nil {
+		return ""
+	}
+
+	return identity.Name
+}
+
+func TestServiceAuthMiddleware(t *testing.T) {
+	serviceAuth := NewServiceAuth(NewApiKeyAuthenticator([]ServiceCredential{
+		{Name: "reader", Secret: "reader-key", Scopes: []string{"certificates:read"}},
+		{Name: "admin", Secret: "admin-key", Scopes: []string{"*"}},
+	}))
+
+	r := gin.New()
+	serviceAuth.Group(r, "/internal", "certificates:write").GET("", func(c *gin.Context) {
+		identity := c.MustGet(ServiceIdentityKey).(*ServiceIdentity)
+		c.String(http.StatusOK, identity.Name)
+	})
+
+	testCases := []struct {
+		name           string
+		apiKey         string
+		expectedStatus int
+	}{
+		{name: "allowed", apiKey: "admin-key", expectedStatus: http.StatusOK},
+		{name: "without the scope", apiKey: "reader-key", expectedStatus: http.StatusForbidden},
+		{name: "invalid credentials", apiKey: "unknown-key", expectedStatus: http.StatusUnauthorized},
+		{name: "without credentials", expectedStatus: http.StatusUnauthorized},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/internal", nil)
+			if testCase.apiKey != "" {
+				req.Header.Set("X-Api-Key", testCase.apiKey)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != testCase.expectedStatus {
+				t.Fatalf("expected the %d status, got %d: %s", testCase.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
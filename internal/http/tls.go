@@ -0,0 +1,187 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// How often the files are checked for changes. The check happens during handshakes, so there is no background job
+const tlsReloadCheckInterval = 10 * time.Second
+
+// Serves the certificate and the client CAs from files and reloads them when the files change,
+// so renewed certificates are picked up without a restart
+type tlsReloader struct {
+	certFile     string
+	keyFile      string
+	clientCaFile string
+	clientAuth   tls.ClientAuthType
+
+	mu          sync.Mutex
+	config      *tls.Config
+	modTime     time.Time
+	lastChecked time.Time
+}
+
+// Returns nil when the prefix.tls.cert_file isn't specified
+func newTlsConfigWithConfig(config *viper.Viper, prefix string) (*tls.Config, error) {
+	reloader, err := newTlsReloaderWithConfig(config, prefix)
+	if reloader == nil || err != nil {
+		return nil, err
+	}
+
+	return reloader.tlsConfig(), nil
+}
+
+func newTlsReloaderWithConfig(config *viper.Viper, prefix string) (*tlsReloader, error) {
+	config.SetDefault(prefix+".tls.client_auth", "none")
+
+	certFile := config.GetString(prefix + ".tls.cert_file")
+	if certFile == "" {
+		return nil, nil
+	}
+
+	var clientAuth tls.ClientAuthType
+	switch mode := config.GetString(prefix + ".tls.client_auth"); mode {
+	case "none":
+		clientAuth = tls.NoClientCert
+	case "optional":
+		clientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown %s.tls.client_auth mode %s, expected none, optional or require", prefix, mode)
+	}
+
+	reloader := &tlsReloader{
+		certFile:     certFile,
+		keyFile:      config.GetString(prefix + ".tls.key_file"),
+		clientCaFile: config.GetString(prefix + ".tls.client_ca_file"),
+		clientAuth:   clientAuth,
+	}
+	if reloader.keyFile == "" {
+		return nil, fmt.Errorf("%s.tls.key_file is required when %s.tls.cert_file is specified", prefix, prefix)
+	}
+
+	if clientAuth != tls.NoClientCert && reloader.clientCaFile == "" {
+		return nil, fmt.Errorf("%s.tls.client_ca_file is required to verify client certificates", prefix)
+	}
+
+	err := reloader.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// The handshake is served by the config returned from the GetConfigForClient. The GetCertificate is still required,
+// because the ServeTLS refuses to start without a certificate in the outer config
+func (r *tlsReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: r.getConfigForClient,
+		GetCertificate:     r.getCertificate,
+	}
+}
+
+func (r *tlsReloader) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	config, err := r.getConfigForClient(hello)
+	if err != nil {
+		return nil, err
+	}
+
+	return &config.Certificates[0], nil
+}
+
+func (r *tlsReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.lastChecked) >= tlsReloadCheckInterval {
+		r.lastChecked = time.Now()
+		modTime, err := r.latestModTime()
+		if err == nil && modTime.After(r.modTime) {
+			err = r.reloadLocked()
+		}
+
+		// The previous certificate is still served, so the failure doesn't break the server
+		if err != nil {
+			slog.Error("unable to reload the TLS certificate", slog.String("cert_file", r.certFile), slog.Any("err", err))
+		}
+	}
+
+	return r.config, nil
+}
+
+func (r *tlsReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastChecked = time.Now()
+
+	return r.reloadLocked()
+}
+
+func (r *tlsReloader) reloadLocked() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load the TLS certificate: %w", err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   r.clientAuth,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	if r.clientCaFile != "" {
+		caPem, err := os.ReadFile(r.clientCaFile)
+		if err != nil {
+			return fmt.Errorf("unable to read the client CA file: %w", err)
+		}
+
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(caPem) {
+			return errors.New("the client CA file has no valid certificates")
+		}
+	}
+
+	r.config = config
+	r.modTime = modTime
+
+	return nil
+}
+
+func (r *tlsReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile, r.clientCaFile} {
+		if file == "" {
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unable to check the TLS file: %w", err)
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,303 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// Issues a certificate signed by the parent or a self-signed CA when the parent is nil
+func issueTestCertificate(t *testing.T, parent *testCertificate, serial int64, commonName string) *testCertificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{commonName},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	issuer, signer := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		issuer, signer = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCertificate{cert: cert, key: key}
+}
+
+// Writes the files and moves their modification time forward, so the change is noticed regardless of the fs precision
+func (c *testCertificate) writeFiles(t *testing.T, certFile string, keyFile string, modTime time.Time) {
+	t.Helper()
+
+	keyDer, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), modTime)
+	if keyFile != "" {
+		writeTestFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), modTime)
+	}
+}
+
+func (c *testCertificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+func writeTestFile(t *testing.T, file string, content []byte, modTime time.Time) {
+	t.Helper()
+
+	err := os.WriteFile(file, content, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chtimes(file, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Serves the config with ServeTLS, the same way the listenAndServe does, and returns the address
+func serveTls(t *testing.T, config *tls.Config) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("ok"))
+		}),
+		TLSConfig: config,
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.ServeTLS(listener, "", "")
+	}()
+
+	t.Cleanup(func() {
+		_ = server.Close()
+		if err := <-served; err != http.ErrServerClosed {
+			t.Errorf("the server has failed: %v", err)
+		}
+	})
+
+	return listener.Addr().String()
+}
+
+// Makes a request over a fresh connection and returns the serial number of the served certificate
+func requestOverTls(addr string, ca *testCertificate, clientCert *testCertificate) (*big.Int, error) {
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.cert)
+	clientConfig := &tls.Config{RootCAs: rootCAs, ServerName: "localhost"}
+	if clientCert != nil {
+		// The Certificates are skipped when they aren't issued by the CAs accepted by the server,
+		// while the untrusted certificate must reach the server to be rejected there
+		clientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert := clientCert.tlsCertificate()
+			return &cert, nil
+		}
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig, DisableKeepAlives: true}}
+	resp, err := client.Get("https://" + addr + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	_ = resp.Body.Close()
+
+	return resp.TLS.PeerCertificates[0].SerialNumber, nil
+}
+
+func TestNewTlsConfigWithConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	ca := issueTestCertificate(t, nil, 1, "ca")
+	issueTestCertificate(t, ca, 2, "localhost").writeFiles(t, certFile, keyFile, time.Now())
+	ca.writeFiles(t, caFile, "", time.Now())
+
+	tlsConfig, err := newTlsConfigWithConfig(viper.New(), "http")
+	if tlsConfig != nil || err != nil {
+		t.Fatalf("expected no TLS without the cert file, got %v, %v", tlsConfig, err)
+	}
+
+	testCases := []struct {
+		name   string
+		params map[string]string
+	}{
+		{"missing key", map[string]string{"cert_file": certFile}},
+		{"unknown client auth", map[string]string{"cert_file": certFile, "key_file": keyFile, "client_auth": "always"}},
+		{"client auth without CA", map[string]string{"cert_file": certFile, "key_file": keyFile, "client_auth": "require"}},
+		{"missing cert file", map[string]string{"cert_file": filepath.Join(dir, "missing.crt"), "key_file": keyFile}},
+		{"mismatched key", map[string]string{"cert_file": caFile, "key_file": keyFile}},
+		{"invalid CA", map[string]string{"cert_file": certFile, "key_file": keyFile, "client_auth": "optional", "client_ca_file": keyFile}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := viper.New()
+			for key, value := range tc.params {
+				config.Set("http.tls."+key, value)
+			}
+
+			_, err := newTlsConfigWithConfig(config, "http")
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestTlsReloadsCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	ca := issueTestCertificate(t, nil, 1, "ca")
+	issueTestCertificate(t, ca, 2, "localhost").writeFiles(t, certFile, keyFile, time.Now())
+
+	config := viper.New()
+	config.Set("http.tls.cert_file", certFile)
+	config.Set("http.tls.key_file", keyFile)
+	reloader, err := newTlsReloaderWithConfig(config, "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := serveTls(t, reloader.tlsConfig())
+	expectServedSerial := func(expected int64) {
+		t.Helper()
+
+		serial, err := requestOverTls(addr, ca, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if serial.Int64() != expected {
+			t.Fatalf("expected the certificate %d to be served, got %d", expected, serial)
+		}
+	}
+
+	forceCheck := func() {
+		reloader.mu.Lock()
+		reloader.lastChecked = time.Time{}
+		reloader.mu.Unlock()
+	}
+
+	expectServedSerial(2)
+
+	// The files are checked once in a while, not on every handshake
+	issueTestCertificate(t, ca, 3, "localhost").writeFiles(t, certFile, keyFile, time.Now().Add(time.Minute))
+	expectServedSerial(2)
+
+	forceCheck()
+	expectServedSerial(3)
+
+	// A broken file doesn't replace the loaded certificate
+	writeTestFile(t, certFile, []byte("garbage"), time.Now().Add(2*time.Minute))
+	forceCheck()
+	expectServedSerial(3)
+}
+
+func TestTlsClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	ca := issueTestCertificate(t, nil, 1, "ca")
+	issueTestCertificate(t, ca, 2, "localhost").writeFiles(t, certFile, keyFile, time.Now())
+	ca.writeFiles(t, caFile, "", time.Now())
+
+	trustedClient := issueTestCertificate(t, ca, 3, "ops-client")
+	untrustedClient := issueTestCertificate(t, issueTestCertificate(t, nil, 4, "other-ca"), 5, "ops-client")
+
+	testCases := []struct {
+		clientAuth string
+		clientCert *testCertificate
+		succeeds   bool
+	}{
+		{"require", trustedClient, true},
+		{"require", nil, false},
+		{"require", untrustedClient, false},
+		{"optional", trustedClient, true},
+		{"optional", nil, true},
+		{"optional", untrustedClient, false},
+	}
+
+	for _, tc := range testCases {
+		name := tc.clientAuth + "/without cert"
+		if tc.clientCert == trustedClient {
+			name = tc.clientAuth + "/trusted cert"
+		} else if tc.clientCert == untrustedClient {
+			name = tc.clientAuth + "/untrusted cert"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			config := viper.New()
+			config.Set("ops.tls.cert_file", certFile)
+			config.Set("ops.tls.key_file", keyFile)
+			config.Set("ops.tls.client_ca_file", caFile)
+			config.Set("ops.tls.client_auth", tc.clientAuth)
+			tlsConfig, err := newTlsConfigWithConfig(config, "ops")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = requestOverTls(serveTls(t, tlsConfig), ca, tc.clientCert)
+			if tc.succeeds && err != nil {
+				t.Fatalf("expected the request to succeed, got %v", err)
+			}
+
+			if !tc.succeeds && err == nil {
+				t.Fatal("expected the handshake to fail")
+			}
+		})
+	}
+}
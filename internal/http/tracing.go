@@ -0,0 +1,83 @@
+package http
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"ely.by/profilecerts/internal/logging"
+)
+
+var tracer = otel.Tracer("ely.by/profilecerts/internal/http")
+
+// Starts a server span for each request, continuing the trace passed by the caller
+func TracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		ctx, span := tracer.Start(
+			ctx,
+			c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", c.Request.URL.Path),
+			),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		var message string
+		if err := c.Errors.Last(); err != nil {
+			span.RecordError(err.Err)
+			message = err.Error()
+		}
+
+		// Client errors are the expected outcome of invalid requests, so only server errors fail the span
+		if status >= 500 {
+			span.SetStatus(codes.Error, message)
+		}
+	}
+}
+
+// Starts a span for the certificate request stage. The returned function ends the span,
+// records the stage duration and leaves a breadcrumb for the error reporter
+func startStage(ctx context.Context, stage string) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, "certificates."+stage)
+
+	return ctx, func(err error) {
+		duration := time.Since(start)
+		breadcrumb := logging.Breadcrumb{
+			Category: "certificates",
+			Message:  stage,
+			Data:     map[string]interface{}{"duration_ms": duration.Milliseconds()},
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			breadcrumb.IsError = true
+			breadcrumb.Data["error"] = err.Error()
+		}
+
+		span.End()
+		certificateStageDuration.WithLabelValues(stage).Observe(duration.Seconds())
+		logging.AddBreadcrumb(ctx, breadcrumb)
+	}
+}
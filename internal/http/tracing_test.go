@@ -0,0 +1,117 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+	testSpansOnce sync.Once
+	testSpans     *tracetest.InMemoryExporter
+)
+
+// The package tracer is bound to the first global provider, so all tests share a single one
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	testSpansOnce.Do(func() {
+		testSpans = tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(testSpans)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+
+	testSpans.Reset()
+
+	return testSpans
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	spans := recordSpans(t)
+
+	r := gin.New()
+	r.Use(TracingMiddleware())
+	r.Use(ErrorMiddleware())
+	r.GET("/ok", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/unauthorized", func(c *gin.Context) {
+		c.Status(http.StatusUnauthorized)
+	})
+	r.GET("/too-many/:uuid", func(c *gin.Context) {
+		abortWithError(c, &apiError{status: http.StatusTooManyRequests, errorType: "TooManyRequestsException", message: "Slow down."})
+	})
+	r.GET("/failure", func(c *gin.Context) {
+		_ = c.Error(errors.New("redis is down"))
+	})
+
+	testCases := []struct {
+		path           string
+		expectedName   string
+		expectedStatus codes.Code
+	}{
+		{path: "/ok", expectedName: "GET /ok", expectedStatus: codes.Unset},
+		{path: "/unauthorized", expectedName: "GET /unauthorized", expectedStatus: codes.Unset},
+		{path: "/too-many/" + testUuid, expectedName: "GET /too-many/:uuid", expectedStatus: codes.Unset},
+		{path: "/failure", expectedName: "GET /failure", expectedStatus: codes.Error},
+		{path: "/unknown", expectedName: "GET unmatched", expectedStatus: codes.Unset},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.path, func(t *testing.T) {
+			spans.Reset()
+
+			req := httptest.NewRequest(http.MethodGet, testCase.path, nil)
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			recorded := spans.GetSpans()
+			if len(recorded) != 1 {
+				t.Fatalf("expected a single span, got %d", len(recorded))
+			}
+
+			span := recorded[0]
+			if span.Name != testCase.expectedName {
+				t.Errorf("expected the %q span, got %q", testCase.expectedName, span.Name)
+			}
+
+			if span.Status.Code != testCase.expectedStatus {
+				t.Errorf("expected the %s span status, got %s %q", testCase.expectedStatus, span.Status.Code, span.Status.Description)
+			}
+		})
+	}
+}
+
+func TestTracingMiddlewareContinuesTrace(t *testing.T) {
+	spans := recordSpans(t)
+
+	r := gin.New()
+	r.Use(TracingMiddleware())
+	r.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	recorded := spans.GetSpans()
+	if len(recorded) != 1 {
+		t.Fatalf("expected a single span, got %d", len(recorded))
+	}
+
+	if traceId := recorded[0].SpanContext.TraceID().String(); traceId != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("expected the caller's trace to be continued, got %s", traceId)
+	}
+
+	if parentId := recorded[0].Parent.SpanID().String(); parentId != "00f067aa0ba902b7" {
+		t.Fatalf("expected the caller's span to be the parent, got %s", parentId)
+	}
+}
@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Configures the default slog logger. The returned closer releases the log file, if one is used
+func InitWithConfig(config *viper.Viper) (io.Closer, error) {
+	config.SetDefault("log.format", "text")
+	config.SetDefault("log.output", "stderr")
+	if config.GetBool("debug") {
+		config.SetDefault("log.level", "debug")
+	} else {
+		config.SetDefault("log.level", "info")
+	}
+
+	var level slog.Level
+	err := level.UnmarshalText([]byte(config.GetString("log.level")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level: %w", err)
+	}
+
+	var output io.WriteCloser
+	switch path := config.GetString("log.output"); path {
+	case "stderr":
+		output = nopCloser{os.Stderr}
+	case "stdout":
+		output = nopCloser{os.Stdout}
+	default:
+		output, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open the log file: %w", err)
+		}
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch format := strings.ToLower(config.GetString("log.format")); format {
+	case "text":
+		handler = slog.NewTextHandler(output, options)
+	case "json":
+		handler = slog.NewJSONHandler(output, options)
+	default:
+		output.Close()
+		return nil, fmt.Errorf("unknown log format %s", format)
+	}
+
+	slog.SetDefault(slog.New(&contextHandler{handler}))
+
+	return output, nil
+}
+
+type requestIdKey struct{}
+
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, requestId)
+}
+
+// Returns an empty string when there is no request id in the context
+func RequestId(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey{}).(string)
+
+	return requestId
+}
+
+// Adds the request id and the trace identifiers from the context to each record,
+// so logs written with the *Context functions can be correlated with the request
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestId := RequestId(ctx); requestId != "" {
+		record.AddAttrs(slog.String("request_id", requestId))
+	}
+
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", spanContext.TraceID().String()),
+			slog.String("span_id", spanContext.SpanID().String()),
+		)
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
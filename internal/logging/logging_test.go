@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInitWithConfig(t *testing.T) {
+	defaultLogger := slog.Default()
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+	})
+
+	path := filepath.Join(t.TempDir(), "profilecerts.log")
+	config := viper.New()
+	config.Set("log.format", "json")
+	config.Set("log.output", path)
+	config.Set("log.level", "warn")
+
+	closer, err := InitWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	traceId, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanId, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(WithRequestId(context.Background(), "request-1"), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceId,
+		SpanID:  spanId,
+	}))
+
+	slog.InfoContext(ctx, "below the level")
+	slog.With(slog.String("component", "test")).WarnContext(ctx, "warning")
+	_ = closer.Close()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var record map[string]string
+	err = json.Unmarshal(content, &record)
+	if err != nil {
+		t.Fatalf("expected a single json record, got %s", content)
+	}
+
+	expected := map[string]string{
+		"msg":        "warning",
+		"component":  "test",
+		"request_id": "request-1",
+		"trace_id":   "4bf92f3577b34da6a3ce929d0e0e4736",
+		"span_id":    "00f067aa0ba902b7",
+	}
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("expected %s to be %q, got %q", key, value, record[key])
+		}
+	}
+}
+
+func TestInitWithConfigErrors(t *testing.T) {
+	defaultLogger := slog.Default()
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+	})
+
+	testCases := map[string]map[string]string{
+		"invalid level":  {"log.level": "verbose"},
+		"invalid format": {"log.format": "xml"},
+		"invalid output": {"log.output": filepath.Join(t.TempDir(), "missing", "profilecerts.log")},
+	}
+	for name, values := range testCases {
+		t.Run(name, func(t *testing.T) {
+			config := viper.New()
+			for key, value := range values {
+				config.Set(key, value)
+			}
+
+			if _, err := InitWithConfig(config); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type Breadcrumb struct {
+	Category string
+	Message  string
+	IsError  bool
+	Data     map[string]interface{}
+}
+
+// Reports errors to an external tracking system. The request-scoped methods only work
+// with contexts derived from the one returned by StartRequest
+type ErrorReporter interface {
+	// The returned function must be called when the request is served
+	StartRequest(ctx context.Context, r *http.Request, route string) (context.Context, func(status int))
+	SetUser(ctx context.Context, id string)
+	SetTag(ctx context.Context, key string, value string)
+	AddBreadcrumb(ctx context.Context, breadcrumb Breadcrumb)
+	CaptureError(ctx context.Context, err error)
+	CapturePanic(ctx context.Context, recovered interface{})
+	Flush(timeout time.Duration)
+}
+
+type reporterKey struct{}
+
+// Makes the reporter available to the code that has no direct access to it, see AddBreadcrumb
+func WithErrorReporter(ctx context.Context, reporter ErrorReporter) context.Context {
+	return context.WithValue(ctx, reporterKey{}, reporter)
+}
+
+// Does nothing when there is no reporter in the context
+func AddBreadcrumb(ctx context.Context, breadcrumb Breadcrumb) {
+	if reporter, ok := ctx.Value(reporterKey{}).(ErrorReporter); ok {
+		reporter.AddBreadcrumb(ctx, breadcrumb)
+	}
+}
+
+type NopErrorReporter struct{}
+
+func (NopErrorReporter) StartRequest(ctx context.Context, _ *http.Request, _ string) (context.Context, func(int)) {
+	return ctx, func(int) {}
+}
+
+func (NopErrorReporter) SetUser(context.Context, string) {}
+
+func (NopErrorReporter) SetTag(context.Context, string, string) {}
+
+func (NopErrorReporter) AddBreadcrumb(context.Context, Breadcrumb) {}
+
+func (NopErrorReporter) CaptureError(context.Context, error) {}
+
+func (NopErrorReporter) CapturePanic(context.Context, interface{}) {}
+
+func (NopErrorReporter) Flush(time.Duration) {}
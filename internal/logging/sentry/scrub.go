@@ -0,0 +1,86 @@
+package sentry
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/getsentry/sentry-go"
+)
+
+const filtered = "[Filtered]"
+
+// Credentials of players and internal services. Header names are canonicalized before the comparison
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"X-Api-Key",
+	"X-Signature",
+}
+
+var sensitivePatterns = []*regexp.Regexp{
+	// PEM-encoded keys, including truncated ones
+	regexp.MustCompile(`(?s)-----BEGIN [A-Z ]+-----.*?(-----END [A-Z ]+-----|$)`),
+	regexp.MustCompile(`(?i)bearer\s+[\w\-.~+/]+=*`),
+	// JWTs that got into error messages without the Bearer prefix
+	regexp.MustCompile(`eyJ[\w-]+\.[\w-]+\.[\w-]*`),
+}
+
+func scrubEvent(event *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+	if event.Request != nil {
+		for name := range event.Request.Headers {
+			if isSensitiveHeader(name) {
+				event.Request.Headers[name] = filtered
+			}
+		}
+
+		event.Request.Cookies = ""
+		event.Request.Data = scrubString(event.Request.Data)
+	}
+
+	event.Message = scrubString(event.Message)
+	for i := range event.Exception {
+		event.Exception[i].Value = scrubString(event.Exception[i].Value)
+	}
+
+	for _, breadcrumb := range event.Breadcrumbs {
+		scrubBreadcrumb(breadcrumb, nil)
+	}
+
+	scrubMap(event.Extra)
+
+	return event
+}
+
+func scrubBreadcrumb(breadcrumb *sentry.Breadcrumb, _ *sentry.BreadcrumbHint) *sentry.Breadcrumb {
+	breadcrumb.Message = scrubString(breadcrumb.Message)
+	scrubMap(breadcrumb.Data)
+
+	return breadcrumb
+}
+
+func scrubMap(values map[string]interface{}) {
+	for key, value := range values {
+		if str, ok := value.(string); ok {
+			values[key] = scrubString(str)
+		}
+	}
+}
+
+func scrubString(value string) string {
+	for _, pattern := range sensitivePatterns {
+		value = pattern.ReplaceAllString(value, filtered)
+	}
+
+	return value
+}
+
+func isSensitiveHeader(name string) bool {
+	name = http.CanonicalHeaderKey(name)
+	for _, sensitive := range sensitiveHeaders {
+		if name == sensitive {
+			return true
+		}
+	}
+
+	return false
+}
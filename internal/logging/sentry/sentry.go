@@ -1,15 +1,34 @@
 package sentry
 
 import (
+	"context"
+	"net/http"
+	"time"
+
 	"github.com/getsentry/sentry-go"
-	sentryGin "github.com/getsentry/sentry-go/gin"
-	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
 
+	"ely.by/profilecerts/internal/logging"
 	"ely.by/profilecerts/internal/version"
 )
 
-func InitWithConfig(config *viper.Viper) error {
+type ErrorReporter struct{}
+
+// The tags are attached to all events, e.g. the storage backend in use
+func NewErrorReporterWithConfig(config *viper.Viper, tags map[string]string) (*ErrorReporter, error) {
+	err := initWithConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	sentry.ConfigureScope(func(scope *sentry.Scope) {
+		scope.SetTags(tags)
+	})
+
+	return &ErrorReporter{}, nil
+}
+
+func initWithConfig(config *viper.Viper) error {
 	config.SetDefault("sentry.enable_tracing", false)
 	config.SetDefault("sentry.traces_sample_rate", 1.0)
 
@@ -25,8 +44,10 @@ func InitWithConfig(config *viper.Viper) error {
 
 			return sampleRate
 		},
-		Release:     version.Version(),
-		Environment: config.GetString("sentry.environment"),
+		Release:          version.Version(),
+		Environment:      config.GetString("sentry.environment"),
+		BeforeSend:       scrubEvent,
+		BeforeBreadcrumb: scrubBreadcrumb,
 		Integrations: func(integrations []sentry.Integration) []sentry.Integration {
 			nDeleted := 0
 			for i, integration := range integrations {
@@ -41,16 +62,74 @@ func InitWithConfig(config *viper.Viper) error {
 	})
 }
 
-// It seems like this must be a part of the sentrygin package, but it is not, so implement it ourselves
-func ErrorMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		sentryHub := sentryGin.GetHubFromContext(c)
-		if sentryHub != nil {
-			return
-		}
+// Does the same as the sentrygin middleware: each request gets its own hub and transaction
+func (r *ErrorReporter) StartRequest(ctx context.Context, req *http.Request, route string) (context.Context, func(status int)) {
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub().Clone()
+		ctx = sentry.SetHubOnContext(ctx, hub)
+	}
+
+	transaction := sentry.StartTransaction(
+		ctx,
+		req.Method+" "+route,
+		sentry.WithOpName("http.server"),
+		sentry.ContinueFromRequest(req),
+		sentry.WithTransactionSource(sentry.SourceRoute),
+	)
+	transaction.SetData("http.request.method", req.Method)
+	hub.Scope().SetRequest(req)
+
+	return transaction.Context(), func(status int) {
+		transaction.Status = sentry.HTTPtoSpanStatus(status)
+		transaction.SetData("http.response.status_code", status)
+		transaction.Finish()
+	}
+}
+
+func (r *ErrorReporter) SetUser(ctx context.Context, id string) {
+	if hub := sentry.GetHubFromContext(ctx); hub != nil {
+		hub.Scope().SetUser(sentry.User{ID: id})
+	}
+}
+
+func (r *ErrorReporter) SetTag(ctx context.Context, key string, value string) {
+	if hub := sentry.GetHubFromContext(ctx); hub != nil {
+		hub.Scope().SetTag(key, value)
+	}
+}
+
+func (r *ErrorReporter) AddBreadcrumb(ctx context.Context, breadcrumb logging.Breadcrumb) {
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		return
+	}
 
-		for _, err := range c.Errors {
-			sentryHub.CaptureException(err)
-		}
+	level := sentry.LevelInfo
+	if breadcrumb.IsError {
+		level = sentry.LevelError
 	}
+
+	hub.AddBreadcrumb(&sentry.Breadcrumb{
+		Category: breadcrumb.Category,
+		Message:  breadcrumb.Message,
+		Level:    level,
+		Data:     breadcrumb.Data,
+	}, nil)
+}
+
+func (r *ErrorReporter) CaptureError(ctx context.Context, err error) {
+	if hub := sentry.GetHubFromContext(ctx); hub != nil {
+		hub.CaptureException(err)
+	}
+}
+
+func (r *ErrorReporter) CapturePanic(ctx context.Context, recovered interface{}) {
+	if hub := sentry.GetHubFromContext(ctx); hub != nil {
+		hub.RecoverWithContext(ctx, recovered)
+	}
+}
+
+func (r *ErrorReporter) Flush(timeout time.Duration) {
+	sentry.Flush(timeout)
 }
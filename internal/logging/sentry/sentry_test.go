@@ -0,0 +1,97 @@
+package sentry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+
+	"ely.by/profilecerts/internal/logging"
+)
+
+type transportStub struct {
+	mu     sync.Mutex
+	events []*sentry.Event
+}
+
+func (t *transportStub) Flush(timeout time.Duration) bool {
+	return true
+}
+
+func (t *transportStub) Configure(options sentry.ClientOptions) {
+}
+
+func (t *transportStub) SendEvent(event *sentry.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.events = append(t.events, event)
+}
+
+// Binds a client with the stub transport to the current hub, which is cloned for each request
+func useTransportStub(t *testing.T) *transportStub {
+	t.Helper()
+
+	transport := &transportStub{}
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:        "https://public@sentry.example.com/1",
+		Transport:  transport,
+		BeforeSend: scrubEvent,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub := sentry.CurrentHub()
+	previous := hub.Client()
+	hub.BindClient(client)
+	t.Cleanup(func() {
+		hub.BindClient(previous)
+	})
+
+	return transport
+}
+
+func TestErrorReporter(t *testing.T) {
+	const uuid = "a2a65ee9-a8a6-4bd4-98ab-3c2d11bb1cbb"
+	transport := useTransportStub(t)
+	reporter := &ErrorReporter{}
+
+	req := httptest.NewRequest(http.MethodPost, "/certificates", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	ctx, finish := reporter.StartRequest(context.Background(), req, "/certificates")
+	reporter.SetUser(ctx, uuid)
+	reporter.SetTag(ctx, "authreader", "elyby")
+	reporter.AddBreadcrumb(ctx, logging.Breadcrumb{Category: "certificates", Message: "keypair", IsError: true})
+	reporter.CaptureError(ctx, errors.New("redis is down"))
+	finish(http.StatusServiceUnavailable)
+
+	// Each request has its own hub, so the values don't leak into other events
+	reporter.CaptureError(context.Background(), errors.New("outside of a request"))
+
+	if len(transport.events) != 1 {
+		t.Fatalf("expected a single event, got %d", len(transport.events))
+	}
+
+	event := transport.events[0]
+	if len(event.Exception) == 0 || event.Exception[len(event.Exception)-1].Value != "redis is down" {
+		t.Errorf("expected the error to be captured, got %+v", event.Exception)
+	}
+
+	if event.User.ID != uuid || event.Tags["authreader"] != "elyby" {
+		t.Errorf("expected the event to be enriched, got %+v %v", event.User, event.Tags)
+	}
+
+	if len(event.Breadcrumbs) != 1 || event.Breadcrumbs[0].Level != sentry.LevelError {
+		t.Errorf("expected the error breadcrumb, got %+v", event.Breadcrumbs)
+	}
+
+	if authorization, found := event.Request.Headers["Authorization"]; found && authorization != filtered {
+		t.Errorf("expected the Authorization header not to be sent, got %s", authorization)
+	}
+}
@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"ely.by/profilecerts/internal/logging"
+)
+
+// Reports errors as exception events of the current span, so it needs tracing to be enabled.
+// Breadcrumbs become span events and the user and tags become span attributes
+type ErrorReporter struct {
+	tags []attribute.KeyValue
+}
+
+// The tags are attached to all exception events, e.g. the storage backend in use
+func NewErrorReporter(tags map[string]string) *ErrorReporter {
+	attributes := make([]attribute.KeyValue, 0, len(tags))
+	for key, value := range tags {
+		attributes = append(attributes, attribute.String(key, value))
+	}
+
+	return &ErrorReporter{attributes}
+}
+
+// The server span is started by the tracing middleware, so there is nothing to do here
+func (r *ErrorReporter) StartRequest(ctx context.Context, _ *http.Request, _ string) (context.Context, func(int)) {
+	return ctx, func(int) {}
+}
+
+func (r *ErrorReporter) SetUser(ctx context.Context, id string) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("enduser.id", id))
+}
+
+func (r *ErrorReporter) SetTag(ctx context.Context, key string, value string) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String(key, value))
+}
+
+func (r *ErrorReporter) AddBreadcrumb(ctx context.Context, breadcrumb logging.Breadcrumb) {
+	attributes := make([]attribute.KeyValue, 0, len(breadcrumb.Data)+2)
+	attributes = append(attributes,
+		attribute.String("breadcrumb.category", breadcrumb.Category),
+		attribute.Bool("breadcrumb.error", breadcrumb.IsError),
+	)
+	for key, value := range breadcrumb.Data {
+		attributes = append(attributes, attribute.String("breadcrumb.data."+key, fmt.Sprint(value)))
+	}
+
+	trace.SpanFromContext(ctx).AddEvent(breadcrumb.Message, trace.WithAttributes(attributes...))
+}
+
+func (r *ErrorReporter) CaptureError(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err, trace.WithAttributes(r.tags...))
+	span.SetStatus(codes.Error, err.Error())
+}
+
+func (r *ErrorReporter) CapturePanic(ctx context.Context, recovered interface{}) {
+	err := fmt.Errorf("panic: %v", recovered)
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err, trace.WithAttributes(r.tags...), trace.WithStackTrace(true))
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Spans are flushed when the tracer provider is shut down
+func (r *ErrorReporter) Flush(time.Duration) {}
@@ -0,0 +1,51 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"ely.by/profilecerts/internal/logging"
+)
+
+func TestErrorReporter(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	reporter := NewErrorReporter(map[string]string{"storage": "redis"})
+
+	ctx, span := provider.Tracer("test").Start(context.Background(), "POST /certificates")
+	reporter.SetUser(ctx, "a2a65ee9-a8a6-4bd4-98ab-3c2d11bb1cbb")
+	reporter.AddBreadcrumb(ctx, logging.Breadcrumb{Category: "certificates", Message: "keypair", Data: map[string]interface{}{"duration_ms": 5}})
+	reporter.CaptureError(ctx, errors.New("redis is down"))
+	span.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected a single span, got %d", len(spans))
+	}
+
+	recorded := spans[0]
+	if recorded.Status().Code != codes.Error || recorded.Status().Description != "redis is down" {
+		t.Errorf("expected the error status, got %+v", recorded.Status())
+	}
+
+	attributes := attribute.NewSet(recorded.Attributes()...)
+	if value, _ := attributes.Value("enduser.id"); value.AsString() != "a2a65ee9-a8a6-4bd4-98ab-3c2d11bb1cbb" {
+		t.Errorf("expected the user attribute, got %v", recorded.Attributes())
+	}
+
+	events := recorded.Events()
+	if len(events) != 2 || events[0].Name != "keypair" || events[1].Name != "exception" {
+		t.Fatalf("expected the breadcrumb and the exception events, got %+v", events)
+	}
+
+	exceptionAttributes := attribute.NewSet(events[1].Attributes...)
+	if value, _ := exceptionAttributes.Value("storage"); value.AsString() != "redis" {
+		t.Errorf("expected the tags on the exception event, got %v", events[1].Attributes)
+	}
+}
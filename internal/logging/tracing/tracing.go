@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"ely.by/profilecerts/internal/version"
+)
+
+// Configures the global tracer provider and propagator. The propagator is set up even when tracing is disabled,
+// so the incoming trace context is still passed to the Accounts. The returned function flushes pending spans
+func InitWithConfig(ctx context.Context, config *viper.Viper) (func(context.Context) error, error) {
+	config.SetDefault("tracing.enabled", false)
+	config.SetDefault("tracing.service_name", "profilecerts")
+	config.SetDefault("tracing.sample_rate", 1.0)
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if !config.GetBool("tracing.enabled") {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	// When the endpoint isn't set, the exporter uses the standard OTEL_EXPORTER_OTLP_* variables
+	var options []otlptracehttp.Option
+	if endpoint := config.GetString("tracing.endpoint"); endpoint != "" {
+		options = append(options, otlptracehttp.WithEndpointURL(endpoint))
+	}
+
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create an OTLP exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.GetFloat64("tracing.sample_rate")))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", config.GetString("tracing.service_name")),
+			attribute.String("service.version", version.Version()),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
@@ -2,81 +2,204 @@ package accounts
 
 import (
 	"context"
-	"crypto"
-	"crypto/x509"
-	"encoding/pem"
+	"errors"
 	"fmt"
-	"io"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/goccy/go-json"
 	"github.com/spf13/viper"
+
+	"ely.by/profilecerts/internal/services/authreader"
 )
 
 type Accounts struct {
-	baseUrl    string
-	httpClient *http.Client
+	baseUrl            string
+	publicKeysPath     string
+	revocationListPath string
+	client             *Client
+
+	// Validators of the last successfully fetched public keys document
+	publicKeysMu           sync.Mutex
+	publicKeysEtag         string
+	publicKeysLastModified string
 }
 
-func New(baseUrl string, httpClient *http.Client) *Accounts {
+func New(baseUrl string, publicKeysPath string, revocationListPath string, client *Client) *Accounts {
 	return &Accounts{
-		baseUrl,
-		httpClient,
+		baseUrl:            baseUrl,
+		publicKeysPath:     publicKeysPath,
+		revocationListPath: revocationListPath,
+		client:             client,
 	}
 }
 
 func NewWithConfig(config *viper.Viper) (*Accounts, error) {
 	config.SetDefault("accounts.url", "https://account.ely.by")
+	config.SetDefault("accounts.public_keys_path", "/api/public-keys")
+	config.SetDefault("accounts.revocation_list_path", "/api/revoked-tokens")
 	accountsUrl := strings.Trim(config.GetString("accounts.url"), "/")
+	publicKeysPath := "/" + strings.TrimLeft(config.GetString("accounts.public_keys_path"), "/")
+	revocationListPath := "/" + strings.TrimLeft(config.GetString("accounts.revocation_list_path"), "/")
 
-	return New(accountsUrl, &http.Client{}), nil
+	return New(accountsUrl, publicKeysPath, revocationListPath, NewClientWithConfig(config)), nil
 }
 
 type publicKeysResponse struct {
-	Keys []struct {
-		Alg string `json:"alg"`
-		Pem string `json:"pem"`
-	} `json:"keys"`
+	Keys []jsonWebKey `json:"keys"`
 }
 
-func (a *Accounts) GetPublicKeys(ctx context.Context) ([]crypto.PublicKey, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/api/public-keys", a.baseUrl), nil)
-	if err != nil {
-		return nil, fmt.Errorf("unable to form a correct request to Accounts: %w", err)
+// Supports both the Accounts' own /api/public-keys format and a standard JWKS document.
+// The request is conditional, so when the document hasn't changed since the previous call,
+// the returned set is marked as unchanged and contains no keys
+func (a *Accounts) GetPublicKeys(ctx context.Context) (*authreader.PublicKeySet, error) {
+	keys, err := a.getPublicKeys(ctx)
+	switch {
+	case err != nil:
+		publicKeysFetches.WithLabelValues("error").Inc()
+	case keys.Unchanged:
+		publicKeysFetches.WithLabelValues("not_modified").Inc()
+	default:
+		publicKeysFetches.WithLabelValues("fetched").Inc()
 	}
 
-	resp, err := a.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("unable to perform a request to Accounts: %w", err)
+	return keys, err
+}
+
+func (a *Accounts) getPublicKeys(ctx context.Context) (*authreader.PublicKeySet, error) {
+	header := http.Header{}
+	a.publicKeysMu.Lock()
+	if a.publicKeysEtag != "" {
+		header.Set("If-None-Match", a.publicKeysEtag)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("received unexpected response code from accounts: %d", resp.StatusCode)
+	if a.publicKeysLastModified != "" {
+		header.Set("If-Modified-Since", a.publicKeysLastModified)
 	}
+	a.publicKeysMu.Unlock()
 
-	body, err := io.ReadAll(resp.Body)
+	resp, err := a.client.get(ctx, "get_public_keys", a.baseUrl+a.publicKeysPath, header)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read response from Accounts: %w", err)
+		return nil, err
+	}
+
+	maxAge := parseMaxAge(resp.header.Get("Cache-Control"))
+	if resp.statusCode == http.StatusNotModified {
+		return &authreader.PublicKeySet{Unchanged: true, MaxAge: maxAge}, nil
+	}
+
+	if resp.statusCode != http.StatusOK {
+		return nil, fmt.Errorf("received unexpected response code from accounts: %d", resp.statusCode)
 	}
 
 	var keys publicKeysResponse
-	err = json.UnmarshalContext(ctx, body, &keys)
+	err = json.UnmarshalContext(ctx, resp.body, &keys)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse json response: %w", err)
 	}
 
-	result := make([]crypto.PublicKey, len(keys.Keys))
+	var lastErr error
+	result := make([]*authreader.PublicKey, 0, len(keys.Keys))
 	for i, key := range keys.Keys {
-		block, _ := pem.Decode([]byte(key.Pem))
-		if block == nil {
-			return nil, fmt.Errorf("unable to decode pem block")
+		// Keys intended for encryption can't be used to verify tokens
+		if key.Use != "" && key.Use != "sig" {
+			continue
 		}
 
-		result[i], err = x509.ParsePKIXPublicKey(block.Bytes)
+		// A key of a new type or algorithm shouldn't break verification with the rest of them
+		publicKey, err := key.publicKey()
 		if err != nil {
-			return nil, fmt.Errorf("unable to parse a public key: %w", err)
+			lastErr = fmt.Errorf("unable to decode key #%d: %w", i, err)
+			slog.WarnContext(ctx, "skipping an Accounts public key that can't be decoded", slog.Any("err", err), slog.String("kid", key.Kid))
+			continue
 		}
+
+		result = append(result, &authreader.PublicKey{
+			Kid: key.Kid,
+			Alg: key.Alg,
+			Key: publicKey,
+		})
+	}
+
+	// An empty set would reject all tokens, so it's treated as a failed fetch
+	if len(result) == 0 {
+		if lastErr != nil {
+			return nil, fmt.Errorf("the document has no usable keys: %w", lastErr)
+		}
+
+		return nil, errors.New("the document has no usable keys")
+	}
+
+	// Validators are stored only after the document has been successfully parsed,
+	// otherwise a broken document would be reported as unchanged until it's updated
+	a.publicKeysMu.Lock()
+	a.publicKeysEtag = resp.header.Get("ETag")
+	a.publicKeysLastModified = resp.header.Get("Last-Modified")
+	a.publicKeysMu.Unlock()
+
+	return &authreader.PublicKeySet{Keys: result, MaxAge: maxAge}, nil
+}
+
+// Returns 0 when the header has no max-age directive and authreader.MaxAgeRevalidate when it forbids
+// using the document without revalidation
+func parseMaxAge(cacheControl string) time.Duration {
+	var maxAge time.Duration
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache":
+			return authreader.MaxAgeRevalidate
+		case "max-age":
+			seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil || seconds < 0 {
+				continue
+			}
+
+			if seconds == 0 {
+				return authreader.MaxAgeRevalidate
+			}
+
+			maxAge = time.Duration(seconds) * time.Second
+		}
+	}
+
+	return maxAge
+}
+
+type revocationListResponse struct {
+	Tokens   []string `json:"tokens"`
+	Accounts []struct {
+		Uuid          string `json:"uuid"`
+		RevokedBefore int64  `json:"revokedBefore"`
+	} `json:"accounts"`
+}
+
+func (a *Accounts) GetRevocationList(ctx context.Context) (*authreader.RevocationList, error) {
+	resp, err := a.client.get(ctx, "get_revocation_list", a.baseUrl+a.revocationListPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.statusCode != http.StatusOK {
+		return nil, fmt.Errorf("received unexpected response code from accounts: %d", resp.statusCode)
+	}
+
+	var list revocationListResponse
+	err = json.UnmarshalContext(ctx, resp.body, &list)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse json response: %w", err)
+	}
+
+	result := &authreader.RevocationList{
+		TokenIds: list.Tokens,
+		Accounts: make(map[string]time.Time, len(list.Accounts)),
+	}
+	for _, account := range list.Accounts {
+		result.Accounts[account.Uuid] = time.Unix(account.RevokedBefore, 0)
 	}
 
 	return result, nil
@@ -0,0 +1,232 @@
+package accounts
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ely.by/profilecerts/internal/services/authreader"
+)
+
+func encodeBigInt(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+func serveDocument(t *testing.T, document interface{}) *Accounts {
+	t.Helper()
+
+	body, err := json.Marshal(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/public-keys" && r.URL.Path != "/api/revoked-tokens" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+
+	return New(server.URL, "/api/public-keys", "/api/revoked-tokens", newTestClient())
+}
+
+func TestGetPublicKeysJwks(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts := serveDocument(t, map[string]interface{}{
+		"keys": []map[string]string{
+			{"kid": "rsa", "alg": "RS256", "use": "sig", "kty": "RSA", "n": encodeBigInt(rsaKey.N), "e": encodeBigInt(big.NewInt(int64(rsaKey.E)))},
+			{"kid": "ec", "alg": "ES256", "kty": "EC", "crv": "P-256", "x": encodeBigInt(ecKey.X), "y": encodeBigInt(ecKey.Y)},
+			{"kid": "ed", "alg": "EdDSA", "kty": "OKP", "crv": "Ed25519", "x": base64.RawURLEncoding.EncodeToString(edPublicKey)},
+			{"kid": "enc", "use": "enc", "kty": "RSA", "n": encodeBigInt(rsaKey.N), "e": encodeBigInt(big.NewInt(int64(rsaKey.E)))},
+			{"kid": "x448", "kty": "OKP", "crv": "X448", "x": "AAAA"},
+			{"kid": "off-curve", "kty": "EC", "crv": "P-256", "x": encodeBigInt(big.NewInt(1)), "y": encodeBigInt(big.NewInt(1))},
+		},
+	})
+
+	set, err := accounts.GetPublicKeys(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	keys := set.Keys
+
+	if len(keys) != 3 {
+		t.Fatalf("expected 3 keys, got %d", len(keys))
+	}
+
+	if keys[0].Kid != "rsa" || keys[0].Alg != "RS256" || !rsaKey.PublicKey.Equal(keys[0].Key) {
+		t.Errorf("unexpected RSA key %+v", keys[0])
+	}
+
+	if keys[1].Kid != "ec" || keys[1].Alg != "ES256" || !ecKey.PublicKey.Equal(keys[1].Key) {
+		t.Errorf("unexpected EC key %+v", keys[1])
+	}
+
+	if keys[2].Kid != "ed" || keys[2].Alg != "EdDSA" || !edPublicKey.Equal(keys[2].Key) {
+		t.Errorf("unexpected Ed25519 key %+v", keys[2])
+	}
+}
+
+func TestGetPublicKeysPem(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts := serveDocument(t, map[string]interface{}{
+		"keys": []map[string]string{
+			{"alg": "ES256", "pem": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))},
+		},
+	})
+
+	set, err := accounts.GetPublicKeys(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	keys := set.Keys
+
+	if len(keys) != 1 || keys[0].Alg != "ES256" || !ecKey.PublicKey.Equal(keys[0].Key) {
+		t.Fatalf("unexpected keys %+v", keys)
+	}
+}
+
+func TestGetPublicKeysWithoutUsableKeys(t *testing.T) {
+	accounts := serveDocument(t, map[string]interface{}{
+		"keys": []map[string]string{
+			{"kid": "x448", "kty": "OKP", "crv": "X448", "x": "AAAA"},
+			{"alg": "RS256", "pem": "not a pem"},
+		},
+	})
+
+	_, err := accounts.GetPublicKeys(context.Background())
+	if err == nil {
+		t.Fatal("expected an error for the document without usable keys")
+	}
+}
+
+func TestGetRevocationList(t *testing.T) {
+	accounts := serveDocument(t, map[string]interface{}{
+		"tokens": []string{"jti-1", "jti-2"},
+		"accounts": []map[string]interface{}{
+			{"uuid": "a2a65ee9-a8a6-4bd4-98ab-3c2d11bb1cbb", "revokedBefore": 1717243200},
+		},
+	})
+
+	list, err := accounts.GetRevocationList(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(list.TokenIds) != 2 || list.TokenIds[0] != "jti-1" || list.TokenIds[1] != "jti-2" {
+		t.Errorf("unexpected token ids %v", list.TokenIds)
+	}
+
+	revokedBefore := list.Accounts["a2a65ee9-a8a6-4bd4-98ab-3c2d11bb1cbb"]
+	if !revokedBefore.Equal(time.Unix(1717243200, 0)) {
+		t.Errorf("unexpected account revocation time %s", revokedBefore)
+	}
+}
+
+func TestGetPublicKeysConditionally(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kid": "ec", "alg": "ES256", "kty": "EC", "crv": "P-256", "x": encodeBigInt(ecKey.X), "y": encodeBigInt(ecKey.Y)},
+		},
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=600")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+
+	accounts := New(server.URL, "/api/public-keys", "/api/revoked-tokens", newTestClient())
+	fetched := testutil.ToFloat64(publicKeysFetches.WithLabelValues("fetched"))
+	notModified := testutil.ToFloat64(publicKeysFetches.WithLabelValues("not_modified"))
+
+	set, err := accounts.GetPublicKeys(context.Background())
+	if err != nil || set.Unchanged || len(set.Keys) != 1 || set.MaxAge != 10*time.Minute {
+		t.Fatalf("expected the fetched set with the max age, got %+v %v", set, err)
+	}
+
+	set, err = accounts.GetPublicKeys(context.Background())
+	if err != nil || !set.Unchanged || len(set.Keys) != 0 || set.MaxAge != 10*time.Minute {
+		t.Fatalf("expected the unchanged set with the max age, got %+v %v", set, err)
+	}
+
+	if actual := testutil.ToFloat64(publicKeysFetches.WithLabelValues("fetched")) - fetched; actual != 1 {
+		t.Errorf("expected a single fetched set to be counted, got %v", actual)
+	}
+
+	if actual := testutil.ToFloat64(publicKeysFetches.WithLabelValues("not_modified")) - notModified; actual != 1 {
+		t.Errorf("expected a single unchanged set to be counted, got %v", actual)
+	}
+}
+
+func TestParseMaxAge(t *testing.T) {
+	testCases := map[string]time.Duration{
+		"":                             0,
+		"public":                       0,
+		"max-age=600":                  10 * time.Minute,
+		"public, max-age=\"60\"":       time.Minute,
+		"max-age=invalid":              0,
+		"max-age=-1":                   0,
+		"max-age=0":                    authreader.MaxAgeRevalidate,
+		"no-cache":                     authreader.MaxAgeRevalidate,
+		"max-age=600, no-store":        authreader.MaxAgeRevalidate,
+		"Max-Age=600, must-revalidate": 10 * time.Minute,
+	}
+	for cacheControl, expected := range testCases {
+		if actual := parseMaxAge(cacheControl); actual != expected {
+			t.Errorf("expected %s for %q, got %s", expected, cacheControl, actual)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sony/gobreaker"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type ClientOptions struct {
+	ConnectTimeout time.Duration
+	// Limits each attempt, including reading the response body
+	Timeout time.Duration
+	// Includes the first attempt
+	MaxAttempts int
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	MaxBodySize int64
+	// The number of consecutive failed attempts after which requests stop being sent
+	BreakerFailures uint32
+	// How long the breaker stays open before letting a probe request through
+	BreakerOpenTimeout time.Duration
+}
+
+// An HTTP client for idempotent requests to the Accounts that retries failed attempts
+// and stops sending requests at all while the Accounts keeps failing
+type Client struct {
+	httpClient *http.Client
+	breaker    *gobreaker.CircuitBreaker
+	options    ClientOptions
+}
+
+type response struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+}
+
+// Returned for 5xx and 429 responses
+type statusError struct {
+	statusCode int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("received unexpected response code from accounts: %d", e.statusCode)
+}
+
+var errBodyTooLarge = errors.New("the response body is too large")
+
+func NewClient(options ClientOptions) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   options.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.MaxIdleConnsPerHost = 10
+
+	breaker := gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Name:    "accounts",
+		Timeout: options.BreakerOpenTimeout,
+		// A request cancelled by the caller says nothing about the Accounts health
+		IsSuccessful: func(err error) bool {
+			return err == nil || errors.Is(err, context.Canceled)
+		},
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= options.BreakerFailures
+		},
+		OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
+			breakerState.Set(float64(to))
+		},
+	})
+
+	return &Client{
+		httpClient: &http.Client{Transport: transport, Timeout: options.Timeout},
+		breaker:    breaker,
+		options:    options,
+	}
+}
+
+func NewClientWithConfig(config *viper.Viper) *Client {
+	config.SetDefault("accounts.client.connect_timeout", 2*time.Second)
+	config.SetDefault("accounts.client.timeout", 5*time.Second)
+	config.SetDefault("accounts.client.max_attempts", 3)
+	config.SetDefault("accounts.client.backoff_base", 100*time.Millisecond)
+	config.SetDefault("accounts.client.backoff_max", 2*time.Second)
+	config.SetDefault("accounts.client.max_body_size", 1<<20)
+	config.SetDefault("accounts.client.breaker_failures", 5)
+	config.SetDefault("accounts.client.breaker_open_timeout", 30*time.Second)
+
+	return NewClient(ClientOptions{
+		ConnectTimeout:     config.GetDuration("accounts.client.connect_timeout"),
+		Timeout:            config.GetDuration("accounts.client.timeout"),
+		MaxAttempts:        config.GetInt("accounts.client.max_attempts"),
+		BackoffBase:        config.GetDuration("accounts.client.backoff_base"),
+		BackoffMax:         config.GetDuration("accounts.client.backoff_max"),
+		MaxBodySize:        config.GetInt64("accounts.client.max_body_size"),
+		BreakerFailures:    config.GetUint32("accounts.client.breaker_failures"),
+		BreakerOpenTimeout: config.GetDuration("accounts.client.breaker_open_timeout"),
+	})
+}
+
+// Performs a GET request. Only network errors, 5xx and 429 responses are retried,
+// any other response is returned to the caller as is
+func (c *Client) get(ctx context.Context, operation string, url string, header http.Header) (*response, error) {
+	ctx, span := tracer.Start(ctx, "accounts."+operation, trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		var resp *response
+		resp, err = c.attempt(ctx, url, header)
+		requestDuration.WithLabelValues(operation, resultLabel(resp, err)).Observe(time.Since(start).Seconds())
+		if err == nil {
+			span.SetAttributes(
+				attribute.Int("http.response.status_code", resp.statusCode),
+				attribute.Int("http.request.resend_count", attempt-1),
+			)
+
+			return resp, nil
+		}
+
+		if !isRetryable(err) || attempt >= c.options.MaxAttempts {
+			break
+		}
+
+		retries.WithLabelValues(operation).Inc()
+
+		select {
+		case <-time.After(c.backoff(attempt)):
+		case <-ctx.Done():
+			err = ctx.Err()
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+
+			return nil, err
+		}
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	return nil, err
+}
+
+func (c *Client) attempt(ctx context.Context, url string, header http.Header) (*response, error) {
+	result, err := c.breaker.Execute(func() (interface{}, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("unable to form a correct request to Accounts: %w", err)
+		}
+
+		for name, values := range header {
+			req.Header[name] = values
+		}
+
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("unable to perform a request to Accounts: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			// Drain the body, so the connection can be reused
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, c.options.MaxBodySize))
+
+			return nil, &statusError{resp.StatusCode}
+		}
+
+		body, err := io.ReadAll(io.LimitReader(resp.Body, c.options.MaxBodySize+1))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read response from Accounts: %w", err)
+		}
+
+		if int64(len(body)) > c.options.MaxBodySize {
+			return nil, errBodyTooLarge
+		}
+
+		return &response{resp.StatusCode, resp.Header, body}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*response), nil
+}
+
+// Full jitter, see https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+func (c *Client) backoff(attempt int) time.Duration {
+	backoff := c.options.BackoffBase << (attempt - 1)
+	if backoff <= 0 || backoff > c.options.BackoffMax {
+		backoff = c.options.BackoffMax
+	}
+
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+func isRetryable(err error) bool {
+	// There is no point in retrying while the breaker doesn't let requests through
+	if errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests) {
+		return false
+	}
+
+	if errors.Is(err, errBodyTooLarge) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	return true
+}
+
+func resultLabel(resp *response, err error) string {
+	var statusErr *statusError
+	switch {
+	case err == nil:
+		return fmt.Sprintf("%d", resp.statusCode)
+	case errors.As(err, &statusErr):
+		return fmt.Sprintf("%d", statusErr.statusCode)
+	case errors.Is(err, gobreaker.ErrOpenState), errors.Is(err, gobreaker.ErrTooManyRequests):
+		return "breaker_open"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,134 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sony/gobreaker"
+)
+
+func newTestClient() *Client {
+	return NewClient(ClientOptions{
+		ConnectTimeout:     time.Second,
+		Timeout:            time.Second,
+		MaxAttempts:        3,
+		BackoffBase:        time.Millisecond,
+		BackoffMax:         time.Millisecond,
+		MaxBodySize:        1 << 16,
+		BreakerFailures:    5,
+		BreakerOpenTimeout: time.Minute,
+	})
+}
+
+// Responds with the statuses in order, repeating the last one
+func serveStatuses(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(calls.Add(1))
+		w.WriteHeader(statuses[min(call, len(statuses))-1])
+		_, _ = w.Write([]byte("{}"))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &calls
+}
+
+func TestClientRetries(t *testing.T) {
+	testCases := []struct {
+		name           string
+		statuses       []int
+		expectedStatus int
+		expectedCalls  int32
+	}{
+		{name: "success", statuses: []int{http.StatusOK}, expectedStatus: http.StatusOK, expectedCalls: 1},
+		{name: "retried server error", statuses: []int{http.StatusBadGateway, http.StatusTooManyRequests, http.StatusOK}, expectedStatus: http.StatusOK, expectedCalls: 3},
+		{name: "not retried client error", statuses: []int{http.StatusNotFound}, expectedStatus: http.StatusNotFound, expectedCalls: 1},
+		{name: "attempts are exhausted", statuses: []int{http.StatusServiceUnavailable}, expectedCalls: 3},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			server, calls := serveStatuses(t, testCase.statuses...)
+			resp, err := newTestClient().get(context.Background(), "test", server.URL, nil)
+			if testCase.expectedStatus == 0 {
+				var statusErr *statusError
+				if !errors.As(err, &statusErr) {
+					t.Fatalf("expected the status error, got %v", err)
+				}
+			} else if err != nil || resp.statusCode != testCase.expectedStatus {
+				t.Fatalf("expected the %d status, got %+v %v", testCase.expectedStatus, resp, err)
+			}
+
+			if actual := calls.Load(); actual != testCase.expectedCalls {
+				t.Fatalf("expected %d attempts, got %d", testCase.expectedCalls, actual)
+			}
+		})
+	}
+}
+
+func TestClientBodySizeLimit(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_, _ = w.Write([]byte(strings.Repeat("a", 1<<16+1)))
+	}))
+	defer server.Close()
+
+	_, err := newTestClient().get(context.Background(), "test", server.URL, nil)
+	if !errors.Is(err, errBodyTooLarge) {
+		t.Fatalf("expected the body too large error, got %v", err)
+	}
+
+	if actual := calls.Load(); actual != 1 {
+		t.Fatalf("expected the request not to be retried, got %d attempts", actual)
+	}
+}
+
+func TestClientBreaker(t *testing.T) {
+	server, calls := serveStatuses(t, http.StatusInternalServerError)
+	client := newTestClient()
+
+	// 3 attempts of the first request and 2 attempts of the second one open the breaker
+	for i := 0; i < 3; i++ {
+		_, _ = client.get(context.Background(), "test", server.URL, nil)
+	}
+
+	if actual := calls.Load(); actual != 5 {
+		t.Fatalf("expected the breaker to open after 5 failed attempts, got %d", actual)
+	}
+
+	_, err := client.get(context.Background(), "test", server.URL, nil)
+	if !errors.Is(err, gobreaker.ErrOpenState) {
+		t.Fatalf("expected the open breaker error, got %v", err)
+	}
+}
+
+func TestClientCancelledRequest(t *testing.T) {
+	server, calls := serveStatuses(t, http.StatusOK)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	client := newTestClient()
+	for i := 0; i < 10; i++ {
+		_, err := client.get(ctx, "test", server.URL, nil)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected the context error, got %v", err)
+		}
+	}
+
+	// Cancelled requests aren't retried and don't open the breaker
+	if _, err := client.get(context.Background(), "test", server.URL, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if actual := calls.Load(); actual != 1 {
+		t.Fatalf("expected a single request to reach the server, got %d", actual)
+	}
+}
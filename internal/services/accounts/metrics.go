@@ -0,0 +1,35 @@
+package accounts
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "profilecerts",
+	Subsystem: "accounts",
+	Name:      "request_duration_seconds",
+	Help:      "Duration of each attempt of requests to the Accounts, partitioned by the operation and the result",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"operation", "result"})
+
+var retries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "profilecerts",
+	Subsystem: "accounts",
+	Name:      "retries_total",
+	Help:      "The number of retried requests to the Accounts",
+}, []string{"operation"})
+
+var breakerState = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: "profilecerts",
+	Subsystem: "accounts",
+	Name:      "breaker_state",
+	Help:      "The state of the Accounts circuit breaker: 0 - closed, 1 - half-open, 2 - open",
+})
+
+var publicKeysFetches = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "profilecerts",
+	Subsystem: "accounts",
+	Name:      "public_keys_fetches_total",
+	Help:      "The number of public keys fetches, partitioned by the result: fetched, not_modified or error",
+}, []string{"result"})
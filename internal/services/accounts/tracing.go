@@ -0,0 +1,5 @@
+package accounts
+
+import "go.opentelemetry.io/otel"
+
+var tracer = otel.Tracer("ely.by/profilecerts/internal/services/accounts")
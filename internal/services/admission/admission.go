@@ -0,0 +1,179 @@
+package admission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Shedding reasons, used as values of the metric label
+const (
+	ReasonQueueFull     = "queue_full"
+	ReasonEstimatedWait = "estimated_wait"
+	ReasonQueueTimeout  = "queue_timeout"
+)
+
+// Retry-After is never less than this, so shed clients don't come back immediately
+const minRetryAfter = time.Second
+
+type Options struct {
+	// How many operations may run at once. 0 disables the limit
+	Concurrency int
+	// How many operations may wait for a slot at once. Operations above it are shed immediately
+	QueueSize int
+	// How long an operation may wait for a slot. Operations that aren't expected to get one in time
+	// (judging by how long the slots are usually held) are shed without waiting
+	QueueTimeout time.Duration
+}
+
+// Bounds the concurrency of CPU-bound operations and sheds the excess instead of letting it pile up
+type Limiter struct {
+	name string
+	Options
+	slots  chan struct{}
+	queued atomic.Int64
+	// Moving average of how long a slot is held, in nanoseconds
+	holdTime atomic.Int64
+}
+
+func New(name string, options Options) *Limiter {
+	var slots chan struct{}
+	if options.Concurrency > 0 {
+		slots = make(chan struct{}, options.Concurrency)
+	}
+
+	return &Limiter{name: name, Options: options, slots: slots}
+}
+
+// The name is the config section and the metrics label, e.g. key_generation
+func NewWithConfig(config *viper.Viper, name string) (*Limiter, error) {
+	config.SetDefault("admission."+name+".concurrency", runtime.GOMAXPROCS(0))
+	config.SetDefault("admission."+name+".queue_size", 100)
+	config.SetDefault("admission."+name+".queue_timeout", time.Second)
+
+	options := Options{
+		Concurrency:  config.GetInt("admission." + name + ".concurrency"),
+		QueueSize:    config.GetInt("admission." + name + ".queue_size"),
+		QueueTimeout: config.GetDuration("admission." + name + ".queue_timeout"),
+	}
+	if options.Concurrency < 0 || options.QueueSize < 0 || options.QueueTimeout < 0 {
+		return nil, fmt.Errorf("invalid admission.%s: values must not be negative", name)
+	}
+
+	return New(name, options), nil
+}
+
+// Waits for a free slot. The returned func must be called to free it once the operation is done.
+// Returns the *OverloadedError when the operation is shed and the ctx error when it's cancelled while waiting
+func (l *Limiter) Acquire(ctx context.Context) (func(), error) {
+	if l.slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.acquired(), nil
+	default:
+	}
+
+	queued := l.queued.Add(1)
+	queueLength.WithLabelValues(l.name).Inc()
+	defer func() {
+		l.queued.Add(-1)
+		queueLength.WithLabelValues(l.name).Dec()
+	}()
+
+	if queued > int64(l.QueueSize) {
+		return nil, l.shed(ReasonQueueFull)
+	}
+
+	budget := l.QueueTimeout
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < budget {
+		budget = time.Until(deadline)
+	}
+
+	if l.estimatedWait(queued) > budget {
+		return nil, l.shed(ReasonEstimatedWait)
+	}
+
+	start := time.Now()
+	timer := time.NewTimer(budget)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		queueWaitDuration.WithLabelValues(l.name).Observe(time.Since(start).Seconds())
+
+		return l.acquired(), nil
+	case <-timer.C:
+		queueWaitDuration.WithLabelValues(l.name).Observe(time.Since(start).Seconds())
+
+		return nil, l.shed(ReasonQueueTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *Limiter) acquired() func() {
+	inFlight.WithLabelValues(l.name).Inc()
+	start := time.Now()
+
+	return func() {
+		l.observeHoldTime(time.Since(start))
+		inFlight.WithLabelValues(l.name).Dec()
+		<-l.slots
+	}
+}
+
+func (l *Limiter) observeHoldTime(d time.Duration) {
+	for {
+		old := l.holdTime.Load()
+		updated := int64(d)
+		if old != 0 {
+			updated = old + (int64(d)-old)/8
+		}
+
+		if l.holdTime.CompareAndSwap(old, updated) {
+			return
+		}
+	}
+}
+
+// How long the operation at the position in the queue is expected to wait for a slot
+func (l *Limiter) estimatedWait(position int64) time.Duration {
+	return time.Duration(l.holdTime.Load() * position / int64(l.Concurrency))
+}
+
+func (l *Limiter) shed(reason string) *OverloadedError {
+	shedOperations.WithLabelValues(l.name, reason).Inc()
+
+	return &OverloadedError{
+		Limiter:    l.name,
+		Reason:     reason,
+		RetryAfter: max(l.estimatedWait(l.queued.Load()), minRetryAfter),
+	}
+}
+
+// Returned when the operation has been shed, because there are too many of them
+type OverloadedError struct {
+	Limiter string
+	Reason  string
+	// How long the queue is expected to drain
+	RetryAfter time.Duration
+}
+
+func (e *OverloadedError) Error() string {
+	return fmt.Sprintf("the %s operation has been shed: %s", e.Limiter, e.Reason)
+}
+
+func AsOverloadedError(err error) (*OverloadedError, bool) {
+	var overloadedError *OverloadedError
+	ok := errors.As(err, &overloadedError)
+
+	return overloadedError, ok
+}
@@ -0,0 +1,195 @@
+package admission
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestLimiterAcquire(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	testCases := []struct {
+		name    string
+		options Options
+		// The moving average of how long the slots are held
+		holdTime time.Duration
+		ctx      context.Context
+		// Expected reason of the shedding, empty when the ctx error is expected
+		expectedReason     string
+		expectedErr        error
+		expectedRetryAfter time.Duration
+	}{
+		{
+			name:               "queue is full",
+			options:            Options{Concurrency: 1, QueueSize: 0, QueueTimeout: time.Second},
+			ctx:                context.Background(),
+			expectedReason:     ReasonQueueFull,
+			expectedRetryAfter: minRetryAfter,
+		},
+		{
+			name:               "slot isn't expected to be freed in time",
+			options:            Options{Concurrency: 1, QueueSize: 10, QueueTimeout: time.Second},
+			holdTime:           3 * time.Second,
+			ctx:                context.Background(),
+			expectedReason:     ReasonEstimatedWait,
+			expectedRetryAfter: 3 * time.Second,
+		},
+		{
+			name:               "estimated wait is shared between slots",
+			options:            Options{Concurrency: 2, QueueSize: 10, QueueTimeout: 2 * time.Second},
+			holdTime:           5 * time.Second,
+			ctx:                context.Background(),
+			expectedReason:     ReasonEstimatedWait,
+			expectedRetryAfter: 2500 * time.Millisecond,
+		},
+		{
+			name:               "request deadline is shorter than the queue timeout",
+			options:            Options{Concurrency: 1, QueueSize: 10, QueueTimeout: time.Minute},
+			holdTime:           time.Second,
+			ctx:                withTimeout(t, 100*time.Millisecond),
+			expectedReason:     ReasonEstimatedWait,
+			expectedRetryAfter: time.Second,
+		},
+		{
+			name:               "queue timeout",
+			options:            Options{Concurrency: 1, QueueSize: 10, QueueTimeout: 20 * time.Millisecond},
+			holdTime:           time.Millisecond,
+			ctx:                context.Background(),
+			expectedReason:     ReasonQueueTimeout,
+			expectedRetryAfter: minRetryAfter,
+		},
+		{
+			name:        "cancelled while waiting",
+			options:     Options{Concurrency: 1, QueueSize: 10, QueueTimeout: time.Minute},
+			ctx:         cancelled,
+			expectedErr: context.Canceled,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			l := New("test", testCase.options)
+			l.holdTime.Store(int64(testCase.holdTime))
+
+			// All slots are busy
+			for i := 0; i < testCase.options.Concurrency; i++ {
+				release, err := l.Acquire(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				defer release()
+			}
+
+			release, err := l.Acquire(testCase.ctx)
+			if err == nil {
+				release()
+				t.Fatal("expected the operation not to get a slot")
+			}
+
+			if testCase.expectedErr != nil {
+				if !errors.Is(err, testCase.expectedErr) {
+					t.Fatalf("expected the %v error, got %v", testCase.expectedErr, err)
+				}
+
+				return
+			}
+
+			overloadedErr, ok := AsOverloadedError(err)
+			if !ok {
+				t.Fatalf("expected the overloaded error, got %v", err)
+			}
+
+			if overloadedErr.Reason != testCase.expectedReason || overloadedErr.Limiter != "test" {
+				t.Fatalf("expected the %s reason, got %s", testCase.expectedReason, overloadedErr.Reason)
+			}
+
+			if overloadedErr.RetryAfter != testCase.expectedRetryAfter {
+				t.Fatalf("expected to retry after %s, got %s", testCase.expectedRetryAfter, overloadedErr.RetryAfter)
+			}
+
+			if queued := l.queued.Load(); queued != 0 {
+				t.Fatalf("expected the shed operation to leave the queue, got %d queued", queued)
+			}
+		})
+	}
+}
+
+func withTimeout(t *testing.T, timeout time.Duration) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	t.Cleanup(cancel)
+
+	return ctx
+}
+
+func TestLimiterWaitsForReleasedSlot(t *testing.T) {
+	l := New("test", Options{Concurrency: 1, QueueSize: 1, QueueTimeout: time.Minute})
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan error)
+	go func() {
+		release, err := l.Acquire(context.Background())
+		if err == nil {
+			release()
+		}
+
+		acquired <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	release()
+
+	if err := <-acquired; err != nil {
+		t.Fatalf("expected the queued operation to get the released slot, got %v", err)
+	}
+}
+
+func TestLimiterHoldTimeAverage(t *testing.T) {
+	l := New("test", Options{Concurrency: 2})
+
+	// The first observation is taken as is, the next ones move the average by 1/8 of the difference
+	l.observeHoldTime(8 * time.Second)
+	if actual := time.Duration(l.holdTime.Load()); actual != 8*time.Second {
+		t.Fatalf("expected the first hold time, got %s", actual)
+	}
+
+	l.observeHoldTime(0)
+	if actual := time.Duration(l.holdTime.Load()); actual != 7*time.Second {
+		t.Fatalf("expected the moving average, got %s", actual)
+	}
+
+	// The queue is drained by all slots at once
+	if actual := l.estimatedWait(4); actual != 14*time.Second {
+		t.Fatalf("expected the wait of the 4th operation in the queue, got %s", actual)
+	}
+}
+
+func TestUnlimitedLimiter(t *testing.T) {
+	l := New("test", Options{})
+	for i := 0; i < 100; i++ {
+		_, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Fatalf("expected no limit, got %v", err)
+		}
+	}
+}
+
+func TestNewWithConfig(t *testing.T) {
+	config := viper.New()
+	l, err := NewWithConfig(config, "signing")
+	if err != nil || l.Concurrency < 1 || l.QueueSize != 100 || l.QueueTimeout != time.Second {
+		t.Fatalf("expected the defaults, got %+v %v", l, err)
+	}
+
+	config.Set("admission.signing.queue_size", -1)
+	if _, err := NewWithConfig(config, "signing"); err == nil {
+		t.Fatal("expected an error for the negative queue size")
+	}
+}
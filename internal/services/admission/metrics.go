@@ -0,0 +1,35 @@
+package admission
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var shedOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "profilecerts",
+	Subsystem: "admission",
+	Name:      "shed_operations_total",
+	Help:      "The number of operations rejected because of the overload, partitioned by the limiter and the reason: queue_full, estimated_wait or queue_timeout",
+}, []string{"limiter", "reason"})
+
+var queueWaitDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "profilecerts",
+	Subsystem: "admission",
+	Name:      "queue_wait_duration_seconds",
+	Help:      "How long operations have waited for a free slot, partitioned by the limiter",
+	Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+}, []string{"limiter"})
+
+var inFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "profilecerts",
+	Subsystem: "admission",
+	Name:      "in_flight_operations",
+	Help:      "The number of running operations, partitioned by the limiter",
+}, []string{"limiter"})
+
+var queueLength = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "profilecerts",
+	Subsystem: "admission",
+	Name:      "queued_operations",
+	Help:      "The number of operations waiting for a free slot, partitioned by the limiter",
+}, []string{"limiter"})
@@ -0,0 +1,287 @@
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"ely.by/profilecerts/internal/logging"
+)
+
+const (
+	// A new key has been generated for the player on their request
+	EventCertificateIssued = "certificate.issued"
+	// A new key has been generated by an admin even though the previous one was still valid
+	EventCertificateRotated = "certificate.rotated"
+	EventCertificateRevoked = "certificate.revoked"
+	EventCertificatesListed = "admin.certificates_listed"
+	EventCertificateViewed  = "admin.certificate_viewed"
+)
+
+const (
+	ActorPlayer = "player"
+	// Events without an origin in the context are caused by the service itself
+	ActorSystem = "system"
+)
+
+type Event struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	// The player's uuid the event is about. Empty for events that don't concern a single player
+	Uuid string `json:"uuid,omitempty"`
+	// Either ActorPlayer, ActorSystem or ServiceActor of the service that has performed an admin action
+	Actor        string     `json:"actor"`
+	Ip           string     `json:"ip,omitempty"`
+	RequestId    string     `json:"requestId,omitempty"`
+	AuthReader   string     `json:"authReader,omitempty"`
+	TokenSubject string     `json:"tokenSubject,omitempty"`
+	TokenId      string     `json:"tokenId,omitempty"`
+	Reason       string     `json:"reason,omitempty"`
+	Fingerprint  string     `json:"fingerprint,omitempty"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+}
+
+type Sink interface {
+	Write(ctx context.Context, event *Event) error
+}
+
+// Describes who has caused the events recorded with the context
+type Origin struct {
+	Actor        string
+	Ip           string
+	AuthReader   string
+	TokenSubject string
+	TokenId      string
+	Reason       string
+}
+
+type originKey struct{}
+
+func ServiceActor(name string) string {
+	return "service:" + name
+}
+
+func WithOrigin(ctx context.Context, origin Origin) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+func OriginFromContext(ctx context.Context) (Origin, bool) {
+	origin, ok := ctx.Value(originKey{}).(Origin)
+
+	return origin, ok
+}
+
+// Explains why the events recorded with the returned context have happened.
+// Does nothing when there is no origin in the ctx
+func WithReason(ctx context.Context, reason string) context.Context {
+	origin, ok := OriginFromContext(ctx)
+	if !ok {
+		return ctx
+	}
+
+	origin.Reason = reason
+
+	return WithOrigin(ctx, origin)
+}
+
+type Options struct {
+	// When set, uuids and token subjects are replaced with their HMAC-SHA256 using this key,
+	// so events about the same player can be correlated without revealing who the player is
+	HashKey []byte
+	// Keeps only the /24 network of IPv4 and the /48 network of IPv6 addresses
+	TruncateIps bool
+	// The number of events waiting to be written to the sink. When the queue is full, new events are dropped,
+	// so a slow sink doesn't hold up serving certificates
+	QueueSize int
+}
+
+// Limits writes to the sink, because they are detached from the request's cancellation
+const writeTimeout = 5 * time.Second
+
+type queuedEvent struct {
+	ctx   context.Context
+	event *Event
+}
+
+type Log struct {
+	sink    Sink
+	options Options
+
+	mu      sync.RWMutex
+	closed  bool
+	queue   chan queuedEvent
+	drained chan struct{}
+}
+
+// The sink may be nil, then the events are discarded. Otherwise, the events are written by a background worker
+// until the Close is called
+func New(sink Sink, options Options) *Log {
+	l := &Log{sink: sink, options: options}
+	if sink != nil {
+		l.queue = make(chan queuedEvent, max(options.QueueSize, 1))
+		l.drained = make(chan struct{})
+		go l.run()
+	}
+
+	return l
+}
+
+func NewWithConfig(config *viper.Viper, sink Sink) (*Log, error) {
+	config.SetDefault("audit.hash_uuids", false)
+	config.SetDefault("audit.truncate_ips", false)
+	config.SetDefault("audit.queue_size", 10000)
+
+	options := Options{
+		TruncateIps: config.GetBool("audit.truncate_ips"),
+		QueueSize:   config.GetInt("audit.queue_size"),
+	}
+	if config.GetBool("audit.hash_uuids") {
+		hashKey := config.GetString("audit.hash_key")
+		if hashKey == "" {
+			return nil, errors.New("audit.hash_key must be set to hash uuids")
+		}
+
+		options.HashKey = []byte(hashKey)
+	}
+
+	return New(sink, options), nil
+}
+
+// Fills the event with the origin from the context and queues it for writing to the sink. Dropped events
+// and write failures are only counted and logged, so an unavailable sink doesn't break serving certificates
+func (l *Log) Record(ctx context.Context, event *Event) {
+	if l.sink == nil {
+		return
+	}
+
+	event.Time = time.Now()
+	event.RequestId = logging.RequestId(ctx)
+	event.Actor = ActorSystem
+	if origin, ok := OriginFromContext(ctx); ok {
+		event.Actor = origin.Actor
+		event.Ip = origin.Ip
+		event.AuthReader = origin.AuthReader
+		event.TokenSubject = origin.TokenSubject
+		event.TokenId = origin.TokenId
+		event.Reason = origin.Reason
+	}
+
+	if l.options.HashKey != nil {
+		event.Uuid = l.hash(event.Uuid)
+		event.TokenSubject = l.hash(event.TokenSubject)
+	}
+
+	if l.options.TruncateIps {
+		event.Ip = truncateIp(event.Ip)
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.closed {
+		dropped.Inc()
+		slog.ErrorContext(ctx, "the audit event is recorded after the log has been closed", slog.String("type", event.Type))
+
+		return
+	}
+
+	// The event must be written even when the client has gone away or the request has timed out
+	select {
+	case l.queue <- queuedEvent{context.WithoutCancel(ctx), event}:
+	default:
+		dropped.Inc()
+		slog.ErrorContext(ctx, "the audit queue is full, the event has been dropped", slog.String("type", event.Type))
+	}
+}
+
+func (l *Log) run() {
+	defer close(l.drained)
+
+	for queued := range l.queue {
+		l.write(queued.ctx, queued.event)
+	}
+}
+
+func (l *Log) write(ctx context.Context, event *Event) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	err := l.sink.Write(ctx, event)
+	events.WithLabelValues(event.Type).Inc()
+	if err != nil {
+		failures.Inc()
+		slog.ErrorContext(ctx, "unable to write an audit event", slog.String("type", event.Type), slog.Any("err", err))
+	}
+}
+
+// Writes the queued events and closes the sink when it's an io.Closer. Events recorded after the call are dropped.
+// When the ctx is done before the queue is drained, the rest of the events are left to the worker
+// and the sink remains open
+func (l *Log) Close(ctx context.Context) error {
+	if l.sink == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.queue)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-l.drained:
+	case <-ctx.Done():
+		return fmt.Errorf("unable to write %d queued audit events: %w", len(l.queue), ctx.Err())
+	}
+
+	if closer, ok := l.sink.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+func (l *Log) hash(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, l.options.HashKey)
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func truncateIp(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+
+	if ipv4 := parsed.To4(); ipv4 != nil {
+		return ipv4.Mask(net.CIDRMask(24, 32)).String()
+	}
+
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// The hex-encoded SHA-256 of the key in the PKIX form
+func Fingerprint(publicKey *rsa.PublicKey) string {
+	publicKeyPKIX, _ := x509.MarshalPKIXPublicKey(publicKey)
+	sum := sha256.Sum256(publicKeyPKIX)
+
+	return hex.EncodeToString(sum[:])
+}
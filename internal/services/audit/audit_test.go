@@ -0,0 +1,226 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ely.by/profilecerts/internal/logging"
+)
+
+type sinkStub struct {
+	mu      sync.Mutex
+	events  []*Event
+	err     error
+	closed  bool
+	blocked chan struct{}
+}
+
+func (s *sinkStub) Write(ctx context.Context, event *Event) error {
+	if s.blocked != nil {
+		<-s.blocked
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	s.events = append(s.events, event)
+
+	return s.err
+}
+
+func (s *sinkStub) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+
+	return nil
+}
+
+func closeLog(t *testing.T, l *Log) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := l.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogRecord(t *testing.T) {
+	const uuid = "a2a65ee9-a8a6-4bd4-98ab-3c2d11bb1cbb"
+
+	requestCtx, cancelRequest := context.WithCancel(logging.WithRequestId(context.Background(), "request-1"))
+	requestCtx = WithReason(WithOrigin(requestCtx, Origin{
+		Actor:        ActorPlayer,
+		Ip:           "203.0.113.17",
+		AuthReader:   "elyby",
+		TokenSubject: "ely|1",
+		TokenId:      "jti-1",
+	}), "account_banned")
+	// The event is written even when the client has gone away
+	cancelRequest()
+
+	testCases := []struct {
+		name     string
+		ctx      context.Context
+		options  Options
+		expected Event
+	}{
+		{
+			name:     "player's event",
+			ctx:      requestCtx,
+			expected: Event{Uuid: uuid, Actor: ActorPlayer, Ip: "203.0.113.17", RequestId: "request-1", AuthReader: "elyby", TokenSubject: "ely|1", TokenId: "jti-1", Reason: "account_banned"},
+		},
+		{
+			name:     "system's event",
+			ctx:      context.Background(),
+			expected: Event{Uuid: uuid, Actor: ActorSystem},
+		},
+		{
+			name:    "hashed uuids and truncated ips",
+			ctx:     requestCtx,
+			options: Options{HashKey: []byte("key"), TruncateIps: true},
+			expected: Event{
+				Uuid:         "a9a4d6a8ebf2b6e3dba3fa9b86e1f66e29db1af29b5e2b2c1fdd2da7c24e2c8f",
+				Actor:        ActorPlayer,
+				Ip:           "203.0.113.0",
+				RequestId:    "request-1",
+				AuthReader:   "elyby",
+				TokenSubject: "",
+				TokenId:      "jti-1",
+				Reason:       "account_banned",
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			sink := &sinkStub{}
+			l := New(sink, testCase.options)
+			l.Record(testCase.ctx, &Event{Type: EventCertificateRevoked, Uuid: uuid})
+			closeLog(t, l)
+
+			if len(sink.events) != 1 {
+				t.Fatalf("expected a single event, got %d", len(sink.events))
+			}
+
+			event := sink.events[0]
+			if event.Time.IsZero() || event.Type != EventCertificateRevoked {
+				t.Fatalf("expected the time and the type to be set, got %+v", event)
+			}
+
+			expected := testCase.expected
+			if testCase.options.HashKey != nil {
+				expected.Uuid = l.hash(uuid)
+				expected.TokenSubject = l.hash("ely|1")
+				if event.Uuid == uuid || len(event.Uuid) != 64 {
+					t.Fatalf("expected the uuid to be hashed, got %s", event.Uuid)
+				}
+			}
+
+			event.Time = time.Time{}
+			event.Type = ""
+			if *event != expected {
+				t.Fatalf("expected %+v, got %+v", expected, *event)
+			}
+		})
+	}
+}
+
+func TestLogQueue(t *testing.T) {
+	sink := &sinkStub{blocked: make(chan struct{})}
+	l := New(sink, Options{QueueSize: 2})
+
+	droppedBefore := testutil.ToFloat64(dropped)
+
+	// The first event is taken by the worker, which is blocked by the sink, the next two fill the queue
+	l.Record(context.Background(), &Event{Type: EventCertificateIssued})
+	for i := 0; i < 50 && len(l.queue) > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 0; i < 3; i++ {
+		l.Record(context.Background(), &Event{Type: EventCertificateIssued})
+	}
+
+	if actual := testutil.ToFloat64(dropped) - droppedBefore; actual != 1 {
+		t.Fatalf("expected a single event to be dropped, got %v", actual)
+	}
+
+	close(sink.blocked)
+	closeLog(t, l)
+
+	if len(sink.events) != 3 || !sink.closed {
+		t.Fatalf("expected the queued events to be written before the sink is closed, got %d", len(sink.events))
+	}
+
+	l.Record(context.Background(), &Event{Type: EventCertificateIssued})
+	if actual := testutil.ToFloat64(dropped) - droppedBefore; actual != 2 {
+		t.Fatalf("expected the event recorded after the close to be dropped, got %v", actual)
+	}
+}
+
+func TestLogCloseTimeout(t *testing.T) {
+	sink := &sinkStub{blocked: make(chan struct{})}
+	defer close(sink.blocked)
+
+	l := New(sink, Options{QueueSize: 10})
+	l.Record(context.Background(), &Event{Type: EventCertificateIssued})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := l.Close(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline error, got %v", err)
+	}
+
+	if sink.closed {
+		t.Fatal("expected the sink to remain open while the events are being written")
+	}
+}
+
+func TestLogWriteFailures(t *testing.T) {
+	sink := &sinkStub{err: errors.New("the sink is down")}
+	l := New(sink, Options{})
+
+	failuresBefore := testutil.ToFloat64(failures)
+	l.Record(context.Background(), &Event{Type: EventCertificateIssued})
+	closeLog(t, l)
+
+	if actual := testutil.ToFloat64(failures) - failuresBefore; actual != 1 {
+		t.Fatalf("expected the failure to be counted, got %v", actual)
+	}
+}
+
+func TestLogWithoutSink(t *testing.T) {
+	l := New(nil, Options{})
+	l.Record(context.Background(), &Event{Type: EventCertificateIssued})
+	closeLog(t, l)
+}
+
+func TestTruncateIp(t *testing.T) {
+	testCases := map[string]string{
+		"203.0.113.17":                "203.0.113.0",
+		"2001:db8:85a3:8d3:1319::370": "2001:db8:85a3::",
+		"::ffff:203.0.113.17":         "203.0.113.0",
+		"not an ip":                   "not an ip",
+		"":                            "",
+	}
+	for ip, expected := range testCases {
+		if actual := truncateIp(ip); actual != expected {
+			t.Errorf("expected %q for %q, got %q", expected, ip, actual)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/goccy/go-json"
+	"github.com/spf13/viper"
+)
+
+// Appends events as JSON lines. When the file grows over the max size, it's renamed to path.1,
+// the previous backups are shifted and the oldest one above the max backups is removed
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	err := s.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func NewFileSinkWithConfig(config *viper.Viper) (*FileSink, error) {
+	config.SetDefault("audit.file.path", "audit.log")
+	config.SetDefault("audit.file.max_size", "100MB")
+	config.SetDefault("audit.file.max_backups", 10)
+
+	return NewFileSink(
+		config.GetString("audit.file.path"),
+		int64(config.GetSizeInBytes("audit.file.max_size")),
+		config.GetInt("audit.file.max_backups"),
+	)
+}
+
+func (s *FileSink) Write(ctx context.Context, event *Event) error {
+	line, err := json.MarshalContext(ctx, event)
+	if err != nil {
+		return fmt.Errorf("unable to serialize the event: %w", err)
+	}
+
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The event is written to the current file even when the rotation fails, so it isn't lost
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		err = s.rotate()
+		if err != nil {
+			slog.ErrorContext(ctx, "unable to rotate the audit log", slog.String("path", s.path), slog.Any("err", err))
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("unable to write to the audit log: %w", err)
+	}
+
+	return nil
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("unable to open the audit log: %w", err)
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("unable to stat the audit log: %w", err)
+	}
+
+	s.file = file
+	s.size = stat.Size()
+
+	return nil
+}
+
+// Must be called with the mutex held. The current file is renamed while it's still open and is closed only
+// after the new one has been opened, so there is always a file to write events to
+func (s *FileSink) rotate() error {
+	err := s.shiftBackups()
+	if err != nil {
+		return err
+	}
+
+	previous := s.file
+	err = s.open()
+	if err != nil {
+		return err
+	}
+
+	err = previous.Close()
+	if err != nil {
+		return fmt.Errorf("unable to close the rotated audit log: %w", err)
+	}
+
+	return nil
+}
+
+func (s *FileSink) shiftBackups() error {
+	if s.maxBackups <= 0 {
+		return os.Remove(s.path)
+	}
+
+	err := os.Remove(s.backupPath(s.maxBackups))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		err = os.Rename(s.backupPath(i), s.backupPath(i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return os.Rename(s.path, s.backupPath(1))
+}
+
+func (s *FileSink) backupPath(i int) string {
+	return fmt.Sprintf("%s.%d", s.path, i)
+}
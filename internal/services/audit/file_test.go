@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.Split(strings.TrimSpace(string(content)), "\n")
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileSink(path, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each event exceeds the max size, so every write after the first one rotates the file
+	for _, uuid := range []string{"first", "second", "third", "fourth"} {
+		err = sink.Write(context.Background(), &Event{Type: EventCertificateIssued, Uuid: uuid})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = sink.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{path: "fourth", path + ".1": "third", path + ".2": "second"}
+	for file, uuid := range expected {
+		lines := readLines(t, file)
+		if len(lines) != 1 || !strings.Contains(lines[0], `"uuid":"`+uuid+`"`) {
+			t.Errorf("expected the %s event in %s, got %v", uuid, file, lines)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected the oldest backup to be removed, got %v", err)
+	}
+}
+
+func TestFileSinkWritesWhenRotationFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	// A non-empty directory in place of the oldest backup can't be removed
+	err := os.MkdirAll(filepath.Join(path+".1", "nested"), 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := NewFileSink(path, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	for _, uuid := range []string{"first", "second"} {
+		err = sink.Write(context.Background(), &Event{Type: EventCertificateIssued, Uuid: uuid})
+		if err != nil {
+			t.Fatalf("expected the event to be written despite the rotation failure, got %v", err)
+		}
+	}
+
+	if lines := readLines(t, path); len(lines) != 2 {
+		t.Fatalf("expected both events in the current file, got %v", lines)
+	}
+}
@@ -0,0 +1,27 @@
+package audit
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var events = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "profilecerts",
+	Subsystem: "audit",
+	Name:      "events_total",
+	Help:      "The number of recorded audit events, partitioned by the event type",
+}, []string{"type"})
+
+var failures = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: "profilecerts",
+	Subsystem: "audit",
+	Name:      "write_failures_total",
+	Help:      "The number of audit events that couldn't be written to the sink",
+})
+
+var dropped = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: "profilecerts",
+	Subsystem: "audit",
+	Name:      "dropped_events_total",
+	Help:      "The number of audit events that have been dropped, because the queue was full or the log was closed",
+})
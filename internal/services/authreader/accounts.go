@@ -0,0 +1,66 @@
+package authreader
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+)
+
+// Both methods should return an empty uuid when there is no such account
+type AccountsRepository interface {
+	FindAccountById(ctx context.Context, id int) (string, int, error)
+	FindAccountByUuid(ctx context.Context, uuid string) (string, int, error)
+}
+
+func parseUserId(subject string) (int, error) {
+	userId, err := strconv.Atoi(subject)
+	if err != nil {
+		return 0, &unauthorizedError{reason: ReasonInvalidSubject, msg: "the sub value doesn't contain a valid account id", err: err}
+	}
+
+	return userId, nil
+}
+
+func findActiveAccountUuid(ctx context.Context, repository AccountsRepository, userId int) (string, error) {
+	ctx, span := tracer.Start(ctx, "authreader.FindAccountById")
+	uuid, status, err := repository.FindAccountById(ctx, userId)
+	endSpan(span, err)
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve account by user id: %w", err)
+	}
+
+	return activeAccountUuid(uuid, status)
+}
+
+func findActiveAccountByUuid(ctx context.Context, repository AccountsRepository, uuid string) (string, error) {
+	ctx, span := tracer.Start(ctx, "authreader.FindAccountByUuid")
+	foundUuid, status, err := repository.FindAccountByUuid(ctx, uuid)
+	endSpan(span, err)
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve account by uuid: %w", err)
+	}
+
+	return activeAccountUuid(foundUuid, status)
+}
+
+func activeAccountUuid(uuid string, status int) (string, error) {
+	// Accounts are removed from the database some time after being marked as deleted,
+	// so the token can outlive the account itself
+	if uuid == "" {
+		return "", &AccountStatusError{Status: AccountStatusDeleted}
+	}
+
+	if AccountStatus(status) != AccountStatusActive {
+		return "", &AccountStatusError{Uuid: uuid, Status: AccountStatus(status)}
+	}
+
+	return uuid, nil
+}
+
+func reportRejection(ctx context.Context, err error) {
+	if reason := UnauthorizedReason(err); reason != "" {
+		rejections.WithLabelValues(reason).Inc()
+		slog.DebugContext(ctx, "the token has been rejected", slog.String("reason", reason), slog.Any("err", err))
+	}
+}
@@ -0,0 +1,103 @@
+package authreader
+
+import (
+	"context"
+	"crypto/sha256"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/spf13/viper"
+)
+
+type cachedResult struct {
+	uuid       string
+	readerName string
+	token      TokenDetails
+	expiresAt  time.Time
+}
+
+// Remembers successful results of the wrapped reader, so repeated requests with the same token
+// don't verify it and query the database again. Failures are never cached.
+// Entries expire at the token's expiration time, but not later than maxTtl,
+// which limits how long a change of the account status can go unnoticed
+type CachedReader struct {
+	reader Reader
+	maxTtl time.Duration
+	cache  *lru.Cache[[sha256.Size]byte, cachedResult]
+}
+
+func NewCached(reader Reader, size int, maxTtl time.Duration) (*CachedReader, error) {
+	cache, err := lru.New[[sha256.Size]byte, cachedResult](size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CachedReader{reader, maxTtl, cache}, nil
+}
+
+func NewCachedWithConfig(config *viper.Viper, reader Reader) (*CachedReader, error) {
+	config.SetDefault("auth.cache.size", 10000)
+	config.SetDefault("auth.cache.max_ttl", time.Minute)
+
+	return NewCached(reader, config.GetInt("auth.cache.size"), config.GetDuration("auth.cache.max_ttl"))
+}
+
+func (r *CachedReader) GetUuidFromAuthorizationHeader(ctx context.Context, authHeader string) (string, error) {
+	// Tokens are hashed, so they aren't kept in memory as is
+	key := sha256.Sum256([]byte(authHeader))
+	now := timeNow()
+	if result, found := r.cache.Get(key); found {
+		if now.Before(result.expiresAt) {
+			recordReaderName(ctx, result.readerName)
+			recordTokenDetails(ctx, result.token)
+			cacheLookups.WithLabelValues("hit").Inc()
+
+			return result.uuid, nil
+		}
+
+		r.cache.Remove(key)
+	}
+
+	cacheLookups.WithLabelValues("miss").Inc()
+
+	// The wrapped reader records details into the context, but the caller may have not prepared it
+	ctx, details := ensureAuthDetails(ctx)
+	uuid, err := r.reader.GetUuidFromAuthorizationHeader(ctx, authHeader)
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := now.Add(r.maxTtl)
+	if !details.token.ExpiresAt.IsZero() && details.token.ExpiresAt.Before(expiresAt) {
+		expiresAt = details.token.ExpiresAt
+	}
+
+	if expiresAt.After(now) {
+		r.cache.Add(key, cachedResult{uuid, details.readerName, details.token, expiresAt})
+	}
+
+	return uuid, nil
+}
+
+// The nil *CachedReader has nothing to invalidate, so it can be passed when the cache is disabled
+func (r *CachedReader) InvalidateAuthorizationHeader(authHeader string) {
+	if r == nil {
+		return
+	}
+
+	r.cache.Remove(sha256.Sum256([]byte(authHeader)))
+}
+
+// Removes all cached tokens of the account. Should be called when the account status changes
+func (r *CachedReader) InvalidateUuid(uuid string) {
+	if r == nil {
+		return
+	}
+
+	for _, key := range r.cache.Keys() {
+		result, found := r.cache.Peek(key)
+		if found && result.uuid == uuid {
+			r.cache.Remove(key)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package authreader
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type countingReader struct {
+	uuids map[string]string
+	token TokenDetails
+	calls int
+}
+
+func (r *countingReader) GetUuidFromAuthorizationHeader(ctx context.Context, authHeader string) (string, error) {
+	r.calls++
+	recordReaderName(ctx, "counting")
+	recordTokenDetails(ctx, r.token)
+
+	uuid, found := r.uuids[authHeader]
+	if !found {
+		return "", &unauthorizedError{reason: ReasonInvalidToken, msg: "unknown token"}
+	}
+
+	return uuid, nil
+}
+
+func newCachedForTest(t *testing.T, reader Reader) *CachedReader {
+	t.Helper()
+
+	cached, err := NewCached(reader, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cached
+}
+
+func TestCachedReader(t *testing.T) {
+	clock := useFakeClock(t)
+	reader := &countingReader{uuids: map[string]string{"Bearer a": activeUuid, "Bearer b": bannedUuid}}
+	cached := newCachedForTest(t, reader)
+
+	expectCalls := func(authHeader string, expected int) {
+		t.Helper()
+
+		ctx := WithReaderName(context.Background())
+		uuid, err := cached.GetUuidFromAuthorizationHeader(ctx, authHeader)
+		if err != nil || uuid != reader.uuids[authHeader] {
+			t.Fatalf("expected uuid %s, got %s %v", reader.uuids[authHeader], uuid, err)
+		}
+
+		if name := ReaderName(ctx); name != "counting" {
+			t.Fatalf("expected the reader name to be recorded, got %q", name)
+		}
+
+		if reader.calls != expected {
+			t.Fatalf("expected %d calls of the wrapped reader, got %d", expected, reader.calls)
+		}
+	}
+
+	expectCalls("Bearer a", 1)
+	expectCalls("Bearer a", 1)
+
+	// Entries don't live longer than the max ttl
+	clock.Advance(time.Minute)
+	expectCalls("Bearer a", 2)
+
+	// Nor than the token itself
+	reader.token.ExpiresAt = clock.Now().Add(10 * time.Second)
+	expectCalls("Bearer b", 3)
+	clock.Advance(10 * time.Second)
+	expectCalls("Bearer b", 4)
+
+	cached.InvalidateUuid(activeUuid)
+	expectCalls("Bearer a", 5)
+
+	cached.InvalidateAuthorizationHeader("Bearer a")
+	expectCalls("Bearer a", 6)
+}
+
+func TestCachedReaderDoesNotCacheFailures(t *testing.T) {
+	reader := &countingReader{}
+	cached := newCachedForTest(t, reader)
+
+	for i := 0; i < 2; i++ {
+		_, err := cached.GetUuidFromAuthorizationHeader(context.Background(), "Bearer unknown")
+		if !IsUnauthorized(err) {
+			t.Fatalf("expected the unauthorized error, got %v", err)
+		}
+	}
+
+	if reader.calls != 2 {
+		t.Fatalf("expected each failure to reach the wrapped reader, got %d calls", reader.calls)
+	}
+}
+
+func TestNilCachedReaderInvalidation(t *testing.T) {
+	var cached *CachedReader
+	cached.InvalidateUuid(activeUuid)
+	cached.InvalidateAuthorizationHeader("Bearer a")
+}
@@ -0,0 +1,103 @@
+package authreader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+type Reader interface {
+	GetUuidFromAuthorizationHeader(ctx context.Context, authHeader string) (string, error)
+}
+
+type NamedReader struct {
+	Name   string
+	Reader Reader
+	// Reports whether the authorization header looks like something the reader can handle.
+	// Used only when the chain dispatches by token shape. When nil, the reader accepts any header
+	Accepts func(authHeader string) bool
+}
+
+// Tries the readers in order and returns the uuid from the first one that accepted the token
+type Chain struct {
+	readers         []NamedReader
+	dispatchByShape bool
+}
+
+func NewChain(dispatchByShape bool, readers ...NamedReader) *Chain {
+	return &Chain{readers, dispatchByShape}
+}
+
+func (c *Chain) GetUuidFromAuthorizationHeader(ctx context.Context, authHeader string) (string, error) {
+	var unauthorizedErrs []error
+	var failureErrs []error
+	for _, reader := range c.readers {
+		if c.dispatchByShape && reader.Accepts != nil && !reader.Accepts(authHeader) {
+			continue
+		}
+
+		uuid, err := reader.Reader.GetUuidFromAuthorizationHeader(ctx, authHeader)
+		if err == nil {
+			recordReaderName(ctx, reader.Name)
+			authentications.WithLabelValues(reader.Name).Inc()
+
+			return uuid, nil
+		}
+
+		// The token is valid, so there is no reason to ask other readers
+		if _, ok := AsAccountStatusError(err); ok {
+			recordReaderName(ctx, reader.Name)
+
+			return "", err
+		}
+
+		if IsUnauthorized(err) {
+			unauthorizedErrs = append(unauthorizedErrs, fmt.Errorf("%s: %w", reader.Name, err))
+		} else {
+			slog.WarnContext(ctx, "auth reader has failed, trying the next one", slog.String("reader", reader.Name), slog.Any("err", err))
+			failureErrs = append(failureErrs, fmt.Errorf("%s: %w", reader.Name, err))
+		}
+	}
+
+	// One of the failed readers might have accepted the token, so it's not safe to report it as unauthorized
+	if len(failureErrs) > 0 {
+		return "", errors.Join(failureErrs...)
+	}
+
+	if len(unauthorizedErrs) == 0 {
+		return "", &unauthorizedError{reason: ReasonInvalidHeader, msg: "there is no auth reader for the provided token"}
+	}
+
+	return "", &unauthorizedError{
+		reason: commonReason(unauthorizedErrs),
+		msg:    "none of the auth readers accepted the token",
+		err:    errors.Join(unauthorizedErrs...),
+	}
+}
+
+func commonReason(errs []error) string {
+	reason := UnauthorizedReason(errs[0])
+	for _, err := range errs[1:] {
+		if UnauthorizedReason(err) != reason {
+			return ReasonInvalidToken
+		}
+	}
+
+	return reason
+}
+
+// Reports whether the header contains a bearer token that looks like a JWT
+func IsBearerJwt(authHeader string) bool {
+	token, found := strings.CutPrefix(authHeader, "Bearer ")
+
+	return found && strings.Count(token, ".") == 2
+}
+
+// Reports whether the header contains a bearer token that doesn't look like a JWT
+func IsBearerOpaque(authHeader string) bool {
+	token, found := strings.CutPrefix(authHeader, "Bearer ")
+
+	return found && token != "" && !IsBearerJwt(authHeader)
+}
@@ -0,0 +1,142 @@
+package authreader
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type readerFunc func(ctx context.Context, authHeader string) (string, error)
+
+func (f readerFunc) GetUuidFromAuthorizationHeader(ctx context.Context, authHeader string) (string, error) {
+	return f(ctx, authHeader)
+}
+
+func returning(uuid string, err error) readerFunc {
+	return func(ctx context.Context, authHeader string) (string, error) {
+		return uuid, err
+	}
+}
+
+func rejecting(reason string) readerFunc {
+	return returning("", &unauthorizedError{reason: reason, msg: "rejected"})
+}
+
+func failing() readerFunc {
+	return func(ctx context.Context, authHeader string) (string, error) {
+		return "", errors.New("the store is down")
+	}
+}
+
+func TestChain(t *testing.T) {
+	testCases := []struct {
+		name            string
+		dispatchByShape bool
+		readers         []NamedReader
+		expectedUuid    string
+		expectedReader  string
+		expectedError   func(t *testing.T, err error)
+	}{
+		{
+			name:           "first reader accepts",
+			readers:        []NamedReader{{Name: "a", Reader: returning(activeUuid, nil)}, {Name: "b", Reader: failing()}},
+			expectedUuid:   activeUuid,
+			expectedReader: "a",
+		},
+		{
+			name:           "next reader accepts",
+			readers:        []NamedReader{{Name: "a", Reader: rejecting(ReasonMalformed)}, {Name: "b", Reader: returning(activeUuid, nil)}},
+			expectedUuid:   activeUuid,
+			expectedReader: "b",
+		},
+		{
+			name:           "reader fails before the accepting one",
+			readers:        []NamedReader{{Name: "a", Reader: failing()}, {Name: "b", Reader: returning(activeUuid, nil)}},
+			expectedUuid:   activeUuid,
+			expectedReader: "b",
+		},
+		{
+			name:          "all readers reject for the same reason",
+			readers:       []NamedReader{{Name: "a", Reader: rejecting(ReasonExpired)}, {Name: "b", Reader: rejecting(ReasonExpired)}},
+			expectedError: expectUnauthorized(ReasonExpired),
+		},
+		{
+			name:          "readers reject for different reasons",
+			readers:       []NamedReader{{Name: "a", Reader: rejecting(ReasonExpired)}, {Name: "b", Reader: rejecting(ReasonMalformed)}},
+			expectedError: expectUnauthorized(ReasonInvalidToken),
+		},
+		{
+			name:    "reader fails and the rest reject",
+			readers: []NamedReader{{Name: "a", Reader: failing()}, {Name: "b", Reader: rejecting(ReasonMalformed)}},
+			expectedError: func(t *testing.T, err error) {
+				if err == nil || IsUnauthorized(err) {
+					t.Fatalf("expected a failure that isn't reported as unauthorized, got %v", err)
+				}
+			},
+		},
+		{
+			name: "account status stops the chain",
+			readers: []NamedReader{
+				{Name: "a", Reader: returning("", &AccountStatusError{Uuid: bannedUuid, Status: AccountStatusBanned})},
+				{Name: "b", Reader: returning(activeUuid, nil)},
+			},
+			expectedReader: "a",
+			expectedError:  expectAccountStatus(AccountStatusBanned, bannedUuid),
+		},
+		{
+			name:            "dispatch by shape",
+			dispatchByShape: true,
+			readers: []NamedReader{
+				{Name: "jwt", Reader: failing(), Accepts: IsBearerJwt},
+				{Name: "opaque", Reader: returning(activeUuid, nil)},
+			},
+			expectedUuid:   activeUuid,
+			expectedReader: "opaque",
+		},
+		{
+			name:            "no reader for the shape",
+			dispatchByShape: true,
+			readers:         []NamedReader{{Name: "jwt", Reader: returning(activeUuid, nil), Accepts: IsBearerJwt}},
+			expectedError:   expectUnauthorized(ReasonInvalidHeader),
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			chain := NewChain(testCase.dispatchByShape, testCase.readers...)
+			ctx := WithReaderName(context.Background())
+
+			uuid, err := chain.GetUuidFromAuthorizationHeader(ctx, "Bearer opaque-token")
+			if name := ReaderName(ctx); name != testCase.expectedReader {
+				t.Errorf("expected the %q reader to be recorded, got %q", testCase.expectedReader, name)
+			}
+
+			if testCase.expectedError != nil {
+				testCase.expectedError(t, err)
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if uuid != testCase.expectedUuid {
+				t.Fatalf("expected uuid %s, got %s", testCase.expectedUuid, uuid)
+			}
+		})
+	}
+}
+
+func TestIsBearerJwt(t *testing.T) {
+	testCases := map[string]bool{
+		"Bearer aaa.bbb.ccc":    true,
+		"Bearer opaque-token":   false,
+		"Bearer aaa.bbb.ccc.dd": false,
+		"Basic aaa.bbb.ccc":     false,
+		"aaa.bbb.ccc":           false,
+	}
+	for header, expected := range testCases {
+		if actual := IsBearerJwt(header); actual != expected {
+			t.Errorf("expected %t for %q, got %t", expected, header, actual)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package authreader
+
+import (
+	"context"
+	"time"
+)
+
+// Details about the token that readers report back through the context. Any of the fields may be empty
+type TokenDetails struct {
+	// The jti claim
+	Id        string
+	Subject   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+type authDetailsKey struct{}
+
+type authDetails struct {
+	readerName string
+	token      TokenDetails
+}
+
+// Prepares the ctx to record the name of the reader that has authenticated the request
+func WithReaderName(ctx context.Context) context.Context {
+	return context.WithValue(ctx, authDetailsKey{}, &authDetails{})
+}
+
+// Returns an empty string when the request wasn't authenticated through the Chain
+func ReaderName(ctx context.Context) string {
+	details, ok := ctx.Value(authDetailsKey{}).(*authDetails)
+	if !ok {
+		return ""
+	}
+
+	return details.readerName
+}
+
+// Returns details of the token that has authenticated the request. The result is empty
+// when the request wasn't authenticated or the reader doesn't report any details
+func RecordedTokenDetails(ctx context.Context) TokenDetails {
+	details, ok := ctx.Value(authDetailsKey{}).(*authDetails)
+	if !ok {
+		return TokenDetails{}
+	}
+
+	return details.token
+}
+
+// Returns the ctx itself when it's already prepared to record details
+func ensureAuthDetails(ctx context.Context) (context.Context, *authDetails) {
+	if details, ok := ctx.Value(authDetailsKey{}).(*authDetails); ok {
+		return ctx, details
+	}
+
+	ctx = WithReaderName(ctx)
+
+	return ctx, ctx.Value(authDetailsKey{}).(*authDetails)
+}
+
+func recordReaderName(ctx context.Context, name string) {
+	if details, ok := ctx.Value(authDetailsKey{}).(*authDetails); ok {
+		details.readerName = name
+	}
+}
+
+func recordTokenDetails(ctx context.Context, token TokenDetails) {
+	if details, ok := ctx.Value(authDetailsKey{}).(*authDetails); ok {
+		details.token = token
+	}
+}
+
+func tokenDetailsFromClaims(claims *claims) TokenDetails {
+	details := TokenDetails{Id: claims.ID, Subject: claims.Subject}
+	if claims.IssuedAt != nil {
+		details.IssuedAt = claims.IssuedAt.Time
+	}
+
+	if claims.ExpiresAt != nil {
+		details.ExpiresAt = claims.ExpiresAt.Time
+	}
+
+	return details
+}
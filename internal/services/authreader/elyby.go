@@ -2,114 +2,142 @@ package authreader
 
 import (
 	"context"
-	"crypto"
+	"errors"
 	"fmt"
-	"slices"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/patrickmn/go-cache"
+	"github.com/spf13/viper"
 )
 
-const minecraftServerScope = "minecraft_server_session"
-const cacheKey = "publicKeySet"
-
 type claims struct {
 	jwt.RegisteredClaims
 	Scope string `json:"scope"`
 }
 
 type AccountsPublicKeyProvider interface {
-	GetPublicKeys(ctx context.Context) ([]crypto.PublicKey, error)
-}
-
-type AccountsRepository interface {
-	FindUuidById(ctx context.Context, id int) (string, error)
+	GetPublicKeys(ctx context.Context) (*PublicKeySet, error)
 }
 
 type ElybyJwtReader struct {
-	publicKeyProvider AccountsPublicKeyProvider
-	repository        AccountsRepository
-	cache             *cache.Cache
+	keys       *keySetManager
+	repository AccountsRepository
+	validation *TokenValidation
 }
 
-func NewElyby(publicKeyProvider AccountsPublicKeyProvider, repository AccountsRepository) *ElybyJwtReader {
+// The backup is optional
+func NewElyby(
+	publicKeyProvider AccountsPublicKeyProvider,
+	publicKeysBackup PublicKeysBackup,
+	repository AccountsRepository,
+	validation *TokenValidation,
+	keySetOptions KeySetOptions,
+) *ElybyJwtReader {
 	return &ElybyJwtReader{
-		publicKeyProvider: publicKeyProvider,
-		repository:        repository,
-		cache:             cache.New(time.Hour, 0),
+		keys:       newKeySetManager(publicKeyProvider, publicKeysBackup, keySetOptions),
+		repository: repository,
+		validation: validation,
 	}
 }
 
-func (r *ElybyJwtReader) GetUuidFromAuthorizationHeader(ctx context.Context, authHeader string) (string, error) {
-	userId, err := r.extractUserId(ctx, authHeader)
+func NewElybyWithConfig(
+	config *viper.Viper,
+	publicKeyProvider AccountsPublicKeyProvider,
+	publicKeysBackup PublicKeysBackup,
+	repository AccountsRepository,
+) (*ElybyJwtReader, error) {
+	config.SetDefault("accounts.keys.refresh_interval", time.Hour)
+	config.SetDefault("accounts.keys.min_refetch_interval", 30*time.Second)
+	config.SetDefault("accounts.keys.max_staleness", 7*24*time.Hour)
+
+	validation, err := NewTokenValidationWithConfig(config, "accounts.tokens", accountIdSubjectPattern)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("invalid token validation config: %w", err)
 	}
 
-	uuid, err := r.repository.FindUuidById(ctx, userId)
+	return NewElyby(
+		publicKeyProvider,
+		publicKeysBackup,
+		repository,
+		validation,
+		KeySetOptions{
+			RefreshInterval:    config.GetDuration("accounts.keys.refresh_interval"),
+			MinRefetchInterval: config.GetDuration("accounts.keys.min_refetch_interval"),
+			MaxStaleness:       config.GetDuration("accounts.keys.max_staleness"),
+		},
+	), nil
+}
+
+func (r *ElybyJwtReader) GetUuidFromAuthorizationHeader(ctx context.Context, authHeader string) (string, error) {
+	verifyCtx, span := tracer.Start(ctx, "authreader.VerifyJwt")
+	userId, err := r.extractUserId(verifyCtx, authHeader)
+	endSpan(span, err)
 	if err != nil {
-		return "", fmt.Errorf("unable to retrieve uuid by user id: %w", err)
-	}
+		reportRejection(ctx, err)
 
-	if uuid == "" {
-		return "", fmt.Errorf("unable to find uuid for user id %d", userId)
+		return "", err
 	}
 
-	return uuid, nil
+	return findActiveAccountUuid(ctx, r.repository, userId)
 }
 
 func (r *ElybyJwtReader) extractUserId(ctx context.Context, authHeader string) (int, error) {
 	if !strings.HasPrefix(authHeader, "Bearer ") {
-		return 0, &unauthorizedError{msg: "authorization header has an invalid format"}
+		return 0, &unauthorizedError{reason: ReasonInvalidHeader, msg: "authorization header has an invalid format"}
 	}
 
 	tokenStr := authHeader[7:] // trim "Bearer " part
 
-	uncastedKeyset, found := r.cache.Get(cacheKey)
-	if !found {
-		jwtPublicKeys, err := r.publicKeyProvider.GetPublicKeys(ctx)
-		if err != nil {
-			return 0, fmt.Errorf("unable to retrieve accounts public keys; %w", err)
-		}
+	keyset, err := r.keys.get(ctx)
+	if err != nil {
+		return 0, err
+	}
 
-		// I still don't understand why I can't just provide jwtPublicKeys directly to Keys,
-		// so I have to typecast them one by one 🙃
-		keyset := jwt.VerificationKeySet{
-			Keys: make([]jwt.VerificationKey, len(jwtPublicKeys)),
-		}
-		for i, key := range jwtPublicKeys {
-			keyset.Keys[i] = key
+	token, err := jwt.ParseWithClaims(tokenStr, &claims{}, keyset.keyfunc, r.validation.parserOptions()...)
+	if errors.Is(err, errUnknownKid) {
+		// The Accounts might have rotated its keys, so try to retrieve the new ones
+		kid, _ := token.Header["kid"].(string)
+		refreshedKeyset, refreshErr := r.keys.refreshForKid(ctx, kid)
+		if refreshErr != nil {
+			return 0, refreshErr
 		}
 
-		r.cache.SetDefault(cacheKey, keyset)
-		uncastedKeyset = keyset
+		if refreshedKeyset != keyset {
+			token, err = jwt.ParseWithClaims(tokenStr, &claims{}, refreshedKeyset.keyfunc, r.validation.parserOptions()...)
+		}
 	}
 
-	castedKeyset, _ := uncastedKeyset.(jwt.VerificationKeySet)
-
-	token, err := jwt.ParseWithClaims(tokenStr, &claims{}, func(token *jwt.Token) (interface{}, error) {
-		return castedKeyset, nil
-	})
 	if err != nil {
-		return 0, &unauthorizedError{msg: "unable to parse or verify the provided token", err: err}
+		return 0, &unauthorizedError{reason: parseErrorReason(err), msg: "unable to parse or verify the provided token", err: err}
 	}
 
 	claims := token.Claims.(*claims)
-	if !slices.Contains(strings.Split(claims.Scope, " "), minecraftServerScope) {
-		return 0, &unauthorizedError{msg: "the token doesn't have the scope to perform the action", err: err}
-	}
-
-	sub, err := token.Claims.GetSubject()
+	subject, err := r.validation.validate(claims)
 	if err != nil {
-		return 0, &unauthorizedError{msg: "unable to extract sub claim from the token", err: err}
+		return 0, err
 	}
 
-	if !strings.HasPrefix(sub, "ely|") {
-		return 0, &unauthorizedError{msg: "invalid sub value"}
-	}
+	recordTokenDetails(ctx, tokenDetailsFromClaims(claims))
 
-	return strconv.Atoi(sub[4:])
+	return parseUserId(subject)
+}
+
+func parseErrorReason(err error) string {
+	switch {
+	case errors.Is(err, errUnknownKid):
+		return ReasonUnknownKid
+	case errors.Is(err, errAlgorithmMismatch):
+		return ReasonAlgorithmMismatch
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return ReasonInvalidSignature
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ReasonExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return ReasonNotYetValid
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return ReasonMalformed
+	default:
+		return ReasonInvalidToken
+	}
 }
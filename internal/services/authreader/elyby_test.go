@@ -0,0 +1,184 @@
+package authreader
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	activeUuid = "a2a65ee9-a8a6-4bd4-98ab-3c2d11bb1cbb"
+	bannedUuid = "0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"
+)
+
+type accountsRepositoryStub struct {
+	byId   map[int]stubAccount
+	byUuid map[string]stubAccount
+}
+
+type stubAccount struct {
+	uuid   string
+	status AccountStatus
+}
+
+func (r *accountsRepositoryStub) FindAccountById(ctx context.Context, id int) (string, int, error) {
+	account := r.byId[id]
+
+	return account.uuid, int(account.status), nil
+}
+
+func (r *accountsRepositoryStub) FindAccountByUuid(ctx context.Context, uuid string) (string, int, error) {
+	account := r.byUuid[uuid]
+
+	return account.uuid, int(account.status), nil
+}
+
+func newAccountsRepositoryStub() *accountsRepositoryStub {
+	return &accountsRepositoryStub{
+		byId: map[int]stubAccount{
+			1: {activeUuid, AccountStatusActive},
+			2: {bannedUuid, AccountStatusBanned},
+			4: {"c9f6a1d4-1f7e-4c1a-9a57-1d7a0c3f5b2e", AccountStatusUnconfirmed},
+		},
+		byUuid: map[string]stubAccount{
+			activeUuid: {activeUuid, AccountStatusActive},
+			bannedUuid: {bannedUuid, AccountStatusBanned},
+		},
+	}
+}
+
+func newSigningKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func signToken(t *testing.T, key *ecdsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+// The same as the default config
+func newTestValidation() *TokenValidation {
+	return &TokenValidation{
+		RequiredScopes: []string{"minecraft_server_session"},
+		SubjectPattern: regexp.MustCompile(`^ely\|(\d+)$`),
+	}
+}
+
+func serverSessionClaims(sub string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   sub,
+		"scope": "offline_access minecraft_server_session",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestElybyJwtReader(t *testing.T) {
+	key := newSigningKey(t)
+	provider := newPublicKeysProvider(&PublicKey{Kid: "es256", Alg: "ES256", Key: &key.PublicKey})
+	reader := NewElyby(provider, nil, newAccountsRepositoryStub(), newTestValidation(), testKeySetOptions)
+
+	wrongScopeClaims := serverSessionClaims("ely|1")
+	wrongScopeClaims["scope"] = "account_info"
+
+	expiredClaims := serverSessionClaims("ely|1")
+	expiredClaims["exp"] = time.Now().Add(-time.Minute).Unix()
+
+	testCases := []struct {
+		name          string
+		token         string
+		expectedUuid  string
+		expectedError func(t *testing.T, err error)
+	}{
+		{name: "active account", token: signToken(t, key, serverSessionClaims("ely|1")), expectedUuid: activeUuid},
+		{name: "banned account", token: signToken(t, key, serverSessionClaims("ely|2")), expectedError: expectAccountStatus(AccountStatusBanned, bannedUuid)},
+		{name: "deleted account", token: signToken(t, key, serverSessionClaims("ely|3")), expectedError: expectAccountStatus(AccountStatusDeleted, "")},
+		{name: "unconfirmed account", token: signToken(t, key, serverSessionClaims("ely|4")), expectedError: expectAccountStatus(AccountStatusUnconfirmed, "c9f6a1d4-1f7e-4c1a-9a57-1d7a0c3f5b2e")},
+		{name: "wrong scope", token: signToken(t, key, wrongScopeClaims), expectedError: expectUnauthorized(ReasonInsufficientScope)},
+		{name: "unknown signing key", token: signToken(t, newSigningKey(t), serverSessionClaims("ely|1")), expectedError: expectUnauthorized(ReasonInvalidSignature)},
+		{name: "foreign subject", token: signToken(t, key, serverSessionClaims("google|1")), expectedError: expectUnauthorized(ReasonInvalidSubject)},
+		{name: "expired token", token: signToken(t, key, expiredClaims), expectedError: expectUnauthorized(ReasonExpired)},
+		{name: "malformed token", token: "not.a.jwt", expectedError: expectUnauthorized(ReasonMalformed)},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			uuid, err := reader.GetUuidFromAuthorizationHeader(context.Background(), "Bearer "+testCase.token)
+			if testCase.expectedError != nil {
+				testCase.expectedError(t, err)
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if uuid != testCase.expectedUuid {
+				t.Fatalf("expected uuid %s, got %s", testCase.expectedUuid, uuid)
+			}
+		})
+	}
+}
+
+func expectUnauthorized(reason string) func(t *testing.T, err error) {
+	return func(t *testing.T, err error) {
+		if actual := UnauthorizedReason(err); actual != reason {
+			t.Fatalf("expected an unauthorized error with the %s reason, got %v", reason, err)
+		}
+	}
+}
+
+func expectAccountStatus(status AccountStatus, uuid string) func(t *testing.T, err error) {
+	return func(t *testing.T, err error) {
+		statusErr, ok := AsAccountStatusError(err)
+		if !ok || statusErr.Status != status || statusErr.Uuid != uuid {
+			t.Fatalf("expected the account status error with the %s status and %q uuid, got %v", status, uuid, err)
+		}
+	}
+}
+
+func TestElybyJwtReaderKeysRotation(t *testing.T) {
+	clock := useFakeClock(t)
+	oldKey := newSigningKey(t)
+	newKey := newSigningKey(t)
+	provider := newPublicKeysProvider(&PublicKey{Kid: "old", Alg: "ES256", Key: &oldKey.PublicKey})
+	reader := NewElyby(provider, nil, newAccountsRepositoryStub(), newTestValidation(), testKeySetOptions)
+
+	_, err := reader.GetUuidFromAuthorizationHeader(context.Background(), "Bearer "+signTokenWithKid(t, jwt.SigningMethodES256, oldKey, "old"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	provider.respond([]*PublicKey{
+		{Kid: "old", Alg: "ES256", Key: &oldKey.PublicKey},
+		{Kid: "new", Alg: "ES256", Key: &newKey.PublicKey},
+	}, nil)
+	clock.Advance(30 * time.Second)
+
+	// The token with the unknown kid causes a refetch instead of waiting for the refresh interval
+	uuid, err := reader.GetUuidFromAuthorizationHeader(context.Background(), "Bearer "+signTokenWithKid(t, jwt.SigningMethodES256, newKey, "new"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if uuid != activeUuid {
+		t.Fatalf("expected uuid %s, got %s", activeUuid, uuid)
+	}
+}
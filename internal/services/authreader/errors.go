@@ -2,6 +2,25 @@ package authreader
 
 import "errors"
 
+// Reasons why a token was rejected. They are used as log attributes and metric labels,
+// so they must stay stable and low-cardinality
+const (
+	ReasonInvalidHeader     = "invalid_header"
+	ReasonMalformed         = "malformed"
+	ReasonUnknownKid        = "unknown_kid"
+	ReasonAlgorithmMismatch = "algorithm_mismatch"
+	ReasonInvalidSignature  = "invalid_signature"
+	ReasonExpired           = "expired"
+	ReasonNotYetValid       = "not_yet_valid"
+	ReasonInvalidIssuer     = "invalid_issuer"
+	ReasonInvalidAudience   = "invalid_audience"
+	ReasonInsufficientScope = "insufficient_scope"
+	ReasonInvalidSubject    = "invalid_subject"
+	ReasonInactive          = "inactive"
+	ReasonRevoked           = "revoked"
+	ReasonInvalidToken      = "invalid_token"
+)
+
 func IsUnauthorized(err error) bool {
 	var unauthorizedError *unauthorizedError
 	ok := errors.As(err, &unauthorizedError)
@@ -9,9 +28,20 @@ func IsUnauthorized(err error) bool {
 	return ok
 }
 
+// Returns an empty string when the err isn't an unauthorized error
+func UnauthorizedReason(err error) string {
+	var unauthorizedError *unauthorizedError
+	if !errors.As(err, &unauthorizedError) {
+		return ""
+	}
+
+	return unauthorizedError.reason
+}
+
 type unauthorizedError struct {
-	msg string
-	err error
+	reason string
+	msg    string
+	err    error
 }
 
 func (e *unauthorizedError) Error() string {
@@ -21,3 +51,20 @@ func (e *unauthorizedError) Error() string {
 func (e *unauthorizedError) Unwrap() error {
 	return e.err
 }
+
+// Returned when the token is valid, but the account it belongs to isn't allowed to receive certificates
+type AccountStatusError struct {
+	Uuid   string
+	Status AccountStatus
+}
+
+func (e *AccountStatusError) Error() string {
+	return "the account is " + e.Status.String()
+}
+
+func AsAccountStatusError(err error) (*AccountStatusError, bool) {
+	var accountStatusError *AccountStatusError
+	ok := errors.As(err, &accountStatusError)
+
+	return accountStatusError, ok
+}
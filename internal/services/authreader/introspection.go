@@ -0,0 +1,237 @@
+package authreader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	uuidLib "github.com/google/uuid"
+	"github.com/patrickmn/go-cache"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// The maximum size of the introspection response body that will be read
+const maxIntrospectionResponseSize = 64 << 10
+
+type introspectionResponse struct {
+	claims
+	Active bool `json:"active"`
+}
+
+type introspectionResult struct {
+	subject string
+	token   TokenDetails
+}
+
+// Validates opaque access tokens using an OAuth 2.0 Token Introspection endpoint (RFC 7662)
+type IntrospectionReader struct {
+	endpoint     string
+	clientId     string
+	clientSecret string
+	httpClient   *http.Client
+	validation   *TokenValidation
+	// When true, the subject contains the account uuid, otherwise it contains the account id
+	uuidSubject bool
+	repository  AccountsRepository
+	// Holds subjects of active tokens until their expiration
+	cache  *cache.Cache
+	maxTtl time.Duration
+}
+
+func NewIntrospection(
+	endpoint string,
+	clientId string,
+	clientSecret string,
+	httpClient *http.Client,
+	validation *TokenValidation,
+	uuidSubject bool,
+	repository AccountsRepository,
+	maxTtl time.Duration,
+) *IntrospectionReader {
+	return &IntrospectionReader{
+		endpoint:     endpoint,
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		httpClient:   httpClient,
+		validation:   validation,
+		uuidSubject:  uuidSubject,
+		repository:   repository,
+		cache:        cache.New(maxTtl, time.Minute),
+		maxTtl:       maxTtl,
+	}
+}
+
+func NewIntrospectionWithConfig(config *viper.Viper, repository AccountsRepository) (*IntrospectionReader, error) {
+	config.SetDefault("auth.introspection.subject_type", "account_id")
+	config.SetDefault("auth.introspection.timeout", 5*time.Second)
+	config.SetDefault("auth.introspection.cache_max_ttl", 5*time.Minute)
+
+	endpoint := config.GetString("auth.introspection.url")
+	if endpoint == "" {
+		return nil, fmt.Errorf("auth.introspection.url must be specified")
+	}
+
+	var uuidSubject bool
+	var defaultSubjectPattern string
+	switch subjectType := config.GetString("auth.introspection.subject_type"); subjectType {
+	case "account_id":
+		uuidSubject = false
+		defaultSubjectPattern = accountIdSubjectPattern
+	case "uuid":
+		uuidSubject = true
+		defaultSubjectPattern = uuidSubjectPattern
+	default:
+		return nil, fmt.Errorf("unknown subject type %s, expected account_id or uuid", subjectType)
+	}
+
+	validation, err := NewTokenValidationWithConfig(config, "auth.introspection", defaultSubjectPattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token validation config: %w", err)
+	}
+
+	return NewIntrospection(
+		endpoint,
+		config.GetString("auth.introspection.client_id"),
+		config.GetString("auth.introspection.client_secret"),
+		&http.Client{Timeout: config.GetDuration("auth.introspection.timeout")},
+		validation,
+		uuidSubject,
+		repository,
+		config.GetDuration("auth.introspection.cache_max_ttl"),
+	), nil
+}
+
+func (r *IntrospectionReader) GetUuidFromAuthorizationHeader(ctx context.Context, authHeader string) (string, error) {
+	introspectCtx, span := tracer.Start(ctx, "authreader.IntrospectToken")
+	subject, err := r.extractSubject(introspectCtx, authHeader)
+	endSpan(span, err)
+	if err != nil {
+		reportRejection(ctx, err)
+
+		return "", err
+	}
+
+	if r.uuidSubject {
+		uuid, err := uuidLib.Parse(subject)
+		if err != nil {
+			err = &unauthorizedError{reason: ReasonInvalidSubject, msg: "the sub value doesn't contain a valid uuid", err: err}
+			reportRejection(ctx, err)
+
+			return "", err
+		}
+
+		// The token may outlive the account's ban or deletion, so its status is checked the same way
+		return findActiveAccountByUuid(ctx, r.repository, uuid.String())
+	}
+
+	userId, err := parseUserId(subject)
+	if err != nil {
+		reportRejection(ctx, err)
+
+		return "", err
+	}
+
+	return findActiveAccountUuid(ctx, r.repository, userId)
+}
+
+func (r *IntrospectionReader) extractSubject(ctx context.Context, authHeader string) (string, error) {
+	token, found := strings.CutPrefix(authHeader, "Bearer ")
+	if !found || token == "" {
+		return "", &unauthorizedError{reason: ReasonInvalidHeader, msg: "authorization header has an invalid format"}
+	}
+
+	// Tokens are hashed, so they aren't kept in memory as is
+	tokenHash := sha256.Sum256([]byte(token))
+	cacheKey := hex.EncodeToString(tokenHash[:])
+	if cached, found := r.cache.Get(cacheKey); found {
+		result := cached.(introspectionResult)
+		recordTokenDetails(ctx, result.token)
+
+		return result.subject, nil
+	}
+
+	response, err := r.introspect(ctx, token)
+	if err != nil {
+		return "", err
+	}
+
+	if !response.Active {
+		return "", &unauthorizedError{reason: ReasonInactive, msg: "the token is not active"}
+	}
+
+	now := timeNow()
+	if response.ExpiresAt != nil && !response.ExpiresAt.After(now.Add(-r.validation.Leeway)) {
+		return "", &unauthorizedError{reason: ReasonExpired, msg: "the token is expired"}
+	}
+
+	subject, err := r.validation.validate(&response.claims)
+	if err != nil {
+		return "", err
+	}
+
+	result := introspectionResult{subject, tokenDetailsFromClaims(&response.claims)}
+	recordTokenDetails(ctx, result.token)
+
+	ttl := r.maxTtl
+	if response.ExpiresAt != nil && response.ExpiresAt.Sub(now) < ttl {
+		ttl = response.ExpiresAt.Sub(now)
+	}
+
+	if ttl > 0 {
+		r.cache.Set(cacheKey, result, ttl)
+	}
+
+	return subject, nil
+}
+
+func (r *IntrospectionReader) introspect(ctx context.Context, token string) (*introspectionResponse, error) {
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {"access_token"},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", r.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("unable to form a correct introspection request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if r.clientId != "" {
+		// See https://datatracker.ietf.org/doc/html/rfc6749#section-2.3.1
+		req.SetBasicAuth(url.QueryEscape(r.clientId), url.QueryEscape(r.clientSecret))
+	}
+
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to perform an introspection request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received unexpected response code from introspection endpoint: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxIntrospectionResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read introspection response: %w", err)
+	}
+
+	var response introspectionResponse
+	err = json.UnmarshalContext(ctx, body, &response)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse introspection response: %w", err)
+	}
+
+	return &response, nil
+}
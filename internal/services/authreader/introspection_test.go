@@ -0,0 +1,156 @@
+package authreader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func serveIntrospection(t *testing.T, responses map[string]string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if clientId, clientSecret, _ := r.BasicAuth(); clientId != "profilecerts" || clientSecret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		response, found := responses[r.PostFormValue("token")]
+		if !found {
+			response = `{"active":false}`
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestIntrospectionReader(t *testing.T) {
+	server := serveIntrospection(t, map[string]string{
+		"inactive":     `{"active":false}`,
+		"wrong-scope":  `{"active":true,"scope":"account_info","sub":"ely|1"}`,
+		"active-id":    `{"active":true,"scope":"minecraft_server_session","sub":"ely|1"}`,
+		"banned-id":    `{"active":true,"scope":"minecraft_server_session","sub":"ely|2"}`,
+		"deleted-id":   `{"active":true,"scope":"minecraft_server_session","sub":"ely|3"}`,
+		"active-uuid":  `{"active":true,"scope":"minecraft_server_session","sub":"` + activeUuid + `"}`,
+		"banned-uuid":  `{"active":true,"scope":"minecraft_server_session","sub":"` + bannedUuid + `"}`,
+		"deleted-uuid": `{"active":true,"scope":"minecraft_server_session","sub":"c0ffee00-0000-4000-8000-000000000000"}`,
+		"invalid-uuid": `{"active":true,"scope":"minecraft_server_session","sub":"ely|not-a-uuid"}`,
+	})
+
+	newReader := func(uuidSubject bool) *IntrospectionReader {
+		validation := newTestValidation()
+		if uuidSubject {
+			validation.SubjectPattern = regexp.MustCompile(uuidSubjectPattern)
+		}
+
+		return NewIntrospection(server.URL, "profilecerts", "secret", server.Client(), validation, uuidSubject, newAccountsRepositoryStub(), time.Minute)
+	}
+
+	testCases := []struct {
+		name          string
+		uuidSubject   bool
+		token         string
+		expectedUuid  string
+		expectedError func(t *testing.T, err error)
+	}{
+		{name: "inactive token", token: "inactive", expectedError: expectUnauthorized(ReasonInactive)},
+		{name: "unknown token", token: "unknown", expectedError: expectUnauthorized(ReasonInactive)},
+		{name: "wrong scope", token: "wrong-scope", expectedError: expectUnauthorized(ReasonInsufficientScope)},
+		{name: "active account id subject", token: "active-id", expectedUuid: activeUuid},
+		{name: "banned account id subject", token: "banned-id", expectedError: expectAccountStatus(AccountStatusBanned, bannedUuid)},
+		{name: "deleted account id subject", token: "deleted-id", expectedError: expectAccountStatus(AccountStatusDeleted, "")},
+		{name: "active account uuid subject", uuidSubject: true, token: "active-uuid", expectedUuid: activeUuid},
+		{name: "banned account uuid subject", uuidSubject: true, token: "banned-uuid", expectedError: expectAccountStatus(AccountStatusBanned, bannedUuid)},
+		{name: "deleted account uuid subject", uuidSubject: true, token: "deleted-uuid", expectedError: expectAccountStatus(AccountStatusDeleted, "")},
+		{name: "invalid uuid subject", uuidSubject: true, token: "invalid-uuid", expectedError: expectUnauthorized(ReasonInvalidSubject)},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			reader := newReader(testCase.uuidSubject)
+			uuid, err := reader.GetUuidFromAuthorizationHeader(context.Background(), "Bearer "+testCase.token)
+			if testCase.expectedError != nil {
+				testCase.expectedError(t, err)
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if uuid != testCase.expectedUuid {
+				t.Fatalf("expected uuid %s, got %s", testCase.expectedUuid, uuid)
+			}
+		})
+	}
+}
+
+func TestIntrospectionReaderCache(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"active":true,"scope":"minecraft_server_session","sub":"ely|1"}`))
+	}))
+	defer server.Close()
+
+	reader := NewIntrospection(server.URL, "", "", server.Client(), newTestValidation(), false, newAccountsRepositoryStub(), time.Minute)
+	for i := 0; i < 3; i++ {
+		_, err := reader.GetUuidFromAuthorizationHeader(context.Background(), "Bearer opaque-token")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if calls := calls.Load(); calls != 1 {
+		t.Fatalf("expected the active token to be cached, got %d introspection requests", calls)
+	}
+
+	_, _ = reader.GetUuidFromAuthorizationHeader(context.Background(), "Bearer another-token")
+	if calls := calls.Load(); calls != 2 {
+		t.Fatalf("expected another token to be introspected, got %d introspection requests", calls)
+	}
+}
+
+func TestNewIntrospectionWithConfig(t *testing.T) {
+	server := serveIntrospection(t, map[string]string{
+		"uuid": `{"active":true,"scope":"minecraft_server_session","sub":"` + strings.ReplaceAll(activeUuid, "-", "") + `"}`,
+	})
+
+	config := viper.New()
+	config.Set("auth.introspection.url", server.URL)
+	config.Set("auth.introspection.client_id", "profilecerts")
+	config.Set("auth.introspection.client_secret", "secret")
+	config.Set("auth.introspection.subject_type", "uuid")
+
+	// The default subject pattern follows the subject type
+	reader, err := NewIntrospectionWithConfig(config, newAccountsRepositoryStub())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uuid, err := reader.GetUuidFromAuthorizationHeader(context.Background(), "Bearer uuid")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if uuid != activeUuid {
+		t.Fatalf("expected uuid %s, got %s", activeUuid, uuid)
+	}
+
+	config.Set("auth.introspection.subject_type", "username")
+	_, err = NewIntrospectionWithConfig(config, newAccountsRepositoryStub())
+	if err == nil {
+		t.Fatal("expected an error for the unknown subject type")
+	}
+}
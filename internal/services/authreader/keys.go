@@ -0,0 +1,133 @@
+package authreader
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// A public key, published by the Accounts to verify its tokens
+type PublicKey struct {
+	// Optional. When empty, the key can only be selected for tokens without the kid header
+	Kid string
+	// Optional. When empty, the algorithm is inferred from the key type
+	Alg string
+	Key crypto.PublicKey
+}
+
+type PublicKeySet struct {
+	Keys []*PublicKey
+	// When true, the set hasn't changed since the previous fetch and Keys are empty
+	Unchanged bool
+	// How long the set may be cached according to the publisher. 0 when unknown or MaxAgeRevalidate
+	MaxAge time.Duration
+}
+
+// The MaxAge of a set that the publisher doesn't allow to use without revalidation, e.g. because of no-cache
+const MaxAgeRevalidate time.Duration = -1
+
+var errUnknownKid = errors.New("there is no public key with the kid from the token")
+var errAlgorithmMismatch = errors.New("there is no public key for the token's algorithm")
+
+type pinnedKey struct {
+	kid string
+	alg string
+	key crypto.PublicKey
+}
+
+type keySet struct {
+	keys []pinnedKey
+}
+
+// Keys with an unsupported algorithm or with an algorithm that doesn't match the key type are skipped,
+// so a single bad key in the published set doesn't break verification with the rest of them
+func newKeySet(publicKeys []*PublicKey) *keySet {
+	set := &keySet{keys: make([]pinnedKey, 0, len(publicKeys))}
+	for _, publicKey := range publicKeys {
+		alg, err := pinAlgorithm(publicKey)
+		if err != nil {
+			slog.Warn(
+				"skipping an Accounts public key",
+				slog.Any("err", err),
+				slog.String("kid", publicKey.Kid),
+				slog.String("alg", publicKey.Alg),
+			)
+			continue
+		}
+
+		set.keys = append(set.keys, pinnedKey{publicKey.Kid, alg, publicKey.Key})
+	}
+
+	return set
+}
+
+func (s *keySet) hasKid(kid string) bool {
+	for _, key := range s.keys {
+		if key.kid == kid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Selects keys by the token's kid (when present) and returns only those pinned to the token's algorithm
+func (s *keySet) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	alg := token.Method.Alg()
+
+	result := jwt.VerificationKeySet{}
+	kidFound := false
+	for _, key := range s.keys {
+		if kid != "" && key.kid != kid {
+			continue
+		}
+
+		kidFound = true
+		if key.alg == alg {
+			result.Keys = append(result.Keys, key.key)
+		}
+	}
+
+	if kid != "" && !kidFound {
+		return nil, errUnknownKid
+	}
+
+	if len(result.Keys) == 0 {
+		return nil, fmt.Errorf("%w %s", errAlgorithmMismatch, alg)
+	}
+
+	return result, nil
+}
+
+func pinAlgorithm(publicKey *PublicKey) (string, error) {
+	var inferred string
+	switch key := publicKey.Key.(type) {
+	case *rsa.PublicKey:
+		inferred = jwt.SigningMethodRS256.Alg()
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return "", fmt.Errorf("unsupported elliptic curve %s", key.Curve.Params().Name)
+		}
+
+		inferred = jwt.SigningMethodES256.Alg()
+	case ed25519.PublicKey:
+		inferred = jwt.SigningMethodEdDSA.Alg()
+	default:
+		return "", fmt.Errorf("unsupported key type %T", publicKey.Key)
+	}
+
+	if publicKey.Alg != "" && publicKey.Alg != inferred {
+		return "", fmt.Errorf("the %s algorithm doesn't match the key type %T", publicKey.Alg, publicKey.Key)
+	}
+
+	return inferred, nil
+}
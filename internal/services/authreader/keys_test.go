@@ -0,0 +1,114 @@
+package authreader
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func signTokenWithKid(t *testing.T, method jwt.SigningMethod, key interface{}, kid string) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, serverSessionClaims("ely|1"))
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func parseWithKeySet(set *keySet, token string) error {
+	_, err := jwt.ParseWithClaims(token, &claims{}, set.keyfunc)
+
+	return err
+}
+
+func TestKeySet(t *testing.T) {
+	ecKey := newSigningKey(t)
+	otherEcKey := newSigningKey(t)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edPublicKey, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := newKeySet([]*PublicKey{
+		{Kid: "ec", Alg: "ES256", Key: &ecKey.PublicKey},
+		{Kid: "other-ec", Key: &otherEcKey.PublicKey},
+		{Kid: "rsa", Alg: "RS256", Key: &rsaKey.PublicKey},
+		{Kid: "ed", Alg: "EdDSA", Key: edPublicKey},
+		// Skipped, because the algorithm doesn't match the key type
+		{Kid: "mismatch", Alg: "ES256", Key: &rsaKey.PublicKey},
+		// Skipped, because the curve isn't supported
+		{Kid: "p384", Key: &p384Key.PublicKey},
+	})
+
+	rsaPublicKeyDer, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		token   string
+		isValid bool
+	}{
+		{"ES256 with kid", signTokenWithKid(t, jwt.SigningMethodES256, ecKey, "ec"), true},
+		{"ES256 with the inferred algorithm", signTokenWithKid(t, jwt.SigningMethodES256, otherEcKey, "other-ec"), true},
+		{"RS256 with kid", signTokenWithKid(t, jwt.SigningMethodRS256, rsaKey, "rsa"), true},
+		{"EdDSA with kid", signTokenWithKid(t, jwt.SigningMethodEdDSA, edKey, "ed"), true},
+		{"without kid", signTokenWithKid(t, jwt.SigningMethodES256, otherEcKey, ""), true},
+		{"kid of another key", signTokenWithKid(t, jwt.SigningMethodES256, otherEcKey, "ec"), false},
+		{"algorithm that doesn't match the key", signTokenWithKid(t, jwt.SigningMethodRS256, rsaKey, "ec"), false},
+		{"not pinned algorithm", signTokenWithKid(t, jwt.SigningMethodRS512, rsaKey, "rsa"), false},
+		{"HMAC with the public key as the secret", signTokenWithKid(t, jwt.SigningMethodHS256, rsaPublicKeyDer, "rsa"), false},
+		{"skipped key", signTokenWithKid(t, jwt.SigningMethodRS256, rsaKey, "mismatch"), false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := parseWithKeySet(set, testCase.token)
+			if testCase.isValid && err != nil {
+				t.Fatalf("expected the token to be valid, got %v", err)
+			}
+
+			if !testCase.isValid && err == nil {
+				t.Fatal("expected the token to be rejected")
+			}
+		})
+	}
+
+	t.Run("algorithm confusion", func(t *testing.T) {
+		err := parseWithKeySet(set, signTokenWithKid(t, jwt.SigningMethodHS256, rsaPublicKeyDer, ""))
+		if !errors.Is(err, errAlgorithmMismatch) {
+			t.Fatalf("expected the algorithm mismatch error, got %v", err)
+		}
+	})
+
+	t.Run("unknown kid", func(t *testing.T) {
+		err := parseWithKeySet(set, signTokenWithKid(t, jwt.SigningMethodES256, ecKey, "rotated"))
+		if !errors.Is(err, errUnknownKid) {
+			t.Fatalf("expected the unknown kid error, got %v", err)
+		}
+	})
+}
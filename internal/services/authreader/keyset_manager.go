@@ -0,0 +1,269 @@
+package authreader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var timeNow = time.Now
+
+// The fetch is shared between all waiting requests, so it must not depend on a context of any of them
+const fetchTimeout = 10 * time.Second
+
+// The backup is accessed with its own timeout, so a hanging fetch doesn't leave it no time
+const backupTimeout = 3 * time.Second
+
+// The first retry of a failed background refresh is delayed by this or minRefetchInterval, whichever is longer,
+// and the delay doubles with each consecutive failure up to refreshInterval
+const minRetryBackoff = time.Second
+
+// Returned when there is no key set or the last known one is older than the allowed staleness
+var ErrPublicKeysUnavailable = errors.New("accounts public keys are unavailable")
+
+// Keeps the last verified key set, so a new instance can authenticate tokens while the Accounts is unavailable
+type PublicKeysBackup interface {
+	StorePublicKeys(ctx context.Context, keys []*PublicKey, fetchedAt time.Time) error
+	// Should return nil keys when there is no stored set
+	LoadPublicKeys(ctx context.Context) ([]*PublicKey, time.Time, error)
+}
+
+type KeySetOptions struct {
+	// Used when the publisher doesn't specify the max age of the set
+	RefreshInterval time.Duration
+	// Limits refetches caused by tokens with an unknown kid
+	MinRefetchInterval time.Duration
+	// When the last successfully fetched set is older than this, tokens are rejected. 0 disables the limit
+	MaxStaleness time.Duration
+}
+
+type fetchCall struct {
+	done chan struct{}
+	err  error
+}
+
+// Holds the last known good key set and refreshes it:
+//   - in the background, once the set becomes older than its max age, provided by the publisher, or refreshInterval.
+//     Failed refreshes are retried with an exponential backoff;
+//   - synchronously, when a token has an unknown kid, but not more often than once per minRefetchInterval.
+//
+// Only one fetch is performed at a time. When a fetch fails, the previous set continues to be served
+// until it exceeds the max staleness. The backup is loaded on start and is refreshed after each successful fetch,
+// so its age reflects the last time the set has been confirmed by the publisher.
+type keySetManager struct {
+	provider AccountsPublicKeyProvider
+	// Optional
+	backup  PublicKeysBackup
+	options KeySetOptions
+
+	mu      sync.Mutex
+	current *keySet
+	// The keys the current set has been built from, they are written to the backup
+	published     []*PublicKey
+	fetchedAt     time.Time
+	ttl           time.Duration
+	lastAttemptAt time.Time
+	// Consecutive failed fetches, they delay background refreshes
+	failures int
+	inflight *fetchCall
+}
+
+func newKeySetManager(provider AccountsPublicKeyProvider, backup PublicKeysBackup, options KeySetOptions) *keySetManager {
+	m := &keySetManager{
+		provider: provider,
+		backup:   backup,
+		options:  options,
+	}
+
+	if backup != nil && m.restoreFromBackup() {
+		slog.Info("Accounts public keys have been loaded from the backup", slog.Time("fetched_at", m.fetchedAt))
+	}
+
+	return m
+}
+
+func (m *keySetManager) get(ctx context.Context) (*keySet, error) {
+	m.mu.Lock()
+	current := m.current
+	if current != nil && !m.isTooStale() {
+		if timeNow().Sub(m.fetchedAt) >= m.ttl && timeNow().Sub(m.lastAttemptAt) >= m.retryBackoff() {
+			m.startFetch()
+		}
+
+		m.mu.Unlock()
+
+		return current, nil
+	}
+
+	call := m.startFetch()
+	m.mu.Unlock()
+
+	return m.wait(ctx, call)
+}
+
+// Returns a newer key set if it contains the kid or the previous one when a refetch isn't allowed yet or has failed
+func (m *keySetManager) refreshForKid(ctx context.Context, kid string) (*keySet, error) {
+	m.mu.Lock()
+	current := m.current
+	if current != nil && !m.isTooStale() && (current.hasKid(kid) || timeNow().Sub(m.lastAttemptAt) < m.options.MinRefetchInterval) {
+		m.mu.Unlock()
+
+		return current, nil
+	}
+
+	call := m.startFetch()
+	m.mu.Unlock()
+
+	return m.wait(ctx, call)
+}
+
+// Must be called with the mutex held
+func (m *keySetManager) startFetch() *fetchCall {
+	if m.inflight != nil {
+		return m.inflight
+	}
+
+	call := &fetchCall{done: make(chan struct{})}
+	m.inflight = call
+	m.lastAttemptAt = timeNow()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+		defer cancel()
+
+		publicKeySet, err := m.provider.GetPublicKeys(ctx)
+
+		m.mu.Lock()
+		if err == nil && publicKeySet.Unchanged && m.current == nil {
+			err = errors.New("the publisher reported the key set as unchanged, but there is no previous set")
+		}
+
+		var published []*PublicKey
+		if err == nil {
+			if !publicKeySet.Unchanged {
+				m.current = newKeySet(publicKeySet.Keys)
+				m.published = publicKeySet.Keys
+			}
+
+			m.fetchedAt = timeNow()
+			m.ttl = m.ttlFor(publicKeySet)
+			m.failures = 0
+			published = m.published
+		} else {
+			call.err = err
+			m.failures++
+			if m.current != nil {
+				slog.Warn(
+					"unable to refresh Accounts public keys, the previous set will be used",
+					slog.Any("err", err),
+					slog.Time("fetched_at", m.fetchedAt),
+				)
+			}
+		}
+
+		restoreFromBackup := err != nil && m.current == nil && m.backup != nil
+		m.mu.Unlock()
+
+		// Unchanged sets are stored too, so the backup doesn't outgrow the max staleness while the keys are stable
+		if published != nil && m.backup != nil {
+			backupCtx, cancelBackup := context.WithTimeout(context.WithoutCancel(ctx), backupTimeout)
+			backupErr := m.backup.StorePublicKeys(backupCtx, published, timeNow())
+			cancelBackup()
+			if backupErr != nil {
+				slog.Warn("unable to back up Accounts public keys", slog.Any("err", backupErr))
+			}
+		}
+
+		if restoreFromBackup && m.restoreFromBackup() {
+			slog.Warn("Accounts public keys are unavailable, using the backup", slog.Time("fetched_at", m.fetchedAt))
+		}
+
+		m.mu.Lock()
+		m.inflight = nil
+		m.mu.Unlock()
+
+		close(call.done)
+	}()
+
+	return call
+}
+
+// Reports whether the backup has been used. It's used only when there is no current set
+func (m *keySetManager) restoreFromBackup() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), backupTimeout)
+	defer cancel()
+
+	publicKeys, fetchedAt, err := m.backup.LoadPublicKeys(ctx)
+	if err != nil {
+		slog.Warn("unable to load Accounts public keys from the backup", slog.Any("err", err))
+		return false
+	}
+
+	if publicKeys == nil {
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.current != nil {
+		return false
+	}
+
+	m.current = newKeySet(publicKeys)
+	m.published = publicKeys
+	m.fetchedAt = fetchedAt
+	m.ttl = m.options.RefreshInterval
+
+	return true
+}
+
+// Must be called with the mutex held
+func (m *keySetManager) isTooStale() bool {
+	return m.options.MaxStaleness > 0 && timeNow().Sub(m.fetchedAt) > m.options.MaxStaleness
+}
+
+// Must be called with the mutex held
+func (m *keySetManager) retryBackoff() time.Duration {
+	if m.failures == 0 {
+		return 0
+	}
+
+	base := max(m.options.MinRefetchInterval, minRetryBackoff)
+	backoff := base << min(m.failures-1, 16)
+
+	return min(backoff, max(m.options.RefreshInterval, base))
+}
+
+// The publisher's max age is preferred, but it mustn't cause refetches more often than minRefetchInterval allows
+func (m *keySetManager) ttlFor(publicKeySet *PublicKeySet) time.Duration {
+	switch {
+	case publicKeySet.MaxAge == MaxAgeRevalidate:
+		// Revalidating the set for each token would flood the publisher, so it's done as often as refetches are allowed
+		return m.options.MinRefetchInterval
+	case publicKeySet.MaxAge <= 0:
+		return m.options.RefreshInterval
+	default:
+		return max(publicKeySet.MaxAge, m.options.MinRefetchInterval)
+	}
+}
+
+func (m *keySetManager) wait(ctx context.Context, call *fetchCall) (*keySet, error) {
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.current == nil || m.isTooStale() {
+		return nil, fmt.Errorf("%w: %w", ErrPublicKeysUnavailable, call.err)
+	}
+
+	return m.current, nil
+}
@@ -0,0 +1,476 @@
+package authreader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testKeySetOptions = KeySetOptions{RefreshInterval: time.Hour, MinRefetchInterval: 30 * time.Second}
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// Replaces the package's clock until the end of the test. Background jobs must be finished by then
+func useFakeClock(t *testing.T) *fakeClock {
+	clock := &fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	timeNow = clock.Now
+	t.Cleanup(func() {
+		timeNow = time.Now
+	})
+
+	return clock
+}
+
+type publicKeysProviderStub struct {
+	mu     sync.Mutex
+	keys   []*PublicKey
+	maxAge time.Duration
+	// When set, fetches report the set as unchanged
+	unchanged bool
+	err       error
+	calls     int
+	// When set, fetches wait until it's closed
+	block chan struct{}
+}
+
+func newPublicKeysProvider(keys ...*PublicKey) *publicKeysProviderStub {
+	return &publicKeysProviderStub{keys: keys}
+}
+
+func (p *publicKeysProviderStub) GetPublicKeys(ctx context.Context) (*PublicKeySet, error) {
+	p.mu.Lock()
+	p.calls++
+	block := p.block
+	p.mu.Unlock()
+
+	if block != nil {
+		<-block
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	if p.unchanged {
+		return &PublicKeySet{Unchanged: true, MaxAge: p.maxAge}, nil
+	}
+
+	return &PublicKeySet{Keys: p.keys, MaxAge: p.maxAge}, nil
+}
+
+func (p *publicKeysProviderStub) respond(keys []*PublicKey, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.keys = keys
+	p.err = err
+}
+
+func (p *publicKeysProviderStub) callsCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.calls
+}
+
+func waitForFetch(m *keySetManager) {
+	m.mu.Lock()
+	call := m.inflight
+	m.mu.Unlock()
+
+	if call != nil {
+		<-call.done
+	}
+}
+
+func newTestPublicKey(t *testing.T, kid string) *PublicKey {
+	return &PublicKey{Kid: kid, Alg: "ES256", Key: &newSigningKey(t).PublicKey}
+}
+
+func TestKeySetManagerSharesFetch(t *testing.T) {
+	provider := newPublicKeysProvider(newTestPublicKey(t, "a"))
+	provider.block = make(chan struct{})
+	m := newKeySetManager(provider, nil, testKeySetOptions)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.get(context.Background())
+			errs <- err
+		}()
+	}
+
+	close(provider.block)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if calls := provider.callsCount(); calls != 1 {
+		t.Fatalf("expected a single fetch, got %d", calls)
+	}
+}
+
+func TestKeySetManagerFirstFetch(t *testing.T) {
+	t.Run("failure", func(t *testing.T) {
+		provider := newPublicKeysProvider()
+		provider.err = errors.New("accounts is down")
+		m := newKeySetManager(provider, nil, testKeySetOptions)
+
+		_, err := m.get(context.Background())
+		if err == nil {
+			t.Fatal("expected an error without any key set")
+		}
+	})
+
+	t.Run("cancelled request", func(t *testing.T) {
+		provider := newPublicKeysProvider(newTestPublicKey(t, "a"))
+		provider.block = make(chan struct{})
+		m := newKeySetManager(provider, nil, testKeySetOptions)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := m.get(ctx)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected the context error, got %v", err)
+		}
+
+		// The fetch isn't bound to the request, so its result is kept for the next ones
+		close(provider.block)
+		waitForFetch(m)
+
+		set, err := m.get(context.Background())
+		if err != nil || !set.hasKid("a") {
+			t.Fatalf("expected the fetched set, got %v", err)
+		}
+	})
+}
+
+func TestKeySetManagerServesPreviousSetAndBacksOff(t *testing.T) {
+	clock := useFakeClock(t)
+	provider := newPublicKeysProvider(newTestPublicKey(t, "a"))
+	m := newKeySetManager(provider, nil, testKeySetOptions)
+
+	initial, err := m.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider.respond(nil, errors.New("accounts is down"))
+
+	expectFetches := func(expected int) {
+		t.Helper()
+
+		set, err := m.get(context.Background())
+		if err != nil || set != initial {
+			t.Fatalf("expected the previous set, got %v", err)
+		}
+
+		waitForFetch(m)
+		if calls := provider.callsCount(); calls != expected {
+			t.Fatalf("expected %d fetches, got %d", expected, calls)
+		}
+	}
+
+	expectFetches(1)
+
+	// The set has expired, so it's refreshed in the background
+	clock.Advance(time.Hour)
+	expectFetches(2)
+
+	// The first retry is delayed by the min refetch interval
+	clock.Advance(29 * time.Second)
+	expectFetches(2)
+	clock.Advance(time.Second)
+	expectFetches(3)
+
+	// And the next one is delayed twice as much
+	clock.Advance(30 * time.Second)
+	expectFetches(3)
+	clock.Advance(30 * time.Second)
+	expectFetches(4)
+
+	provider.respond([]*PublicKey{newTestPublicKey(t, "b")}, nil)
+	clock.Advance(2 * time.Minute)
+	_, _ = m.get(context.Background())
+	waitForFetch(m)
+
+	refreshed, err := m.get(context.Background())
+	if err != nil || !refreshed.hasKid("b") {
+		t.Fatalf("expected the refreshed set, got %v", err)
+	}
+
+	if calls := provider.callsCount(); calls != 5 {
+		t.Fatalf("expected 5 fetches, got %d", calls)
+	}
+}
+
+func TestKeySetManagerRefreshesForUnknownKid(t *testing.T) {
+	clock := useFakeClock(t)
+	provider := newPublicKeysProvider(newTestPublicKey(t, "a"))
+	m := newKeySetManager(provider, nil, testKeySetOptions)
+
+	_, err := m.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider.respond([]*PublicKey{newTestPublicKey(t, "a"), newTestPublicKey(t, "b")}, nil)
+
+	// A refetch isn't allowed right after the previous fetch
+	set, err := m.refreshForKid(context.Background(), "b")
+	if err != nil || set.hasKid("b") || provider.callsCount() != 1 {
+		t.Fatalf("expected the previous set without a refetch, got %v after %d fetches", err, provider.callsCount())
+	}
+
+	clock.Advance(30 * time.Second)
+	set, err = m.refreshForKid(context.Background(), "b")
+	if err != nil || !set.hasKid("b") {
+		t.Fatalf("expected the set with the new kid, got %v", err)
+	}
+
+	// Known kids don't cause refetches at all
+	clock.Advance(30 * time.Second)
+	_, _ = m.refreshForKid(context.Background(), "a")
+
+	// And unknown ones are refetched at most once per the min refetch interval
+	_, _ = m.refreshForKid(context.Background(), "c")
+	clock.Advance(10 * time.Second)
+	_, _ = m.refreshForKid(context.Background(), "c")
+
+	if calls := provider.callsCount(); calls != 3 {
+		t.Fatalf("expected 3 fetches, got %d", calls)
+	}
+}
+
+func TestKeySetManagerMaxAge(t *testing.T) {
+	testCases := []struct {
+		name        string
+		maxAge      time.Duration
+		expectedTtl time.Duration
+	}{
+		{name: "unknown", maxAge: 0, expectedTtl: time.Hour},
+		{name: "publisher's max age", maxAge: 10 * time.Minute, expectedTtl: 10 * time.Minute},
+		{name: "max age shorter than the min refetch interval", maxAge: 5 * time.Second, expectedTtl: 30 * time.Second},
+		{name: "revalidation", maxAge: MaxAgeRevalidate, expectedTtl: 30 * time.Second},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			clock := useFakeClock(t)
+			provider := newPublicKeysProvider(newTestPublicKey(t, "a"))
+			provider.maxAge = testCase.maxAge
+			m := newKeySetManager(provider, nil, testKeySetOptions)
+
+			_, err := m.get(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			clock.Advance(testCase.expectedTtl - time.Second)
+			_, _ = m.get(context.Background())
+			waitForFetch(m)
+			if calls := provider.callsCount(); calls != 1 {
+				t.Fatalf("expected the set to be fresh, got %d fetches", calls)
+			}
+
+			clock.Advance(time.Second)
+			_, _ = m.get(context.Background())
+			waitForFetch(m)
+			if calls := provider.callsCount(); calls != 2 {
+				t.Fatalf("expected the set to be refreshed, got %d fetches", calls)
+			}
+		})
+	}
+}
+
+func TestKeySetManagerUnchangedSet(t *testing.T) {
+	t.Run("keeps the current set", func(t *testing.T) {
+		clock := useFakeClock(t)
+		provider := newPublicKeysProvider(newTestPublicKey(t, "a"))
+		m := newKeySetManager(provider, nil, testKeySetOptions)
+
+		initial, err := m.get(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		provider.unchanged = true
+		clock.Advance(time.Hour)
+		_, _ = m.get(context.Background())
+		waitForFetch(m)
+
+		set, err := m.get(context.Background())
+		if err != nil || set != initial {
+			t.Fatalf("expected the current set, got %v", err)
+		}
+
+		// The unchanged set is as fresh as the fetched one
+		if calls := provider.callsCount(); calls != 2 {
+			t.Fatalf("expected 2 fetches, got %d", calls)
+		}
+	})
+
+	t.Run("without the current set", func(t *testing.T) {
+		provider := newPublicKeysProvider()
+		provider.unchanged = true
+		m := newKeySetManager(provider, nil, testKeySetOptions)
+
+		_, err := m.get(context.Background())
+		if err == nil {
+			t.Fatal("expected an error without any key set")
+		}
+	})
+}
+
+type publicKeysBackupStub struct {
+	mu        sync.Mutex
+	keys      []*PublicKey
+	fetchedAt time.Time
+	stores    int
+}
+
+func (b *publicKeysBackupStub) StorePublicKeys(ctx context.Context, keys []*PublicKey, fetchedAt time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.keys = keys
+	b.fetchedAt = fetchedAt
+	b.stores++
+
+	return nil
+}
+
+func (b *publicKeysBackupStub) LoadPublicKeys(ctx context.Context) ([]*PublicKey, time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.keys, b.fetchedAt, nil
+}
+
+func TestKeySetManagerBackup(t *testing.T) {
+	options := KeySetOptions{RefreshInterval: time.Hour, MinRefetchInterval: 30 * time.Second, MaxStaleness: 24 * time.Hour}
+
+	t.Run("loaded on start", func(t *testing.T) {
+		clock := useFakeClock(t)
+		provider := newPublicKeysProvider()
+		provider.err = errors.New("accounts is down")
+		backup := &publicKeysBackupStub{keys: []*PublicKey{newTestPublicKey(t, "a")}, fetchedAt: clock.Now().Add(-12 * time.Hour)}
+		m := newKeySetManager(provider, backup, options)
+
+		set, err := m.get(context.Background())
+		if err != nil || !set.hasKid("a") {
+			t.Fatalf("expected the backed up set, got %v", err)
+		}
+
+		waitForFetch(m)
+	})
+
+	t.Run("too stale", func(t *testing.T) {
+		clock := useFakeClock(t)
+		provider := newPublicKeysProvider()
+		provider.err = errors.New("accounts is down")
+		backup := &publicKeysBackupStub{keys: []*PublicKey{newTestPublicKey(t, "a")}, fetchedAt: clock.Now().Add(-25 * time.Hour)}
+		m := newKeySetManager(provider, backup, options)
+
+		_, err := m.get(context.Background())
+		if !errors.Is(err, ErrPublicKeysUnavailable) {
+			t.Fatalf("expected the unavailable keys error, got %v", err)
+		}
+	})
+
+	t.Run("refreshed after fetches", func(t *testing.T) {
+		clock := useFakeClock(t)
+		provider := newPublicKeysProvider(newTestPublicKey(t, "a"))
+		backup := &publicKeysBackupStub{}
+		m := newKeySetManager(provider, backup, options)
+
+		_, err := m.get(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if backup.stores != 1 || len(backup.keys) != 1 || !backup.fetchedAt.Equal(clock.Now()) {
+			t.Fatalf("expected the fetched set to be backed up, got %d stores", backup.stores)
+		}
+
+		// The unchanged set is confirmed by the publisher, so the backup's age is renewed
+		provider.unchanged = true
+		clock.Advance(time.Hour)
+		_, _ = m.get(context.Background())
+		waitForFetch(m)
+
+		if backup.stores != 2 || len(backup.keys) != 1 || !backup.fetchedAt.Equal(clock.Now()) {
+			t.Fatalf("expected the unchanged set to be backed up, got %d stores", backup.stores)
+		}
+	})
+
+	t.Run("used when the first fetch fails", func(t *testing.T) {
+		clock := useFakeClock(t)
+		provider := newPublicKeysProvider()
+		provider.err = errors.New("accounts is down")
+		backup := &publicKeysBackupStub{}
+		m := newKeySetManager(provider, backup, options)
+
+		// Another instance has backed up the keys in the meantime
+		_ = backup.StorePublicKeys(context.Background(), []*PublicKey{newTestPublicKey(t, "a")}, clock.Now())
+
+		set, err := m.get(context.Background())
+		if err != nil || !set.hasKid("a") {
+			t.Fatalf("expected the backed up set, got %v", err)
+		}
+	})
+}
+
+func TestKeySetManagerMaxStaleness(t *testing.T) {
+	clock := useFakeClock(t)
+	provider := newPublicKeysProvider(newTestPublicKey(t, "a"))
+	m := newKeySetManager(provider, nil, KeySetOptions{RefreshInterval: time.Hour, MinRefetchInterval: 30 * time.Second, MaxStaleness: 24 * time.Hour})
+
+	_, err := m.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider.respond(nil, errors.New("accounts is down"))
+	clock.Advance(24 * time.Hour)
+	if _, err := m.get(context.Background()); err != nil {
+		t.Fatalf("expected the previous set to be served, got %v", err)
+	}
+
+	waitForFetch(m)
+	clock.Advance(time.Second)
+	_, err = m.get(context.Background())
+	if !errors.Is(err, ErrPublicKeysUnavailable) {
+		t.Fatalf("expected the unavailable keys error, got %v", err)
+	}
+}
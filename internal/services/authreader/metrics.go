@@ -0,0 +1,27 @@
+package authreader
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var rejections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "profilecerts",
+	Subsystem: "authreader",
+	Name:      "rejections_total",
+	Help:      "The number of tokens rejected by auth readers, partitioned by the rejection reason",
+}, []string{"reason"})
+
+var authentications = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "profilecerts",
+	Subsystem: "authreader",
+	Name:      "authentications_total",
+	Help:      "The number of requests authenticated by each auth reader of the chain",
+}, []string{"reader"})
+
+var cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "profilecerts",
+	Subsystem: "authreader",
+	Name:      "cache_lookups_total",
+	Help:      "The number of token cache lookups, partitioned by the result",
+}, []string{"result"})
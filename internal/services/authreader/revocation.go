@@ -0,0 +1,226 @@
+package authreader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+type RevocationSource interface {
+	// Should report whether the token with the id has been revoked (the id may be empty) and the moment
+	// before which all tokens of the account have been revoked (zero when there is no such moment)
+	FindRevocations(ctx context.Context, uuid string, tokenId string) (bool, time.Time, error)
+}
+
+// Implemented by readers that remember accepted tokens
+type authorizationHeaderInvalidator interface {
+	InvalidateAuthorizationHeader(authHeader string)
+}
+
+// Consults the revocation source after the wrapped reader has accepted the token. It must wrap the CachedReader,
+// so tokens revoked after being cached are rejected too
+type RevocationCheckingReader struct {
+	reader     Reader
+	source     RevocationSource
+	failClosed bool
+}
+
+func NewRevocationChecking(reader Reader, source RevocationSource, failClosed bool) *RevocationCheckingReader {
+	return &RevocationCheckingReader{reader, source, failClosed}
+}
+
+func NewRevocationCheckingWithConfig(config *viper.Viper, reader Reader, source RevocationSource) (*RevocationCheckingReader, error) {
+	config.SetDefault("auth.revocation.fail_mode", "open")
+
+	var failClosed bool
+	switch mode := config.GetString("auth.revocation.fail_mode"); mode {
+	case "open":
+		failClosed = false
+	case "closed":
+		failClosed = true
+	default:
+		return nil, fmt.Errorf("unknown revocation fail mode %s, expected open or closed", mode)
+	}
+
+	return NewRevocationChecking(reader, source, failClosed), nil
+}
+
+func (r *RevocationCheckingReader) GetUuidFromAuthorizationHeader(ctx context.Context, authHeader string) (string, error) {
+	ctx, details := ensureAuthDetails(ctx)
+	uuid, err := r.reader.GetUuidFromAuthorizationHeader(ctx, authHeader)
+	if err != nil {
+		return "", err
+	}
+
+	tokenRevoked, revokedBefore, err := r.source.FindRevocations(ctx, uuid, details.token.Id)
+	if err != nil {
+		if r.failClosed {
+			return "", fmt.Errorf("unable to check whether the token has been revoked: %w", err)
+		}
+
+		slog.WarnContext(ctx, "unable to check whether the token has been revoked, accepting it", slog.Any("err", err))
+
+		return uuid, nil
+	}
+
+	if tokenRevoked || isRevokedByAccount(revokedBefore, details.token) {
+		// The revocation is checked on each request anyway, but there is no point in keeping the token
+		if invalidator, ok := r.reader.(authorizationHeaderInvalidator); ok {
+			invalidator.InvalidateAuthorizationHeader(authHeader)
+		}
+
+		err := &unauthorizedError{reason: ReasonRevoked, msg: "the token has been revoked"}
+		reportRejection(ctx, err)
+
+		return "", err
+	}
+
+	return uuid, nil
+}
+
+// A snapshot of revoked tokens, published by the Accounts
+type RevocationList struct {
+	// Ids (jti) of the revoked tokens
+	TokenIds []string
+	// Tokens of the account issued before the time are revoked
+	Accounts map[string]time.Time
+}
+
+type RevocationListProvider interface {
+	GetRevocationList(ctx context.Context) (*RevocationList, error)
+}
+
+// Periodically polls the revocation list and checks tokens against the last successfully fetched one
+type PolledRevocationList struct {
+	provider     RevocationListProvider
+	pollInterval time.Duration
+	// When the list hasn't been refreshed for this long, it's considered unavailable
+	maxStaleness time.Duration
+
+	mu        sync.RWMutex
+	tokenIds  map[string]struct{}
+	accounts  map[string]time.Time
+	fetchedAt time.Time
+}
+
+func NewPolledRevocationList(provider RevocationListProvider, pollInterval time.Duration, maxStaleness time.Duration) *PolledRevocationList {
+	return &PolledRevocationList{
+		provider:     provider,
+		pollInterval: pollInterval,
+		maxStaleness: maxStaleness,
+	}
+}
+
+func NewPolledRevocationListWithConfig(config *viper.Viper, provider RevocationListProvider) *PolledRevocationList {
+	config.SetDefault("auth.revocation.poll_interval", 30*time.Second)
+	config.SetDefault("auth.revocation.max_staleness", 5*time.Minute)
+
+	return NewPolledRevocationList(
+		provider,
+		config.GetDuration("auth.revocation.poll_interval"),
+		config.GetDuration("auth.revocation.max_staleness"),
+	)
+}
+
+// Fetches the list synchronously. Call it before Run, so requests aren't rejected in the fail-closed mode
+// while the first poll is in progress
+func (l *PolledRevocationList) Load(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, l.pollInterval)
+	defer cancel()
+
+	list, err := l.provider.GetRevocationList(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to fetch the revocation list: %w", err)
+	}
+
+	tokenIds := make(map[string]struct{}, len(list.TokenIds))
+	for _, id := range list.TokenIds {
+		tokenIds[id] = struct{}{}
+	}
+
+	l.mu.Lock()
+	l.tokenIds = tokenIds
+	l.accounts = list.Accounts
+	l.fetchedAt = timeNow()
+	l.mu.Unlock()
+
+	return nil
+}
+
+// Blocks until the ctx is done. The first poll is skipped when the list has already been loaded
+func (l *PolledRevocationList) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.pollInterval)
+	defer ticker.Stop()
+
+	if l.Ready(ctx) != nil {
+		l.poll(ctx)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		l.poll(ctx)
+	}
+}
+
+func (l *PolledRevocationList) poll(ctx context.Context) {
+	err := l.Load(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "unable to refresh the revocation list", slog.Any("err", err))
+	}
+}
+
+// Reports an error while the list hasn't been loaded yet or is too stale. Use it as a readiness check,
+// so the instance doesn't receive requests it would reject in the fail-closed mode
+func (l *PolledRevocationList) Ready(ctx context.Context) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.checkFreshness()
+}
+
+// Must be called with the mutex held
+func (l *PolledRevocationList) checkFreshness() error {
+	if l.fetchedAt.IsZero() {
+		return errors.New("the revocation list hasn't been loaded yet")
+	}
+
+	if timeNow().Sub(l.fetchedAt) > l.maxStaleness {
+		return fmt.Errorf("the revocation list is unavailable, last fetched at %s", l.fetchedAt)
+	}
+
+	return nil
+}
+
+func (l *PolledRevocationList) FindRevocations(ctx context.Context, uuid string, tokenId string) (bool, time.Time, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	err := l.checkFreshness()
+	if err != nil {
+		return false, time.Time{}, err
+	}
+
+	_, tokenRevoked := l.tokenIds[tokenId]
+
+	return tokenId != "" && tokenRevoked, l.accounts[uuid], nil
+}
+
+// Tokens without the iat claim can't be compared with the moment of revocation. Considering them revoked
+// would reject all future tokens of the account too, so only the revocation by jti applies to them
+func isRevokedByAccount(revokedBefore time.Time, token TokenDetails) bool {
+	if revokedBefore.IsZero() || token.IssuedAt.IsZero() {
+		return false
+	}
+
+	return token.IssuedAt.Before(revokedBefore)
+}
@@ -0,0 +1,188 @@
+package authreader
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Accepts any token as the one described by the details
+type tokenDetailsReader TokenDetails
+
+func (r tokenDetailsReader) GetUuidFromAuthorizationHeader(ctx context.Context, authHeader string) (string, error) {
+	recordTokenDetails(ctx, TokenDetails(r))
+
+	return activeUuid, nil
+}
+
+type revocationSourceStub struct {
+	tokenIds      []string
+	revokedBefore time.Time
+	err           error
+}
+
+func (s *revocationSourceStub) FindRevocations(ctx context.Context, uuid string, tokenId string) (bool, time.Time, error) {
+	if s.err != nil {
+		return false, time.Time{}, s.err
+	}
+
+	for _, id := range s.tokenIds {
+		if tokenId != "" && id == tokenId {
+			return true, s.revokedBefore, nil
+		}
+	}
+
+	return false, s.revokedBefore, nil
+}
+
+func TestRevocationCheckingReader(t *testing.T) {
+	revokedAt := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name          string
+		token         TokenDetails
+		source        *revocationSourceStub
+		failClosed    bool
+		expectedError func(t *testing.T, err error)
+	}{
+		{name: "not revoked", token: TokenDetails{Id: "jti-1"}, source: &revocationSourceStub{tokenIds: []string{"jti-2"}}},
+		{name: "revoked by jti", token: TokenDetails{Id: "jti-1"}, source: &revocationSourceStub{tokenIds: []string{"jti-1"}}, expectedError: expectUnauthorized(ReasonRevoked)},
+		{
+			name:          "issued before the account revocation",
+			token:         TokenDetails{IssuedAt: revokedAt.Add(-time.Second)},
+			source:        &revocationSourceStub{revokedBefore: revokedAt},
+			expectedError: expectUnauthorized(ReasonRevoked),
+		},
+		{name: "issued after the account revocation", token: TokenDetails{IssuedAt: revokedAt}, source: &revocationSourceStub{revokedBefore: revokedAt}},
+		// Otherwise the account couldn't get a certificate with such tokens anymore
+		{name: "without iat after the account revocation", token: TokenDetails{}, source: &revocationSourceStub{revokedBefore: revokedAt}},
+		{
+			name:          "without iat, but revoked by jti",
+			token:         TokenDetails{Id: "jti-1"},
+			source:        &revocationSourceStub{tokenIds: []string{"jti-1"}, revokedBefore: revokedAt},
+			expectedError: expectUnauthorized(ReasonRevoked),
+		},
+		{name: "source failure in the fail-open mode", token: TokenDetails{Id: "jti-1"}, source: &revocationSourceStub{err: errors.New("redis is down")}},
+		{
+			name:          "source failure in the fail-closed mode",
+			token:         TokenDetails{Id: "jti-1"},
+			source:        &revocationSourceStub{err: errors.New("redis is down")},
+			failClosed:    true,
+			expectedError: expectFailure,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			reader := NewRevocationChecking(tokenDetailsReader(testCase.token), testCase.source, testCase.failClosed)
+			uuid, err := reader.GetUuidFromAuthorizationHeader(context.Background(), "Bearer token")
+			if testCase.expectedError != nil {
+				testCase.expectedError(t, err)
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if uuid != activeUuid {
+				t.Fatalf("expected uuid %s, got %s", activeUuid, uuid)
+			}
+		})
+	}
+}
+
+func TestRevocationCheckingReaderInvalidatesCache(t *testing.T) {
+	reader := &countingReader{uuids: map[string]string{"Bearer a": activeUuid}, token: TokenDetails{Id: "jti-1"}}
+	source := &revocationSourceStub{}
+	revocationChecking := NewRevocationChecking(newCachedForTest(t, reader), source, false)
+
+	_, err := revocationChecking.GetUuidFromAuthorizationHeader(context.Background(), "Bearer a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Cached tokens are checked too
+	source.tokenIds = []string{"jti-1"}
+	_, err = revocationChecking.GetUuidFromAuthorizationHeader(context.Background(), "Bearer a")
+	if reason := UnauthorizedReason(err); reason != ReasonRevoked {
+		t.Fatalf("expected the revoked reason, got %v", err)
+	}
+
+	if reader.calls != 1 {
+		t.Fatalf("expected the token to be served from the cache, got %d calls", reader.calls)
+	}
+
+	// And the revoked one isn't kept there anymore
+	source.tokenIds = nil
+	_, _ = revocationChecking.GetUuidFromAuthorizationHeader(context.Background(), "Bearer a")
+	if reader.calls != 2 {
+		t.Fatalf("expected the revoked token to be removed from the cache, got %d calls", reader.calls)
+	}
+}
+
+type revocationListProviderStub struct {
+	list *RevocationList
+	err  error
+}
+
+func (p *revocationListProviderStub) GetRevocationList(ctx context.Context) (*RevocationList, error) {
+	return p.list, p.err
+}
+
+func TestPolledRevocationList(t *testing.T) {
+	clock := useFakeClock(t)
+	revokedBefore := clock.Now().Add(-time.Hour)
+	provider := &revocationListProviderStub{list: &RevocationList{
+		TokenIds: []string{"jti-1"},
+		Accounts: map[string]time.Time{activeUuid: revokedBefore},
+	}}
+	list := NewPolledRevocationList(provider, 30*time.Second, 5*time.Minute)
+
+	if list.Ready(context.Background()) == nil {
+		t.Fatal("expected the list not to be ready before the first load")
+	}
+
+	_, _, err := list.FindRevocations(context.Background(), activeUuid, "jti-1")
+	if err == nil {
+		t.Fatal("expected an error before the first load")
+	}
+
+	err = list.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := list.Ready(context.Background()); err != nil {
+		t.Fatalf("expected the list to be ready, got %v", err)
+	}
+
+	tokenRevoked, accountRevokedBefore, err := list.FindRevocations(context.Background(), activeUuid, "jti-1")
+	if err != nil || !tokenRevoked || !accountRevokedBefore.Equal(revokedBefore) {
+		t.Fatalf("expected the token and the account revocations, got %t %s %v", tokenRevoked, accountRevokedBefore, err)
+	}
+
+	tokenRevoked, accountRevokedBefore, err = list.FindRevocations(context.Background(), bannedUuid, "")
+	if err != nil || tokenRevoked || !accountRevokedBefore.IsZero() {
+		t.Fatalf("expected no revocations, got %t %s %v", tokenRevoked, accountRevokedBefore, err)
+	}
+
+	// The previous list is used while the Accounts is unavailable, but not forever
+	provider.err = errors.New("accounts is down")
+	if list.Load(context.Background()) == nil {
+		t.Fatal("expected the load error")
+	}
+
+	clock.Advance(5 * time.Minute)
+	if _, _, err := list.FindRevocations(context.Background(), activeUuid, "jti-1"); err != nil {
+		t.Fatalf("expected the previous list to be used, got %v", err)
+	}
+
+	clock.Advance(time.Second)
+	if _, _, err := list.FindRevocations(context.Background(), activeUuid, "jti-1"); err == nil {
+		t.Fatal("expected the stale list to be reported as unavailable")
+	}
+
+	if list.Ready(context.Background()) == nil {
+		t.Fatal("expected the stale list not to be ready")
+	}
+}
@@ -0,0 +1,28 @@
+package authreader
+
+import "strconv"
+
+// Values are the same as the Account::STATUS_* constants in the Ely.by Accounts
+type AccountStatus int
+
+const (
+	AccountStatusDeleted     AccountStatus = -10
+	AccountStatusBanned      AccountStatus = -1
+	AccountStatusUnconfirmed AccountStatus = 0
+	AccountStatusActive      AccountStatus = 10
+)
+
+func (s AccountStatus) String() string {
+	switch s {
+	case AccountStatusDeleted:
+		return "deleted"
+	case AccountStatusBanned:
+		return "banned"
+	case AccountStatusUnconfirmed:
+		return "unconfirmed"
+	case AccountStatusActive:
+		return "active"
+	default:
+		return "unknown (" + strconv.Itoa(int(s)) + ")"
+	}
+}
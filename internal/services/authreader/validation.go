@@ -0,0 +1,119 @@
+package authreader
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/viper"
+)
+
+type TokenValidation struct {
+	// The token must have at least one of these scopes or all of them when RequireAllScopes is set
+	RequiredScopes   []string
+	RequireAllScopes bool
+	// When empty, the iss claim isn't checked
+	AllowedIssuers []string
+	// When empty, the aud claim isn't checked. Otherwise, at least one audience of the token must be allowed
+	AllowedAudiences []string
+	// Must contain exactly one capturing group that matches an account id
+	SubjectPattern *regexp.Regexp
+	// Allowed clock skew when checking exp, nbf and iat claims
+	Leeway time.Duration
+}
+
+// Default patterns of the sub claim, depending on what the reader expects to find there
+const (
+	accountIdSubjectPattern = `^ely\|(\d+)$`
+	uuidSubjectPattern      = `^([0-9a-fA-F]{8}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{12})$`
+)
+
+// The prefix allows each auth reader to have its own validation config
+func NewTokenValidationWithConfig(config *viper.Viper, prefix string, defaultSubjectPattern string) (*TokenValidation, error) {
+	config.SetDefault(prefix+".scopes", []string{"minecraft_server_session"})
+	config.SetDefault(prefix+".scopes_mode", "any")
+	config.SetDefault(prefix+".subject_pattern", defaultSubjectPattern)
+	config.SetDefault(prefix+".leeway", 0)
+
+	var requireAllScopes bool
+	switch mode := config.GetString(prefix + ".scopes_mode"); mode {
+	case "any":
+		requireAllScopes = false
+	case "all":
+		requireAllScopes = true
+	default:
+		return nil, fmt.Errorf("unknown scopes mode %s, expected any or all", mode)
+	}
+
+	subjectPattern, err := regexp.Compile(config.GetString(prefix + ".subject_pattern"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to compile subject pattern: %w", err)
+	}
+
+	if subjectPattern.NumSubexp() != 1 {
+		return nil, fmt.Errorf("subject pattern must contain exactly one capturing group, got %d", subjectPattern.NumSubexp())
+	}
+
+	return &TokenValidation{
+		RequiredScopes:   config.GetStringSlice(prefix + ".scopes"),
+		RequireAllScopes: requireAllScopes,
+		AllowedIssuers:   config.GetStringSlice(prefix + ".issuers"),
+		AllowedAudiences: config.GetStringSlice(prefix + ".audiences"),
+		SubjectPattern:   subjectPattern,
+		Leeway:           config.GetDuration(prefix + ".leeway"),
+	}, nil
+}
+
+// There is no jwt.WithValidMethods option since keys are pinned to their algorithms,
+// so the keyfunc rejects any other algorithm on its own and reports it as a distinct error
+func (v *TokenValidation) parserOptions() []jwt.ParserOption {
+	return []jwt.ParserOption{
+		jwt.WithLeeway(v.Leeway),
+	}
+}
+
+// Checks claims that aren't covered by the jwt parser and returns the captured part of the sub claim
+func (v *TokenValidation) validate(claims *claims) (string, error) {
+	if len(v.AllowedIssuers) > 0 && !slices.Contains(v.AllowedIssuers, claims.Issuer) {
+		return "", &unauthorizedError{reason: ReasonInvalidIssuer, msg: "the token has been issued by an unknown issuer"}
+	}
+
+	if len(v.AllowedAudiences) > 0 && !slices.ContainsFunc(claims.Audience, func(aud string) bool {
+		return slices.Contains(v.AllowedAudiences, aud)
+	}) {
+		return "", &unauthorizedError{reason: ReasonInvalidAudience, msg: "the token isn't intended for this service"}
+	}
+
+	if !v.hasRequiredScopes(strings.Fields(claims.Scope)) {
+		return "", &unauthorizedError{reason: ReasonInsufficientScope, msg: "the token doesn't have the scope to perform the action"}
+	}
+
+	matches := v.SubjectPattern.FindStringSubmatch(claims.Subject)
+	if matches == nil {
+		return "", &unauthorizedError{reason: ReasonInvalidSubject, msg: "invalid sub value"}
+	}
+
+	return matches[1], nil
+}
+
+func (v *TokenValidation) hasRequiredScopes(scopes []string) bool {
+	if len(v.RequiredScopes) == 0 {
+		return true
+	}
+
+	for _, requiredScope := range v.RequiredScopes {
+		hasScope := slices.Contains(scopes, requiredScope)
+		if v.RequireAllScopes && !hasScope {
+			return false
+		}
+
+		if !v.RequireAllScopes && hasScope {
+			return true
+		}
+	}
+
+	return v.RequireAllScopes
+}
@@ -0,0 +1,167 @@
+package authreader
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/viper"
+)
+
+func TestTokenValidation(t *testing.T) {
+	validation := &TokenValidation{
+		RequiredScopes:   []string{"minecraft_server_session", "profile"},
+		AllowedIssuers:   []string{"https://account.ely.by"},
+		AllowedAudiences: []string{"profilecerts"},
+		SubjectPattern:   regexp.MustCompile(`^ely\|(\d+)$`),
+	}
+
+	newClaims := func(modify func(claims *claims)) *claims {
+		claims := &claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:   "https://account.ely.by",
+				Audience: jwt.ClaimStrings{"skinsystem", "profilecerts"},
+				Subject:  "ely|42",
+			},
+			Scope: "minecraft_server_session",
+		}
+		if modify != nil {
+			modify(claims)
+		}
+
+		return claims
+	}
+
+	testCases := []struct {
+		name           string
+		claims         *claims
+		allScopes      bool
+		expectedReason string
+	}{
+		{name: "valid", claims: newClaims(nil)},
+		{name: "unknown issuer", claims: newClaims(func(c *claims) { c.Issuer = "https://evil.example" }), expectedReason: ReasonInvalidIssuer},
+		{name: "unknown audience", claims: newClaims(func(c *claims) { c.Audience = jwt.ClaimStrings{"skinsystem"} }), expectedReason: ReasonInvalidAudience},
+		{name: "no audience", claims: newClaims(func(c *claims) { c.Audience = nil }), expectedReason: ReasonInvalidAudience},
+		{name: "any of the scopes", claims: newClaims(func(c *claims) { c.Scope = "profile" })},
+		{name: "none of the scopes", claims: newClaims(func(c *claims) { c.Scope = "account_info" }), expectedReason: ReasonInsufficientScope},
+		{name: "all of the scopes", claims: newClaims(func(c *claims) { c.Scope = "profile minecraft_server_session" }), allScopes: true},
+		{name: "not all of the scopes", claims: newClaims(nil), allScopes: true, expectedReason: ReasonInsufficientScope},
+		{name: "foreign subject", claims: newClaims(func(c *claims) { c.Subject = "google|42" }), expectedReason: ReasonInvalidSubject},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			validation := *validation
+			validation.RequireAllScopes = testCase.allScopes
+
+			subject, err := validation.validate(testCase.claims)
+			if testCase.expectedReason != "" {
+				if reason := UnauthorizedReason(err); reason != testCase.expectedReason {
+					t.Fatalf("expected the %s reason, got %v", testCase.expectedReason, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if subject != "42" {
+				t.Fatalf("expected the 42 subject, got %s", subject)
+			}
+		})
+	}
+}
+
+func TestTokenValidationLeeway(t *testing.T) {
+	key := newSigningKey(t)
+	provider := newPublicKeysProvider(&PublicKey{Alg: "ES256", Key: &key.PublicKey})
+
+	claims := serverSessionClaims("ely|1")
+	claims["exp"] = time.Now().Add(-30 * time.Second).Unix()
+	token := "Bearer " + signToken(t, key, claims)
+
+	validation := newTestValidation()
+	reader := NewElyby(provider, nil, newAccountsRepositoryStub(), validation, testKeySetOptions)
+	_, err := reader.GetUuidFromAuthorizationHeader(context.Background(), token)
+	if reason := UnauthorizedReason(err); reason != ReasonExpired {
+		t.Fatalf("expected the expired reason, got %v", err)
+	}
+
+	validation.Leeway = time.Minute
+	_, err = reader.GetUuidFromAuthorizationHeader(context.Background(), token)
+	if err != nil {
+		t.Fatalf("expected the token to be accepted within the leeway, got %v", err)
+	}
+}
+
+func TestParseUserId(t *testing.T) {
+	userId, err := parseUserId("42")
+	if err != nil || userId != 42 {
+		t.Fatalf("expected the 42 account id, got %d %v", userId, err)
+	}
+
+	for _, subject := range []string{"99999999999999999999", "abc"} {
+		_, err := parseUserId(subject)
+		if reason := UnauthorizedReason(err); reason != ReasonInvalidSubject {
+			t.Errorf("expected the invalid subject reason for %q, got %v", subject, err)
+		}
+	}
+}
+
+func TestNewTokenValidationWithConfig(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		validation, err := NewTokenValidationWithConfig(viper.New(), "accounts.tokens", accountIdSubjectPattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		subject, err := validation.validate(&claims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: "ely|7"},
+			Scope:            "offline_access minecraft_server_session",
+		})
+		if err != nil || subject != "7" {
+			t.Fatalf("expected the 7 subject, got %s %v", subject, err)
+		}
+	})
+
+	t.Run("uuid subject pattern", func(t *testing.T) {
+		validation, err := NewTokenValidationWithConfig(viper.New(), "auth.introspection", uuidSubjectPattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, sub := range []string{activeUuid, "a2a65ee9a8a64bd498ab3c2d11bb1cbb"} {
+			subject, err := validation.validate(&claims{RegisteredClaims: jwt.RegisteredClaims{Subject: sub}, Scope: "minecraft_server_session"})
+			if err != nil || subject != sub {
+				t.Errorf("expected the %s subject, got %s %v", sub, subject, err)
+			}
+		}
+
+		_, err = validation.validate(&claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "ely|7"}, Scope: "minecraft_server_session"})
+		if reason := UnauthorizedReason(err); reason != ReasonInvalidSubject {
+			t.Fatalf("expected the invalid subject reason, got %v", err)
+		}
+	})
+
+	invalidConfigs := map[string]map[string]interface{}{
+		"unknown scopes mode":           {"accounts.tokens.scopes_mode": "some"},
+		"invalid subject pattern":       {"accounts.tokens.subject_pattern": `^ely\|(\d+$`},
+		"subject pattern without group": {"accounts.tokens.subject_pattern": `^ely\|\d+$`},
+	}
+	for name, values := range invalidConfigs {
+		t.Run(name, func(t *testing.T) {
+			config := viper.New()
+			for key, value := range values {
+				config.Set(key, value)
+			}
+
+			_, err := NewTokenValidationWithConfig(config, "accounts.tokens", accountIdSubjectPattern)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
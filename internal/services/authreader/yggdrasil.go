@@ -0,0 +1,141 @@
+package authreader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	uuidLib "github.com/google/uuid"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Should return an empty uuid when the token is unknown or no longer valid
+type YggdrasilTokenStore interface {
+	FindSelectedProfileByAccessToken(ctx context.Context, accessToken string) (string, error)
+}
+
+// Validates legacy Yggdrasil access tokens, which are opaque for us, using a token store
+type YggdrasilReader struct {
+	store      YggdrasilTokenStore
+	repository AccountsRepository
+}
+
+func NewYggdrasil(store YggdrasilTokenStore, repository AccountsRepository) *YggdrasilReader {
+	return &YggdrasilReader{store, repository}
+}
+
+func (r *YggdrasilReader) GetUuidFromAuthorizationHeader(ctx context.Context, authHeader string) (string, error) {
+	accessToken, found := strings.CutPrefix(authHeader, "Bearer ")
+	if !found || accessToken == "" {
+		err := &unauthorizedError{reason: ReasonInvalidHeader, msg: "authorization header has an invalid format"}
+		reportRejection(ctx, err)
+
+		return "", err
+	}
+
+	storeCtx, span := tracer.Start(ctx, "authreader.FindSelectedProfile")
+	profileUuid, err := r.store.FindSelectedProfileByAccessToken(storeCtx, accessToken)
+	endSpan(span, err)
+	if err != nil {
+		return "", fmt.Errorf("unable to validate yggdrasil access token: %w", err)
+	}
+
+	if profileUuid == "" {
+		err := &unauthorizedError{reason: ReasonInactive, msg: "the access token is unknown or no longer valid"}
+		reportRejection(ctx, err)
+
+		return "", err
+	}
+
+	parsedUuid, err := uuidLib.Parse(profileUuid)
+	if err != nil {
+		return "", fmt.Errorf("the token store has returned an invalid uuid %s: %w", profileUuid, err)
+	}
+
+	return findActiveAccountByUuid(ctx, r.repository, parsedUuid.String())
+}
+
+// The maximum size of the validation response body that will be read
+const maxYggdrasilResponseSize = 64 << 10
+
+type yggdrasilValidateRequest struct {
+	AccessToken string `json:"accessToken"`
+}
+
+type yggdrasilValidateResponse struct {
+	SelectedProfile struct {
+		Id string `json:"id"`
+	} `json:"selectedProfile"`
+}
+
+// Calls a Yggdrasil-compatible /validate endpoint. Unlike the original Yggdrasil API, which responds
+// with an empty 204, the endpoint must respond with 200 and the selectedProfile object,
+// the same as the /refresh endpoint does. Invalid tokens must be responded with 401 or 403
+type YggdrasilHttpStore struct {
+	validateUrl string
+	httpClient  *http.Client
+}
+
+func NewYggdrasilHttpStore(validateUrl string, httpClient *http.Client) *YggdrasilHttpStore {
+	return &YggdrasilHttpStore{validateUrl, httpClient}
+}
+
+func NewYggdrasilHttpStoreWithConfig(config *viper.Viper) (*YggdrasilHttpStore, error) {
+	config.SetDefault("auth.yggdrasil.timeout", 5*time.Second)
+
+	validateUrl := config.GetString("auth.yggdrasil.validate_url")
+	if validateUrl == "" {
+		return nil, fmt.Errorf("auth.yggdrasil.validate_url must be specified")
+	}
+
+	return NewYggdrasilHttpStore(validateUrl, &http.Client{Timeout: config.GetDuration("auth.yggdrasil.timeout")}), nil
+}
+
+func (s *YggdrasilHttpStore) FindSelectedProfileByAccessToken(ctx context.Context, accessToken string) (string, error) {
+	reqBody, _ := json.Marshal(&yggdrasilValidateRequest{accessToken})
+	req, err := http.NewRequestWithContext(ctx, "POST", s.validateUrl, bytes.NewReader(reqBody))
+	if err != nil {
+		return "", fmt.Errorf("unable to form a correct validate request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to perform a validate request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return "", nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("received unexpected response code from validate endpoint: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxYggdrasilResponseSize))
+	if err != nil {
+		return "", fmt.Errorf("unable to read validate response: %w", err)
+	}
+
+	var response yggdrasilValidateResponse
+	err = json.UnmarshalContext(ctx, body, &response)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse validate response: %w", err)
+	}
+
+	if response.SelectedProfile.Id == "" {
+		return "", fmt.Errorf("validate response doesn't contain the selected profile")
+	}
+
+	return response.SelectedProfile.Id, nil
+}
@@ -0,0 +1,109 @@
+package authreader
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goccy/go-json"
+)
+
+type yggdrasilTokenStoreStub map[string]string
+
+func (s yggdrasilTokenStoreStub) FindSelectedProfileByAccessToken(ctx context.Context, accessToken string) (string, error) {
+	if accessToken == "store-failure" {
+		return "", errors.New("the store is down")
+	}
+
+	return s[accessToken], nil
+}
+
+func TestYggdrasilReader(t *testing.T) {
+	reader := NewYggdrasil(yggdrasilTokenStoreStub{
+		"active":    "a2a65ee9a8a64bd498ab3c2d11bb1cbb",
+		"banned":    bannedUuid,
+		"deleted":   "c0ffee00-0000-4000-8000-000000000000",
+		"corrupted": "not-a-uuid",
+	}, newAccountsRepositoryStub())
+
+	testCases := []struct {
+		name          string
+		authHeader    string
+		expectedUuid  string
+		expectedError func(t *testing.T, err error)
+	}{
+		{name: "active account", authHeader: "Bearer active", expectedUuid: activeUuid},
+		{name: "banned account", authHeader: "Bearer banned", expectedError: expectAccountStatus(AccountStatusBanned, bannedUuid)},
+		{name: "deleted account", authHeader: "Bearer deleted", expectedError: expectAccountStatus(AccountStatusDeleted, "")},
+		{name: "unknown token", authHeader: "Bearer unknown", expectedError: expectUnauthorized(ReasonInactive)},
+		{name: "invalid header", authHeader: "Basic active", expectedError: expectUnauthorized(ReasonInvalidHeader)},
+		{name: "store failure", authHeader: "Bearer store-failure", expectedError: expectFailure},
+		{name: "invalid uuid in the store", authHeader: "Bearer corrupted", expectedError: expectFailure},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			uuid, err := reader.GetUuidFromAuthorizationHeader(context.Background(), testCase.authHeader)
+			if testCase.expectedError != nil {
+				testCase.expectedError(t, err)
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if uuid != testCase.expectedUuid {
+				t.Fatalf("expected uuid %s, got %s", testCase.expectedUuid, uuid)
+			}
+		})
+	}
+}
+
+func expectFailure(t *testing.T, err error) {
+	if err == nil || IsUnauthorized(err) {
+		t.Fatalf("expected a failure that isn't reported as unauthorized, got %v", err)
+	}
+}
+
+func TestYggdrasilHttpStore(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request yggdrasilValidateRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch request.AccessToken {
+		case "valid":
+			_, _ = w.Write([]byte(`{"accessToken":"valid","selectedProfile":{"id":"` + activeUuid + `","name":"erickskrauch"}}`))
+		case "without-profile":
+			_, _ = w.Write([]byte(`{"accessToken":"without-profile"}`))
+		case "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	store := NewYggdrasilHttpStore(server.URL, server.Client())
+
+	uuid, err := store.FindSelectedProfileByAccessToken(context.Background(), "valid")
+	if err != nil || uuid != activeUuid {
+		t.Fatalf("expected the %s profile, got %q %v", activeUuid, uuid, err)
+	}
+
+	uuid, err = store.FindSelectedProfileByAccessToken(context.Background(), "invalid")
+	if err != nil || uuid != "" {
+		t.Fatalf("expected an empty uuid for the invalid token, got %q %v", uuid, err)
+	}
+
+	for _, token := range []string{"without-profile", "broken"} {
+		_, err = store.FindSelectedProfileByAccessToken(context.Background(), token)
+		if err == nil {
+			t.Errorf("expected an error for the %s token", token)
+		}
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"ely.by/profilecerts/internal/http"
+	"ely.by/profilecerts/internal/services/audit"
 )
 
 const keySize = 2048
@@ -20,38 +22,157 @@ var refreshWindow = time.Hour * 8
 type KeysStorage interface {
 	GetPrivateKeyForUuid(ctx context.Context, uuid string) (*rsa.PrivateKey, time.Time, error)
 	StorePrivateKeyForUuid(ctx context.Context, uuid string, key *rsa.PrivateKey, expireAt time.Time) error
+	// Should return false when there was no key to delete
+	DeletePrivateKeyForUuid(ctx context.Context, uuid string) (bool, error)
+	// Iterates over stored keys. Like the SCAN command, it may return fewer or more items than requested
+	// and the same key may be returned more than once. The iteration is over when the returned cursor is 0
+	ScanPublicKeys(ctx context.Context, cursor uint64, count int64) ([]*StoredPublicKey, uint64, error)
+}
+
+// The public part of a stored key, the listing doesn't need to decode private keys
+type StoredPublicKey struct {
+	Uuid      string
+	Key       *rsa.PublicKey
+	ExpiresAt time.Time
+}
+
+type AuditLog interface {
+	Record(ctx context.Context, event *audit.Event)
+}
+
+// Bounds how many keys are generated at once
+type Limiter interface {
+	Acquire(ctx context.Context) (func(), error)
 }
 
 type Manager struct {
 	KeysStorage
+	AuditLog
+	keyGeneration Limiter
 }
 
-func New(keysStorage KeysStorage) *Manager {
-	return &Manager{keysStorage}
+func New(keysStorage KeysStorage, auditLog AuditLog, keyGenerationLimiter Limiter) *Manager {
+	return &Manager{keysStorage, auditLog, keyGenerationLimiter}
 }
 
 func (m *Manager) GetKeypairForUser(ctx context.Context, uuid string) (*http.ProfileCertificate, error) {
 	privateKey, expiresAt, err := m.KeysStorage.GetPrivateKeyForUuid(ctx, uuid)
 	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve exists certificate for player's uuid: %w", err)
+		return nil, fmt.Errorf("unable to retrieve exists certificate for player's uuid: %w: %w", http.ErrKeysStorage, err)
 	}
 
 	if privateKey == nil || expiresAt.Add(-refreshWindow).Before(timeNow()) {
-		privateKey, err = rsa.GenerateKey(randReader, keySize)
-		if err != nil {
-			return nil, fmt.Errorf("unable to generate a new RSA private key: %w", err)
-		}
+		keypairs.WithLabelValues("generated").Inc()
 
-		expiresAt = timeNow().Add(certTtl)
-		err = m.KeysStorage.StorePrivateKeyForUuid(ctx, uuid, privateKey, expiresAt)
-		if err != nil {
-			return nil, fmt.Errorf("unable to store a newly generated private key: %w", err)
-		}
+		return m.generateKeypair(ctx, uuid, audit.EventCertificateIssued)
+	}
+
+	keypairs.WithLabelValues("reused").Inc()
+
+	return &http.ProfileCertificate{
+		Key:       privateKey,
+		ExpiresAt: expiresAt,
+		RefreshAt: expiresAt.Add(-refreshWindow),
+	}, nil
+}
+
+// Generates a new key even if the stored one is still valid
+func (m *Manager) RotateKeypairForUser(ctx context.Context, uuid string) (*http.ProfileCertificate, error) {
+	return m.generateKeypair(ctx, uuid, audit.EventCertificateRotated)
+}
+
+func (m *Manager) generateKeypair(ctx context.Context, uuid string, eventType string) (*http.ProfileCertificate, error) {
+	release, err := m.keyGeneration.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to start generating a new RSA private key: %w", err)
 	}
 
+	start := time.Now()
+	_, span := tracer.Start(ctx, "certmanager.GenerateKey")
+	privateKey, err := rsa.GenerateKey(randReader, keySize)
+	span.End()
+	keyGenerationDuration.Observe(time.Since(start).Seconds())
+	release()
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate a new RSA private key: %w", err)
+	}
+
+	expiresAt := timeNow().Add(certTtl)
+	err = m.KeysStorage.StorePrivateKeyForUuid(ctx, uuid, privateKey, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("unable to store a newly generated private key: %w: %w", http.ErrKeysStorage, err)
+	}
+
+	slog.DebugContext(ctx, "a new private key has been issued", slog.String("uuid", uuid), slog.Time("expires_at", expiresAt))
+	m.AuditLog.Record(ctx, &audit.Event{
+		Type:        eventType,
+		Uuid:        uuid,
+		Fingerprint: audit.Fingerprint(&privateKey.PublicKey),
+		ExpiresAt:   &expiresAt,
+	})
+
 	return &http.ProfileCertificate{
 		Key:       privateKey,
 		ExpiresAt: expiresAt,
 		RefreshAt: expiresAt.Add(-refreshWindow),
 	}, nil
 }
+
+// Returns nil when there is no active certificate for the uuid
+func (m *Manager) GetCertificateInfo(ctx context.Context, uuid string) (*http.CertificateInfo, error) {
+	privateKey, expiresAt, err := m.KeysStorage.GetPrivateKeyForUuid(ctx, uuid)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve exists certificate for player's uuid: %w: %w", http.ErrKeysStorage, err)
+	}
+
+	if privateKey == nil {
+		return nil, nil
+	}
+
+	return &http.CertificateInfo{
+		Uuid:      uuid,
+		PublicKey: &privateKey.PublicKey,
+		ExpiresAt: expiresAt,
+		RefreshAt: expiresAt.Add(-refreshWindow),
+	}, nil
+}
+
+// See KeysStorage.ScanPublicKeys for the cursor semantics
+func (m *Manager) ListCertificates(ctx context.Context, cursor uint64, count int64) ([]*http.CertificateInfo, uint64, error) {
+	keys, nextCursor, err := m.KeysStorage.ScanPublicKeys(ctx, cursor, count)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to list stored keys: %w: %w", http.ErrKeysStorage, err)
+	}
+
+	result := make([]*http.CertificateInfo, len(keys))
+	for i, key := range keys {
+		result[i] = &http.CertificateInfo{
+			Uuid:      key.Uuid,
+			PublicKey: key.Key,
+			ExpiresAt: key.ExpiresAt,
+			RefreshAt: key.ExpiresAt.Add(-refreshWindow),
+		}
+	}
+
+	return result, nextCursor, nil
+}
+
+func (m *Manager) RevokeKeypairForUser(ctx context.Context, uuid string) error {
+	deleted, err := m.KeysStorage.DeletePrivateKeyForUuid(ctx, uuid)
+	if err != nil {
+		return fmt.Errorf("unable to delete stored private key for player's uuid: %w: %w", http.ErrKeysStorage, err)
+	}
+
+	// Banned accounts revoke their keys on each request, so only the actual revocation is reported
+	if !deleted {
+		return nil
+	}
+
+	slog.InfoContext(ctx, "the private key has been revoked", slog.String("uuid", uuid))
+	m.AuditLog.Record(ctx, &audit.Event{
+		Type: audit.EventCertificateRevoked,
+		Uuid: uuid,
+	})
+
+	return nil
+}
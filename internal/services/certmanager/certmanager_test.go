@@ -0,0 +1,302 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ely.by/profilecerts/internal/http"
+	"ely.by/profilecerts/internal/services/admission"
+	"ely.by/profilecerts/internal/services/audit"
+)
+
+const testUuid = "a2a65ee9-a8a6-4bd4-98ab-3c2d11bb1cbb"
+
+var (
+	testKeyOnce sync.Once
+	testKey     *rsa.PrivateKey
+)
+
+// The key generation is slow, so a single key is shared between tests
+func getTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	testKeyOnce.Do(func() {
+		var err error
+		testKey, err = rsa.GenerateKey(rand.Reader, keySize)
+		if err != nil {
+			panic(err)
+		}
+	})
+
+	return testKey
+}
+
+type storedKey struct {
+	key       *rsa.PrivateKey
+	expiresAt time.Time
+}
+
+type keysStorageStub struct {
+	keys map[string]storedKey
+	err  error
+}
+
+func newKeysStorageStub() *keysStorageStub {
+	return &keysStorageStub{keys: make(map[string]storedKey)}
+}
+
+func (s *keysStorageStub) GetPrivateKeyForUuid(ctx context.Context, uuid string) (*rsa.PrivateKey, time.Time, error) {
+	stored := s.keys[uuid]
+
+	return stored.key, stored.expiresAt, s.err
+}
+
+func (s *keysStorageStub) StorePrivateKeyForUuid(ctx context.Context, uuid string, key *rsa.PrivateKey, expireAt time.Time) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	s.keys[uuid] = storedKey{key, expireAt}
+
+	return nil
+}
+
+func (s *keysStorageStub) DeletePrivateKeyForUuid(ctx context.Context, uuid string) (bool, error) {
+	if s.err != nil {
+		return false, s.err
+	}
+
+	_, found := s.keys[uuid]
+	delete(s.keys, uuid)
+
+	return found, nil
+}
+
+func (s *keysStorageStub) ScanPublicKeys(ctx context.Context, cursor uint64, count int64) ([]*StoredPublicKey, uint64, error) {
+	if s.err != nil {
+		return nil, 0, s.err
+	}
+
+	result := make([]*StoredPublicKey, 0, len(s.keys))
+	for uuid, stored := range s.keys {
+		result = append(result, &StoredPublicKey{Uuid: uuid, Key: &stored.key.PublicKey, ExpiresAt: stored.expiresAt})
+	}
+
+	return result, 0, nil
+}
+
+type auditLogStub struct {
+	events []*audit.Event
+}
+
+func (l *auditLogStub) Record(ctx context.Context, event *audit.Event) {
+	l.events = append(l.events, event)
+}
+
+type limiterStub struct {
+	err      error
+	acquired int
+	released int
+}
+
+func (l *limiterStub) Acquire(ctx context.Context) (func(), error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+
+	l.acquired++
+
+	return func() {
+		l.released++
+	}, nil
+}
+
+func useFakeTime(t *testing.T, now time.Time) {
+	t.Helper()
+
+	timeNow = func() time.Time {
+		return now
+	}
+	t.Cleanup(func() {
+		timeNow = time.Now
+	})
+}
+
+func TestGetKeypairForUser(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	useFakeTime(t, now)
+
+	testCases := []struct {
+		name              string
+		stored            *storedKey
+		expectedGenerated bool
+	}{
+		{name: "no stored key", expectedGenerated: true},
+		{name: "stored key", stored: &storedKey{getTestKey(t), now.Add(9 * time.Hour)}},
+		{name: "stored key in the refresh window", stored: &storedKey{getTestKey(t), now.Add(7 * time.Hour)}, expectedGenerated: true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			storage := newKeysStorageStub()
+			if testCase.stored != nil {
+				storage.keys[testUuid] = *testCase.stored
+			}
+
+			generated := testutil.ToFloat64(keypairs.WithLabelValues("generated"))
+			reused := testutil.ToFloat64(keypairs.WithLabelValues("reused"))
+
+			auditLog := &auditLogStub{}
+			cert, err := New(storage, auditLog, &limiterStub{}).GetKeypairForUser(context.Background(), testUuid)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if testCase.expectedGenerated {
+				if cert.Key == getTestKey(t) || !cert.ExpiresAt.Equal(now.Add(certTtl)) || storage.keys[testUuid].key != cert.Key {
+					t.Fatalf("expected a new key to be generated and stored, got %+v", cert)
+				}
+
+				if testutil.ToFloat64(keypairs.WithLabelValues("generated"))-generated != 1 {
+					t.Error("expected the generated keypair to be counted")
+				}
+
+				if len(auditLog.events) != 1 || auditLog.events[0].Type != audit.EventCertificateIssued || auditLog.events[0].Fingerprint != audit.Fingerprint(&cert.Key.PublicKey) {
+					t.Errorf("expected the issuance to be audited, got %+v", auditLog.events)
+				}
+			} else {
+				if cert.Key != getTestKey(t) || !cert.ExpiresAt.Equal(testCase.stored.expiresAt) {
+					t.Fatalf("expected the stored key, got %+v", cert)
+				}
+
+				if testutil.ToFloat64(keypairs.WithLabelValues("reused"))-reused != 1 {
+					t.Error("expected the reused keypair to be counted")
+				}
+
+				if len(auditLog.events) != 0 {
+					t.Errorf("expected the reused keypair not to be audited, got %+v", auditLog.events)
+				}
+			}
+
+			if !cert.RefreshAt.Equal(cert.ExpiresAt.Add(-refreshWindow)) {
+				t.Fatalf("expected the refresh time %s before the expiration, got %s", refreshWindow, cert.RefreshAt)
+			}
+		})
+	}
+}
+
+func TestListCertificates(t *testing.T) {
+	expiresAt := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+	storage := newKeysStorageStub()
+	storage.keys[testUuid] = storedKey{getTestKey(t), expiresAt}
+
+	infos, nextCursor, err := New(storage, &auditLogStub{}, &limiterStub{}).ListCertificates(context.Background(), 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if nextCursor != 0 || len(infos) != 1 {
+		t.Fatalf("expected a single certificate, got %d", len(infos))
+	}
+
+	info := infos[0]
+	if info.Uuid != testUuid || !info.PublicKey.Equal(&getTestKey(t).PublicKey) || !info.ExpiresAt.Equal(expiresAt) || !info.RefreshAt.Equal(expiresAt.Add(-refreshWindow)) {
+		t.Fatalf("unexpected certificate info: %+v", info)
+	}
+}
+
+func TestRevokeKeypairForUser(t *testing.T) {
+	storage := newKeysStorageStub()
+	storage.keys[testUuid] = storedKey{getTestKey(t), time.Now().Add(time.Hour)}
+	auditLog := &auditLogStub{}
+	manager := New(storage, auditLog, &limiterStub{})
+
+	for i := 0; i < 2; i++ {
+		err := manager.RevokeKeypairForUser(context.Background(), testUuid)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, found := storage.keys[testUuid]; found {
+		t.Fatal("expected the key to be deleted")
+	}
+
+	// Banned accounts revoke their keys on each request, so there must be no event without a deleted key
+	if len(auditLog.events) != 1 || auditLog.events[0].Type != audit.EventCertificateRevoked || auditLog.events[0].Uuid != testUuid {
+		t.Fatalf("expected a single revocation to be audited, got %+v", auditLog.events)
+	}
+}
+
+func TestKeysStorageFailures(t *testing.T) {
+	storage := newKeysStorageStub()
+	storage.err = errors.New("redis is down")
+	manager := New(storage, &auditLogStub{}, &limiterStub{})
+
+	_, err := manager.GetKeypairForUser(context.Background(), testUuid)
+	if !errors.Is(err, http.ErrKeysStorage) {
+		t.Errorf("expected the storage error for the key retrieval, got %v", err)
+	}
+
+	_, _, err = manager.ListCertificates(context.Background(), 0, 10)
+	if !errors.Is(err, http.ErrKeysStorage) {
+		t.Errorf("expected the storage error for the listing, got %v", err)
+	}
+
+	err = manager.RevokeKeypairForUser(context.Background(), testUuid)
+	if !errors.Is(err, http.ErrKeysStorage) {
+		t.Errorf("expected the storage error for the revocation, got %v", err)
+	}
+
+	// The key is generated before it's stored
+	_, err = manager.RotateKeypairForUser(context.Background(), testUuid)
+	if !errors.Is(err, http.ErrKeysStorage) {
+		t.Errorf("expected the storage error for the rotation, got %v", err)
+	}
+}
+
+func TestKeyGenerationFailure(t *testing.T) {
+	randReader = iotest.ErrReader(errors.New("no entropy"))
+	t.Cleanup(func() {
+		randReader = rand.Reader
+	})
+
+	// It isn't the storage's fault, so it mustn't be reported as its unavailability
+	_, err := New(newKeysStorageStub(), &auditLogStub{}, &limiterStub{}).GetKeypairForUser(context.Background(), testUuid)
+	if err == nil || errors.Is(err, http.ErrKeysStorage) {
+		t.Fatalf("expected the generation error, got %v", err)
+	}
+}
+
+func TestKeyGenerationAdmission(t *testing.T) {
+	limiter := &limiterStub{}
+	manager := New(newKeysStorageStub(), &auditLogStub{}, limiter)
+
+	_, err := manager.GetKeypairForUser(context.Background(), testUuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The stored key is reused without generation
+	_, err = manager.GetKeypairForUser(context.Background(), testUuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if limiter.acquired != 1 || limiter.released != 1 {
+		t.Fatalf("expected a single slot to be acquired and released, got %d and %d", limiter.acquired, limiter.released)
+	}
+
+	limiter.err = &admission.OverloadedError{Limiter: "key_generation", Reason: admission.ReasonQueueFull, RetryAfter: time.Second}
+	_, err = manager.RotateKeypairForUser(context.Background(), testUuid)
+	if _, ok := admission.AsOverloadedError(err); !ok || errors.Is(err, http.ErrKeysStorage) {
+		t.Fatalf("expected the overloaded error, got %v", err)
+	}
+}
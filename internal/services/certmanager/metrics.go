@@ -0,0 +1,21 @@
+package certmanager
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var keypairs = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "profilecerts",
+	Subsystem: "certmanager",
+	Name:      "keypairs_total",
+	Help:      "The number of served keypairs, partitioned by whether the stored one was reused or a new one was generated",
+}, []string{"result"})
+
+var keyGenerationDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+	Namespace: "profilecerts",
+	Subsystem: "certmanager",
+	Name:      "key_generation_duration_seconds",
+	Help:      "Duration of RSA private keys generation",
+	Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5},
+})
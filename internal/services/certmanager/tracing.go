@@ -0,0 +1,5 @@
+package certmanager
+
+import "go.opentelemetry.io/otel"
+
+var tracer = otel.Tracer("ely.by/profilecerts/internal/services/certmanager")
@@ -10,6 +10,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 
@@ -18,11 +19,17 @@ import (
 
 var randomReader = rand.Reader
 
+// Bounds how many signatures are computed at once
+type Limiter interface {
+	Acquire(ctx context.Context) (func(), error)
+}
+
 type Local struct {
-	key *rsa.PrivateKey
+	key     *rsa.PrivateKey
+	limiter Limiter
 }
 
-func NewLocalWithConfig(config *viper.Viper) (*Local, error) {
+func NewLocalWithConfig(config *viper.Viper, limiter Limiter) (*Local, error) {
 	var privateKey *rsa.PrivateKey
 	var err error
 
@@ -47,11 +54,11 @@ func NewLocalWithConfig(config *viper.Viper) (*Local, error) {
 		}
 	}
 
-	return NewLocal(privateKey), nil
+	return NewLocal(privateKey, limiter), nil
 }
 
-func NewLocal(key *rsa.PrivateKey) *Local {
-	return &Local{key}
+func NewLocal(key *rsa.PrivateKey, limiter Limiter) *Local {
+	return &Local{key, limiter}
 }
 
 func (s *Local) Sign(ctx context.Context, data []byte) ([]byte, error) {
@@ -61,6 +68,13 @@ func (s *Local) Sign(ctx context.Context, data []byte) ([]byte, error) {
 		return nil, err
 	}
 
+	release, err := s.limiter.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to start signing: %w", err)
+	}
+
+	defer release()
+
 	messageHashSum := messageHash.Sum(nil)
 	signature, err := rsa.SignPKCS1v15(randomReader, s.key, crypto.SHA1, messageHashSum)
 	if err != nil {
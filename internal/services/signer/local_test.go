@@ -0,0 +1,46 @@
+package signer
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"testing"
+	"time"
+
+	"ely.by/profilecerts/internal/services/admission"
+)
+
+func TestLocalSign(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limiter := admission.New("signing", admission.Options{Concurrency: 1, QueueSize: 0, QueueTimeout: time.Second})
+	signer := NewLocal(key, limiter)
+
+	signature, err := signer.Sign(context.Background(), []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := sha1.Sum([]byte("data"))
+	err = rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, hash[:], signature)
+	if err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+
+	// The slot has been released after the signing, so the next one is shed only while it's busy
+	release, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	_, err = signer.Sign(context.Background(), []byte("data"))
+	if _, ok := admission.AsOverloadedError(err); !ok {
+		t.Fatalf("expected the overloaded error, got %v", err)
+	}
+}